@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+)
+
+// burpItems is Burp Suite's saved items format, which Burp imports into
+// its site map and ZAP and most replay tools read too
+type burpItems struct {
+	XMLName     xml.Name   `xml:"items"`
+	BurpVersion string     `xml:"burpVersion,attr"`
+	ExportTime  string     `xml:"exportTime,attr"`
+	Items       []burpItem `xml:"item"`
+}
+
+type burpItem struct {
+	Time      string      `xml:"time"`
+	URL       burpCDATA   `xml:"url"`
+	Host      burpHost    `xml:"host"`
+	Port      string      `xml:"port"`
+	Protocol  string      `xml:"protocol"`
+	Method    burpCDATA   `xml:"method"`
+	Path      burpCDATA   `xml:"path"`
+	Extension string      `xml:"extension"`
+	Request   burpEncoded `xml:"request"`
+	Status    string      `xml:"status"`
+	Length    string      `xml:"responselength"`
+	MimeType  string      `xml:"mimetype"`
+	Response  burpEncoded `xml:"response"`
+	Comment   burpCDATA   `xml:"comment"`
+}
+
+type burpCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+type burpHost struct {
+	IP   string `xml:"ip,attr"`
+	Name string `xml:",chardata"`
+}
+
+type burpEncoded struct {
+	Base64 bool   `xml:"base64,attr"`
+	Text   string `xml:",cdata"`
+}
+
+// writeBurpItems saves the request behind each confirmed reflection in
+// findings as a Burp item, base64 encoded with the custom headers headers
+// returns for its URL and a POST's body as it was sent, so it can be sent
+// to Repeater as it is. Unlike every other output it isn't redacted, a
+// request with its cookies and tokens masked wouldn't replay. Findings
+// without a request are skipped
+func writeBurpItems(path string, findings []schema.Result, headers func(link string) map[string]string) error {
+	items := burpItems{BurpVersion: "go-reflect " + toolVersion(), ExportTime: time.Now().Format(time.RFC1123)}
+	for _, f := range findings {
+		if f.Fields["confidence"] != "confirmed" && f.Fields["confidence"] != "browser-verified" {
+			continue
+		}
+		req := reproduction(f)
+		if req == nil {
+			continue
+		}
+		u, err := url.Parse(req.Target)
+		if err != nil {
+			continue
+		}
+		port := u.Port()
+		if port == "" {
+			port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+		}
+		body := ""
+		if req.Body != nil {
+			body = req.Body.Text
+		}
+		items.Items = append(items.Items, burpItem{
+			Time:      time.Now().Format(time.RFC1123),
+			URL:       burpCDATA{req.Target},
+			Host:      burpHost{Name: u.Hostname()},
+			Port:      port,
+			Protocol:  u.Scheme,
+			Method:    burpCDATA{req.Method},
+			Path:      burpCDATA{u.RequestURI()},
+			Extension: "null",
+			Request:   burpEncoded{true, base64.StdEncoding.EncodeToString([]byte(rawRequest(req.Method, u, headers(req.Target), body)))},
+			Response:  burpEncoded{Base64: true},
+			Comment:   burpCDATA{f.Text},
+		})
+	}
+	data, err := xml.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
+
+// rawRequest writes out an HTTP/1.1 request as it goes on the wire
+func rawRequest(method string, u *url.URL, headers map[string]string, body string) string {
+	lines := []string{fmt.Sprintf("%s %s HTTP/1.1", method, u.RequestURI()), "Host: " + u.Host}
+	all := map[string]string{"User-Agent": reflector.UserAgent}
+	if body != "" {
+		all["Content-Type"] = "application/x-www-form-urlencoded"
+	}
+	for name, value := range headers {
+		if name == "Host" {
+			lines[1] = "Host: " + value
+			continue
+		}
+		all[name] = value
+	}
+	var names []string
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, name+": "+all[name])
+	}
+	if body != "" {
+		lines = append(lines, fmt.Sprintf("Content-Length: %d", len(body)))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n\r\n" + body
+}
@@ -0,0 +1,198 @@
+// Command libreflector builds the crawler as a C shared library, so tools
+// written in Python, Node and the like can run it in-process and receive
+// results as they are found instead of parsing the command line output:
+//
+//	go build -buildmode=c-shared -o libreflector.so ./cmd/libreflector
+//
+// The exported functions, declared in the generated libreflector.h, are a
+// stable ABI: ReflectorABIVersion is bumped whenever one of them changes.
+// Options are a JSON object of the fields of libOptions, e.g.
+// {"threads": 8, "timeout": 10}, and results are JSON objects of the
+// versioned schema.Result.
+// Strings returned by the library must be released with ReflectorFree
+package main
+
+/*
+#include <stdlib.h>
+
+typedef void (*reflector_callback)(const char *result, void *userdata);
+
+static inline void reflector_call(reflector_callback cb, const char *result, void *userdata) {
+	cb(result, userdata);
+}
+*/
+import "C"
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+)
+
+// abiVersion is bumped whenever an exported function changes, the options
+// it takes included
+const abiVersion = 2
+
+// subscriber is a C callback and the pointer it is called back with
+type subscriber struct {
+	cb       C.reflector_callback
+	userdata unsafe.Pointer
+}
+
+// handle is a crawler and its subscribers, C only ever sees its id
+type handle struct {
+	crawler *reflector.Crawler
+
+	mu          sync.Mutex
+	subscribers []subscriber
+}
+
+var (
+	handlesMu  sync.Mutex
+	handles    = make(map[int64]*handle)
+	nextHandle int64
+)
+
+func lookup(h C.longlong) *handle {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	return handles[int64(h)]
+}
+
+// setError stores err in *errOut for the caller to free, if it asked for it
+func setError(errOut **C.char, err error) {
+	if errOut != nil {
+		*errOut = C.CString(err.Error())
+	}
+}
+
+//export ReflectorABIVersion
+func ReflectorABIVersion() C.int {
+	return abiVersion
+}
+
+// ReflectorNew creates a crawler from a JSON object of options, returning a
+// handle or 0 with the error in *err
+//
+//export ReflectorNew
+func ReflectorNew(options *C.char, errOut **C.char) C.longlong {
+	var lib libOptions
+	if options != nil {
+		decoder := json.NewDecoder(strings.NewReader(C.GoString(options)))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&lib); err != nil {
+			setError(errOut, err)
+			return 0
+		}
+	}
+	opts, err := lib.options()
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	crawler, err := reflector.New(opts)
+	if err != nil {
+		setError(errOut, err)
+		return 0
+	}
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	nextHandle++
+	handles[nextHandle] = &handle{crawler: crawler}
+	return C.longlong(nextHandle)
+}
+
+// ReflectorSubscribe registers a callback called with every result as a
+// JSON object. It is called from the crawler's own threads, one result at a
+// time, and the string is only valid during the call
+//
+//export ReflectorSubscribe
+func ReflectorSubscribe(h C.longlong, cb C.reflector_callback, userdata unsafe.Pointer) C.int {
+	hd := lookup(h)
+	if hd == nil || cb == nil {
+		return -1
+	}
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	hd.subscribers = append(hd.subscribers, subscriber{cb: cb, userdata: userdata})
+	return 0
+}
+
+// ReflectorRun crawls newline separated targets, each optionally followed by
+// key=value tags, and returns once every crawl is done. Results go to the
+// subscribers as they are found. Returns 0, or -1 with the error in *err
+//
+//export ReflectorRun
+func ReflectorRun(h C.longlong, targets *C.char, errOut **C.char) C.int {
+	hd := lookup(h)
+	if hd == nil {
+		setError(errOut, errors.New("unknown handle"))
+		return -1
+	}
+	lines := make(chan string)
+	results := make(chan reflector.Result)
+	go func() {
+		for _, line := range strings.Split(C.GoString(targets), "\n") {
+			lines <- line
+		}
+		close(lines)
+	}()
+	go hd.crawler.Run(lines, results)
+	for res := range results {
+		hd.publish(res)
+	}
+	return 0
+}
+
+// publish hands a result to every subscriber
+func (hd *handle) publish(res reflector.Result) {
+	data, err := res.Schema().JSON()
+	if err != nil {
+		return
+	}
+	result := C.CString(string(bytes.TrimSpace(data)))
+	defer C.free(unsafe.Pointer(result))
+	hd.mu.Lock()
+	defer hd.mu.Unlock()
+	for _, s := range hd.subscribers {
+		C.reflector_call(s.cb, result, s.userdata)
+	}
+}
+
+// ReflectorSummary returns the summary of everything the crawler has
+// crawled, as the command line tool prints it at the end of a run
+//
+//export ReflectorSummary
+func ReflectorSummary(h C.longlong) *C.char {
+	hd := lookup(h)
+	if hd == nil {
+		return nil
+	}
+	var summary bytes.Buffer
+	hd.crawler.PrintSummary(&summary)
+	return C.CString(summary.String())
+}
+
+// ReflectorClose releases a crawler, its handle can't be used afterwards
+//
+//export ReflectorClose
+func ReflectorClose(h C.longlong) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	delete(handles, int64(h))
+}
+
+// ReflectorFree releases a string returned by the library
+//
+//export ReflectorFree
+func ReflectorFree(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+// a c-shared build needs a main package, but never runs main
+func main() {}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"time"
+
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+)
+
+// libOptions is the JSON object ReflectorNew takes, the reflector.Options a
+// library caller may set under names of their own. Durations are in seconds,
+// and files, like mutations, are paths. A store and a log writer can't be
+// passed through C, so they have no counterpart
+type libOptions struct {
+	Threads            int                 `json:"threads"`
+	Adaptive           bool                `json:"adaptive"`
+	MaxThreads         int                 `json:"max_threads"`
+	Depth              int                 `json:"depth"`
+	Insecure           bool                `json:"insecure"`
+	NoTLSResume        bool                `json:"no_tls_resume"`
+	Subdomains         bool                `json:"subdomains"`
+	Scope              string              `json:"scope"`
+	Headers            map[string]string   `json:"headers"`
+	HeaderScope        map[string][]string `json:"header_scope"`
+	ResolveEachRequest bool                `json:"resolve_each_request"`
+	UserAgents         string              `json:"user_agents"`
+	Proxy              string              `json:"proxy"`
+	Timeout            float64             `json:"timeout"`
+	Retries            int                 `json:"retries"`
+	CrawlRate          float64             `json:"crawl_rate"`
+	ProbeRate          float64             `json:"probe_rate"`
+	Identities         string              `json:"identities"`
+	Rotate             int                 `json:"rotate"`
+	ParamsOnly         bool                `json:"params_only"`
+	Robots             bool                `json:"robots"`
+	RespectRobots      bool                `json:"respect_robots"`
+	NoDiscover         bool                `json:"no_discover"`
+	Meta               bool                `json:"meta"`
+	Timings            bool                `json:"timings"`
+	HeatMap            string              `json:"heatmap"`
+	NoUpgrade          bool                `json:"no_upgrade"`
+	Batch              int                 `json:"batch"`
+	Prefill            string              `json:"prefill"`
+	Signals            string              `json:"signals"`
+	Strategy           string              `json:"strategy"`
+	DepthTime          float64             `json:"depth_time"`
+	MaxRuntime         float64             `json:"max_runtime"`
+	TargetConcurrency  int                 `json:"target_concurrency"`
+	MaxURLs            int                 `json:"max_urls"`
+	MaxTime            float64             `json:"max_time"`
+	MaxBodySize        int64               `json:"max_body_size"`
+	ContentTypes       []string            `json:"content_types"`
+	Preview            int                 `json:"preview"`
+	VerifyBrowser      bool                `json:"verify_browser"`
+	Render             bool                `json:"render"`
+	ScreenshotDiff     bool                `json:"screenshot_diff"`
+	Dismiss            []string            `json:"dismiss"`
+	Browser            string              `json:"browser"`
+	Query              bool                `json:"query"`
+	TestHeaders        bool                `json:"test_headers"`
+	ScanScripts        bool                `json:"scan_scripts"`
+	Dig                bool                `json:"dig"`
+	WebSockets         bool                `json:"websockets"`
+	Methods            []string            `json:"methods"`
+	SecondPass         bool                `json:"second_pass"`
+	Cluster            bool                `json:"cluster"`
+	Probes             []string            `json:"probes"`
+	Mutations          string              `json:"mutations"`
+	State              string              `json:"state"`
+	Resume             bool                `json:"resume"`
+	LoginURL           string              `json:"login_url"`
+	LoginData          string              `json:"login_data"`
+	MineParams         bool                `json:"mine_params"`
+	DiscoverParams     bool                `json:"discover_params"`
+}
+
+// seconds converts a duration option
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// options maps the JSON options onto reflector.Options
+func (o libOptions) options() (reflector.Options, error) {
+	opts := reflector.Options{
+		Threads:            o.Threads,
+		Adaptive:           o.Adaptive,
+		MaxThreads:         o.MaxThreads,
+		Depth:              o.Depth,
+		Insecure:           o.Insecure,
+		NoTLSResume:        o.NoTLSResume,
+		Subdomains:         o.Subdomains,
+		Scope:              o.Scope,
+		Headers:            o.Headers,
+		HeaderScope:        o.HeaderScope,
+		ResolveEachRequest: o.ResolveEachRequest,
+		UserAgents:         o.UserAgents,
+		Proxy:              o.Proxy,
+		Timeout:            seconds(o.Timeout),
+		Retries:            o.Retries,
+		CrawlRate:          o.CrawlRate,
+		ProbeRate:          o.ProbeRate,
+		Identities:         o.Identities,
+		Rotate:             o.Rotate,
+		ParamsOnly:         o.ParamsOnly,
+		Robots:             o.Robots,
+		RespectRobots:      o.RespectRobots,
+		NoDiscover:         o.NoDiscover,
+		Meta:               o.Meta,
+		Timings:            o.Timings,
+		HeatMap:            o.HeatMap,
+		NoUpgrade:          o.NoUpgrade,
+		Batch:              o.Batch,
+		Prefill:            o.Prefill,
+		Signals:            o.Signals,
+		Strategy:           o.Strategy,
+		DepthTime:          seconds(o.DepthTime),
+		MaxRuntime:         seconds(o.MaxRuntime),
+		TargetConcurrency:  o.TargetConcurrency,
+		MaxURLs:            o.MaxURLs,
+		MaxTime:            seconds(o.MaxTime),
+		MaxBodySize:        o.MaxBodySize,
+		ContentTypes:       o.ContentTypes,
+		Preview:            o.Preview,
+		VerifyBrowser:      o.VerifyBrowser,
+		Render:             o.Render,
+		ScreenshotDiff:     o.ScreenshotDiff,
+		Dismiss:            o.Dismiss,
+		Browser:            o.Browser,
+		Query:              o.Query,
+		TestHeaders:        o.TestHeaders,
+		ScanScripts:        o.ScanScripts,
+		Dig:                o.Dig,
+		WebSockets:         o.WebSockets,
+		Methods:            o.Methods,
+		SecondPass:         o.SecondPass,
+		Cluster:            o.Cluster,
+		Probes:             o.Probes,
+		State:              o.State,
+		Resume:             o.Resume,
+		LoginURL:           o.LoginURL,
+		LoginData:          o.LoginData,
+		MineParams:         o.MineParams,
+		DiscoverParams:     o.DiscoverParams,
+	}
+	if o.Mutations != "" {
+		mutations, err := reflector.LoadMutations(o.Mutations)
+		if err != nil {
+			return opts, err
+		}
+		opts.Mutations = mutations
+	}
+	return opts, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// encrypted output starts with this line followed by the key derivation salt,
+// then one length prefixed nonce+ciphertext record per write
+const encryptMagic = "go-reflect-aes256gcm-v1\n"
+
+const (
+	saltSize      = 16
+	kdfIterations = 200000
+)
+
+// readKeyFile loads a passphrase or key file, trailing newlines are ignored
+// so `echo secret > key` and a random binary key both work
+func readKeyFile(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key = bytes.TrimRight(key, "\r\n")
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// deriveKey stretches the passphrase into an AES-256 key with PBKDF2-HMAC-SHA256
+func deriveKey(passphrase, salt []byte) []byte {
+	return pbkdf2.Key(passphrase, salt, kdfIterations, 32, sha256.New)
+}
+
+func newGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(passphrase, salt))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWriter encrypts each write as its own record, so a run that is cut short
+// still leaves every result written so far readable
+type sealWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+}
+
+func newSealWriter(w io.Writer, passphrase []byte) (*sealWriter, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(w, encryptMagic); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(salt); err != nil {
+		return nil, err
+	}
+	return &sealWriter{w: w, aead: aead}, nil
+}
+
+func (s *sealWriter) Write(p []byte) (int, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return 0, err
+	}
+	record := s.aead.Seal(nonce, nonce, p, nil)
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(record)))
+	if _, err := s.w.Write(size[:]); err != nil {
+		return 0, err
+	}
+	if _, err := s.w.Write(record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// decryptStream reverses sealWriter, writing the plaintext of every record in r to w
+func decryptStream(w io.Writer, r io.Reader, passphrase []byte) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(encryptMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != encryptMagic {
+		return errors.New("input is not encrypted go-reflect output")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(br, salt); err != nil {
+		return err
+	}
+	aead, err := newGCM(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	var size [4]byte
+	for {
+		if _, err := io.ReadFull(br, size[:]); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		record := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(br, record); err != nil {
+			return err
+		}
+		if len(record) < aead.NonceSize() {
+			return errors.New("truncated record")
+		}
+		nonce, ciphertext := record[:aead.NonceSize()], record[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return errors.New("wrong key or corrupted input")
+		}
+		if _, err := w.Write(plaintext); err != nil {
+			return err
+		}
+	}
+}
+
+// sealedDatabase keeps a database file encrypted at rest. While the run
+// lasts it is decrypted to a private hidden directory next to it, and when
+// closed it is sealed back into place like any other output, so it can
+// also be read with -decrypt
+type sealedDatabase struct {
+	path string
+	key  []byte
+	dir  string
+	// the plaintext copy the database is opened from
+	tmp string
+}
+
+// openSealedDatabase decrypts the database at path, a new one if there is
+// none yet
+func openSealedDatabase(path string, key []byte) (*sealedDatabase, error) {
+	// next to the database rather than in a shared /tmp, and only ours to read
+	dir, err := ioutil.TempDir(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return nil, err
+	}
+	d := &sealedDatabase{path: path, key: key, dir: dir, tmp: filepath.Join(dir, filepath.Base(path))}
+	in, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return d, nil
+	} else if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(d.tmp, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err == nil {
+		err = decryptStream(out, in, key)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return d, nil
+}
+
+// close seals the plaintext copy into place and removes it, the database
+// must be closed first
+func (d *sealedDatabase) close() error {
+	defer os.RemoveAll(d.dir)
+	in, err := os.Open(d.tmp)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := createAtomic(d.path)
+	if err != nil {
+		return err
+	}
+	w, err := newSealWriter(out, d.key)
+	if err == nil {
+		_, err = io.Copy(w, in)
+	}
+	if err != nil {
+		out.abort()
+		return err
+	}
+	return out.Close()
+}
+
+// writeSealed writes data to path like ioutil.WriteFile, sealed with key
+// if it isn't nil
+func writeSealed(path string, data, key []byte) error {
+	if key == nil {
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	out, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	w, err := newSealWriter(out, key)
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err != nil {
+		out.abort()
+		return err
+	}
+	return out.Close()
+}
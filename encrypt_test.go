@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealRoundTrip(t *testing.T) {
+	key := []byte("correct horse battery staple")
+	tests := []struct {
+		name   string
+		writes []string
+		// applied to the sealed stream before decrypting it
+		tamper func([]byte) []byte
+		key    []byte
+		fails  bool
+	}{
+		{name: "nothing written", writes: nil},
+		{name: "one record", writes: []string{"https://example.com/?q=rflk8f2a9x0m3p_q\n"}},
+		{name: "many records", writes: []string{"a\n", "", "b\nc\n", string(bytes.Repeat([]byte{0, 0xff}, 1<<15))}},
+		{name: "wrong key", writes: []string{"secret\n"}, key: []byte("wrong"), fails: true},
+		{
+			name:   "flipped ciphertext byte",
+			writes: []string{"secret\n"},
+			tamper: func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+			fails:  true,
+		},
+		{
+			name:   "cut short",
+			writes: []string{"secret\n"},
+			tamper: func(b []byte) []byte { return b[:len(b)-3] },
+			fails:  true,
+		},
+		{
+			name:   "not sealed",
+			tamper: func([]byte) []byte { return []byte("plain text\n") },
+			fails:  true,
+		},
+	}
+	for _, test := range tests {
+		var sealed bytes.Buffer
+		w, err := newSealWriter(&sealed, key)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		var want bytes.Buffer
+		for _, write := range test.writes {
+			if n, err := w.Write([]byte(write)); err != nil || n != len(write) {
+				t.Fatalf("%s: wrote %d of %d bytes: %v", test.name, n, len(write), err)
+			}
+			want.WriteString(write)
+		}
+		stream := sealed.Bytes()
+		for _, write := range test.writes {
+			// short ones may turn up by chance
+			if len(write) >= 8 && bytes.Contains(stream, []byte(write)) {
+				t.Errorf("%s: plaintext in the sealed stream", test.name)
+			}
+		}
+		if test.tamper != nil {
+			stream = test.tamper(stream)
+		}
+		decryptKey := key
+		if test.key != nil {
+			decryptKey = test.key
+		}
+
+		var got bytes.Buffer
+		err = decryptStream(&got, bytes.NewReader(stream), decryptKey)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: decryptStream returned %v", test.name, err)
+		}
+		if !test.fails && !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s: decrypted %d bytes, want %d", test.name, got.Len(), want.Len())
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+)
+
+// fuzzTargets writes a URL per parameter of every crawled URL and GET form,
+// with that parameter's value replaced by a marker, e.g.
+// https://example.com/search?q=FUZZ&sort=asc, ready for nuclei's fuzzing
+// templates or ffuf. Each endpoint and parameter is written once
+type fuzzTargets struct {
+	file   *os.File
+	w      *bufio.Writer
+	marker string
+	seen   map[string]bool
+}
+
+func newFuzzTargets(path, marker string) (*fuzzTargets, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fuzzTargets{file: file, w: bufio.NewWriter(file), marker: marker, seen: make(map[string]bool)}, nil
+}
+
+// add writes the fuzzing targets of a discovered URL or form, URLs without
+// parameters, POST forms and findings, whose URLs carry canaries, have none
+func (t *fuzzTargets) add(res reflector.Result) error {
+	u, err := url.Parse(res.URL)
+	if err != nil || res.URL == "" || res.Finding() {
+		return nil
+	}
+	var names []string
+	values := make(map[string]string)
+	if res.Source == "form" {
+		if res.Method != "GET" {
+			return nil
+		}
+		for _, in := range res.Inputs {
+			if in.Type == "submit" {
+				continue
+			}
+			if _, ok := values[in.Name]; !ok {
+				names = append(names, in.Name)
+			}
+			values[in.Name] = in.Value
+		}
+	} else {
+		for name, v := range u.Query() {
+			names = append(names, name)
+			values[name] = v[0]
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	u.RawQuery, u.Fragment = "", ""
+	endpoint := u.String() + "?" + strings.Join(names, "&")
+
+	for _, fuzzed := range names {
+		if t.seen[endpoint+" "+fuzzed] {
+			continue
+		}
+		t.seen[endpoint+" "+fuzzed] = true
+		// the marker goes in unescaped, {{canary}} would be no use as %7B%7Bcanary%7D%7D
+		query := make([]string, len(names))
+		for i, name := range names {
+			value := url.QueryEscape(values[name])
+			if name == fuzzed {
+				value = t.marker
+			}
+			query[i] = url.QueryEscape(name) + "=" + value
+		}
+		if _, err := t.w.WriteString(redaction.redact(u.String()+"?"+strings.Join(query, "&")) + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *fuzzTargets) close() error {
+	if err := t.w.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
@@ -4,77 +4,187 @@ package main
 
 import (
 	"bufio"
-	"crypto/tls"
-	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
-	"math/rand"
-	"net/http"
-	"net/url"
 	"os"
-	"regexp"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gocolly/colly/v2"
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+	"github.com/garlic0x1/go-reflect/pkg/schema"
 )
 
-type injection struct {
-	Hash         string
-	FormLocation string
-}
-
-type input struct {
-	Type  string
-	Name  string
-	Value string
-}
-
-type form struct {
-	URL    string
-	Method string
-	Inputs []input
-}
-
 var (
-	// Thread safe map
-	sm      sync.Map
-	headers map[string]string
-	// record all the form inputs performed se we know where each found hash comes from
-	injectionMap []injection
-	// seed rand for randomString()
-	seededRand *rand.Rand = rand.New(
-		rand.NewSource(time.Now().UnixNano()))
+	// scrubs secrets from results, logs and the summary, nil with -no-redact
+	redaction *redactor
 )
 
 func main() {
 	threads := flag.Int("t", 8, "Number of threads to utilise.")
+	adaptive := flag.Bool("adaptive", false, "Scale threads per host up and down from observed latency and errors, starting at -t.")
+	maxThreads := flag.Int("max-threads", 64, "Upper bound on threads per host with -adaptive.")
+	targetConcurrency := flag.Int("target-concurrency", 1, "Number of targets to crawl at once, each taking the next line from stdin as soon as it is done, so one slow target doesn't hold up the rest. Requests in flight per host stay within -t across all of them.")
 	depth := flag.Int("d", 2, "Depth to crawl.")
 	insecure := flag.Bool("insecure", false, "Disable TLS verification.")
+	noTLSResume := flag.Bool("no-tls-resume", false, "Do a full TLS handshake for every connection instead of resuming the host's last session, for servers that mishandle resumption.")
 	subsInScope := flag.Bool("subs", false, "Include subdomains for crawling.")
+	scopePath := flag.String("scope", "", "File of include and exclude rules, one per line, checked against every URL before it is visited or reported. A pattern is a host glob (*.example.com), a path glob (/logout*), a URL glob (https://*/static/*) or a regular expression over the URL (re:\\.png$). Include rules replace the target's host and -subs.")
 	showSource := flag.Bool("s", false, "Show the source of URL based on where it was found (href, form, script, etc.)")
-	rawHeaders := flag.String(("h"), "", "Custom headers separated by two semi-colons. E.g. -h \"Cookie: foo=bar;;Referer: http://example.com/\" ")
+	rawHeaders := flag.String(("h"), "", "Custom headers separated by two semi-colons, values may use {{env:NAME}} and {{cmd:command}} placeholders, and {{uuid}}, {{timestamp}} and {{random}}, filled in anew for every request. E.g. -h \"Cookie: foo=bar;;Authorization: Bearer {{env:TOKEN}}\" ")
+	var headerScopes repeatedFlags
+	flag.Var(&headerScopes, "header-scope", "Only send a custom header to the URLs matching a pattern, as \"Name: pattern\" with patterns as in -scope, may be repeated to allow more. E.g. -header-scope \"Authorization: api.example.com\". A Cookie rule holds back the cookies of -h only. Headers without rules are sent everywhere.")
+	loginURL := flag.String("login-url", "", "Log in at this page before crawling by submitting its login form with -login-data, hidden inputs such as CSRF tokens included. The session's cookies are shared by the crawl and every probe, links that look like logouts aren't followed, and the crawl logs in again after a 401 or a redirect back to this page.")
+	loginData := flag.String("login-data", "", "Query string to fill in the -login-url form with, values may use {{env:NAME}} and {{cmd:command}} placeholders. E.g. -login-data \"user=tester&password={{env:PASSWORD}}\"")
 	//payloads := flag.String(("w"), "./payloads", "Template wordlist for param fuzzing")
-	proxy := flag.String(("proxy"), "", "Proxy URL, example: -proxy http://127.0.0.1:8080")
+	proxy := flag.String(("proxy"), "", "Proxy URL for all crawl, probe and browser traffic: http://, https:// or socks5://, example: -proxy http://127.0.0.1:8080")
 	unique := flag.Bool(("u"), false, "Show only unique urls")
+	uniqueKeys := flag.Int("unique-keys", reflector.DefaultSeenKeys, "Number of lines -u remembers in a memory store before forgetting the ones seen least recently.")
+	timeout := flag.Duration("timeout", 10*time.Second, "How long each attempt at a request may take, reading the response included.")
+	retries := flag.Int("retries", 0, "Times to retry a request after a connection reset, a timeout or a 429, 502, 503 or 504 response, backing off exponentially and honoring Retry-After.")
+	crawlRate := flag.Float64("crawl-rate", 0, "Maximum crawl requests per second, 0 for no limit.")
+	probeRate := flag.Float64("probe-rate", 0, "Maximum form probe requests per second, 0 for no limit.")
+	identities := flag.String("identities", "", "File of identities to rotate probes across, one per line as proxy;;user-agent;;cookies")
+	rotate := flag.Int("rotate", 10, "Number of probes to send with each identity before rotating.")
+	paramsOnly := flag.Bool("params-only", false, "Only show URLs with query parameters and forms, the crawl still follows every link.")
+	annotateRobots := flag.Bool("robots", false, "Annotate results that are disallowed by robots.txt or marked noindex/nofollow.")
+	recordMeta := flag.Bool("meta", false, "Record HTTP version, server banner and TLS details (version, ALPN, certificate subject and SANs) per target in the summary.")
+	timings := flag.Bool("timings", false, "Record DNS, connect, TLS, time to first byte and total timings of every request, and print them per host in the summary to tell whether a slow scan is network, target or tool bound.")
+	respectRobots := flag.Bool("respect-robots", false, "Honor robots.txt: don't request disallowed paths, nor crawl its Disallow entries as hints.")
+	noDiscover := flag.Bool("no-discover", false, "Don't crawl the paths listed in robots.txt, the URLs in sitemap.xml and sitemap indexes, the endpoints OpenAPI and Swagger specs document, the routes in the build files of Next.js and Nuxt sites, and the URLs web app manifests and service workers declare.")
+	noUpgrade := flag.Bool("no-upgrade", false, "Don't switch http targets to https when https is available.")
+	batch := flag.Int("batch", 0, "Maximum parameters to inject per form probe, 0 puts them all in one request. Batches rejected with an error status are retried one parameter at a time.")
+	signalsPath := flag.String("signals", "", "Results of other scanners to concentrate on, nuclei JSON output or plain URLs: their endpoints are crawled and probed first, and results on them are annotated with signals=<template-id>.")
+	prefillPath := flag.String("prefill", "", "YAML file mapping field name patterns to the values to submit for them instead of a hash, e.g. \"email: tester@example.com\", so forms that validate those fields go through.")
+	userAgents := flag.String("ua-list", "", "File of user agents, one per line, to rotate through request by request. A User-Agent set with -h wins.")
+	resolveEachRequest := flag.Bool("resolve-each-request", false, "Resolve {{env:...}} and {{cmd:...}} placeholders in headers for every request instead of once at startup.")
+	heatMap := flag.String("heatmap", "", "Summarize each target's reflections by the path of the page they were found on, ids collapsed into {id}: tree for a tree of path prefixes with the reflections under each, table for a table of the paths reflecting most.")
+	strategy := flag.String("strategy", "", "Crawl order: bfs, dfs or priority (parameters and forms first). Default is colly's own order.")
+	previewPages := flag.Int("preview", 0, "Crawl only the first N pages of each target without sending any probes, and print the endpoints, parameters and forms a full scan would cover, with an estimate of its probes, to stderr.")
+	maxRuntime := flag.Duration("max-runtime", 0, "Maximum time for the whole run, e.g. 2h, shared fairly: each target gets the time left divided by the targets still waiting. The target list is read in full before crawling starts. 0 for no limit.")
+	maxURLs := flag.Int("max-urls", 0, "Maximum pages to crawl per target, probes aside, e.g. 10000. Without -d, the crawl goes as deep as it takes to reach them. 0 for no limit.")
+	maxTime := flag.Duration("max-time", 0, "Maximum time to spend on each target, e.g. 30m. Without -d, the crawl goes as deep as it can in that time. 0 for no limit.")
+	maxBodySize := flag.Int64("max-body-size", 0, "Don't download crawled pages bigger than this many kilobytes, e.g. 2048, going by their Content-Length. Those that don't give one are cut off there. Their URLs are still reported. 0 for no limit.")
+	contentTypes := flag.String("content-types", "", "Comma separated content types to download and parse crawled pages of, e.g. html,javascript,json or text/*. A word matches the subtypes containing it. Pages of other types are still reported but not downloaded. Default is all types.")
+	depthTime := flag.Duration("depth-time", 0, "Maximum time to spend crawling each depth level before only going deeper, e.g. 5m. 0 for no limit.")
+	var secretPatterns repeatedFlags
+	flag.Var(&secretPatterns, "redact", "Regular expression of extra secrets to redact from output, may be repeated. Authorization and cookie header values, API keys and access tokens in URLs, bearer tokens and JWTs are always redacted.")
+	noRedact := flag.Bool("no-redact", false, "Don't redact secrets from output.")
+	encryptKey := flag.String("encrypt", "", "Encrypt results at rest with AES-256-GCM, using a passphrase or key read from this file, along with -o, -od, -low-confidence-file, -manifest and -param-wordlist files. -sqlite and -store databases are decrypted to a private hidden directory next to them for the run and sealed again when it ends or is interrupted. -state files can't be encrypted, use -store to checkpoint instead.")
+	verifyBrowser := flag.Bool("verify-browser", false, "Load XSS and DOM sink reflections in headless Chrome with a harmless marker element and mark the ones that render as browser-verified.")
+	render := flag.Bool("render", false, "Render crawled pages in headless Chrome before extracting links and forms, for sites built client-side with React, Vue and the like.")
+	screenshotDiff := flag.Bool("screenshot-diff", false, "With -render, render the responses of probes whose hashes don't come back in the HTML, screenshot them as sent and with filler in place of the hashes, and report hashes that visibly change the page as reflections with a visual= region.")
+	var dismissSelectors repeatedFlags
+	flag.Var(&dismissSelectors, "dismiss", "CSS selector of a cookie consent or age gate button to click before extracting a page with -render, may be repeated. Common consent platforms and age gates are dismissed already.")
+	browserPath := flag.String("browser", "", "Path to the Chrome or Chromium binary, searched for in $PATH by default.")
+	emitTypes := flag.String("emit", "", "Comma separated result types to output, e.g. href,form,reflector. Types are href, script, form, link, img, srcset, iframe, meta-refresh, object, area, style, data-attr, websocket, robots, sitemap, openapi, route, alternate, feed, reflector, cross-page, stored, js-sink, comment, meta, mixed-content, cookie, csrf-candidate, cors, methods, clickjacking and hidden-param. Default is all of them.")
+	testQuery := flag.Bool("query", false, "Also test the query parameters of every crawled URL for reflection, one parameter per probe.")
+	discoverParams := flag.Bool("discover-params", false, "Also guess the parameters every crawled endpoint takes without linking to them, trying common names and the ones seen in the crawl's traffic in batches and narrowing down the batches that change the response, report them as hidden-param and probe them for reflection like -query.")
+	testHeaders := flag.Bool("test-headers", false, "Also request every crawled page with canaries in User-Agent, Referer, X-Forwarded-For, X-Forwarded-Host, Origin and its cookies, and report the ones that reflect.")
+	webSockets := flag.Bool("ws", false, "Also read the site's own script files for WebSocket endpoints, send every endpoint found messages with canaries and report the ones echoed back, and run the websocket probe family.")
+	dig := flag.Bool("dig", false, "Also read HTML comments and meta tags for URLs, internal hostnames, emails and credentials, report them as comment and meta results, and crawl the URLs.")
+	scanScripts := flag.Bool("js-sinks", false, "Also scan inline scripts and the site's own script files for DOM XSS sinks (innerHTML, document.write, eval and the like) and sources (location.hash, postMessage handlers and the like), and report them per script.")
+	methods := flag.String("methods", "", "Comma separated HTTP methods to try on every endpoint crawled and every form action, e.g. OPTIONS,PUT,PATCH,DELETE, and report the ones accepted. OPTIONS reports the Allow header. Methods like DELETE may change data, only list them where that is authorized.")
+	secondPass := flag.Bool("second-pass", false, "Once a target's probes are done, request every page crawled again and report canaries found there as stored.")
+	cluster := flag.Bool("cluster", false, "Send per-page probes to only the first page of each template, so a site serving the same pages in many locales is probed once per template. Findings always carry their page's cluster= and lang= fields.")
+	mutationsPath := flag.String("mutations", "", "YAML file of rewrites of the second-stage payloads of confirmed and likely reflections to send as well, e.g. \"- {name: shuffled, case: shuffle}\", with case, replace, comment (in place of spaces) and chunk (chunked POST bodies). Which came back is recorded in mutations= and failed-mutations=.")
+	probeFamilies := flag.String("probes", "", "Comma separated probe families to run: query (GET forms and -query), body (POST forms), headers, cookies, path (a hash appended to each page's path), fragment (a hash in each page's fragment, checked in headless Chrome) and websocket (a hash in each query parameter of the WebSocket URLs pages point to). Prefix a family with - to drop it from the default instead, e.g. -probes -body. Default is query,body, plus headers,cookies with -test-headers and websocket with -ws.")
+	grpcTarget := flag.String("grpc", "", "Also stream results to a gRPC Findings service (see pkg/schema/findings.proto), http://host:port for cleartext or https://host:port for TLS.")
+	publishDest := flag.String("publish", "", "Also publish every finding as a JSON object to a message bus: nats://[token@]host:port/subject or kafka://[user:password@]broker:port/topic, nats+tls:// or kafka+tls:// for TLS.")
+	outputFile := flag.String("o", "", "Also write results to this file.")
+	minConfidence := flag.String("min-confidence", "", "Only output reflections at least this sure: tentative, likely, confirmed or browser-verified. URLs and other findings are always output.")
+	lowConfidenceFile := flag.String("low-confidence-file", "", "Write the reflections -min-confidence holds back to this file instead, for a manual look.")
+	outputDir := flag.String("od", "", "Also write results to one file per host in this directory, e.g. dir/www.example.com.txt.")
+	sarifPath := flag.String("sarif", "", "Also write the findings to this file as a SARIF 2.1.0 log, for GitHub code scanning and vulnerability management tools, each with its URL, params, method, confidence and context and the request that reproduces it.")
+	burpPath := flag.String("burp", "", "Also write the request behind each confirmed reflection to this file as Burp Suite XML items, base64 encoded with the custom headers, to import into Burp or ZAP and replay. They are never redacted, so the file holds the session's cookies and tokens.")
+	nucleiTargets := flag.String("nuclei-targets", "", "Also write a URL per parameter of every crawled URL and GET form to this file, with that parameter set to -fuzz-marker and the others kept, for nuclei's fuzzing templates or ffuf.")
+	fuzzMarker := flag.String("fuzz-marker", "FUZZ", "What -nuclei-targets puts in the parameter to fuzz, e.g. FUZZ for ffuf or {{canary}} for a nuclei template.")
+	sqlitePath := flag.String("sqlite", "", "Also store URLs, forms and findings in tables of this SQLite database, created if it doesn't exist.")
+	jsonOutput := flag.Bool("json", false, "Write each URL, form and finding as a JSON object per line instead of text.")
+	outputBuffer := flag.Int("output-buffer", 0, "Number of results to buffer when stdout is slow before crawling pauses, 0 for the number of threads.")
+	profileName := flag.String("profile-name", "", "Load a saved profile of flags for a repeat engagement, flags given on the command line or as REFLECTOR_* environment variables take precedence.")
+	profilesDir := flag.String("profiles-dir", "", "Directory of profiles for -profile-name, one file per profile with a name=value flag per line. Default is go-reflect/profiles in the user config directory, e.g. ~/.config/go-reflect/profiles")
+	paramWordlist := flag.String("param-wordlist", "", "Write every parameter name seen in the crawl's traffic (query strings, form fields, JS variable declarations and JSON keys) to this file, one per line, deduplicated and sorted, for parameter brute-forcing.")
+	manifestPath := flag.String("manifest", "", "Write a JSON manifest of the run (configuration, version, start/end time, targets and outputs) to this file.")
+	uploadDest := flag.String("upload", "", "Upload the results (and -manifest) to s3://bucket/prefix or gs://bucket/prefix at the end of the run, under a directory named after the start time. Credentials are read from the standard AWS_* variables or GOOGLE_OAUTH_ACCESS_TOKEN.")
+	storeSpec := flag.String("store", "", "Keep findings, -u keys and crawl checkpoints in memory, sqlite:path or bolt:path. With a database, -u and -diff carry over from earlier runs and -resume works without -state.")
+	noAliasDedupe := flag.Bool("no-alias-dedupe", false, "Count a finding reached through http and https, or www.example.com and example.com, once per alias instead of once.")
+	diff := flag.Bool("diff", false, "Only output findings the -store doesn't hold from an earlier run, and report how many earlier ones weren't found again.")
+	statePath := flag.String("state", "", "Checkpoint visited URLs, pending links and probed forms to this JSON file every 30 seconds and after each target.")
+	resume := flag.Bool("resume", false, "Continue an interrupted crawl from the -state file, skipping finished targets, pages already fetched and forms already probed.")
+	decryptKey := flag.String("decrypt", "", "Decrypt encrypted results from stdin with the key in this file and exit.")
 
 	flag.Parse()
+	start := time.Now()
+
+	// flag > REFLECTOR_* environment variable > profile
+	if err := loadEnv(os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading environment:", err)
+		os.Exit(1)
+	}
+	if *profileName != "" {
+		if err := loadProfile(*profilesDir, *profileName); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading profile:", err)
+			os.Exit(1)
+		}
+	}
+
+	mergeAliases = !*noAliasDedupe
+
+	// a URL or time budget replaces the default depth unless -d is given too
+	if *maxURLs > 0 || *maxTime > 0 {
+		depthSet := false
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "d" {
+				depthSet = true
+			}
+		})
+		if !depthSet {
+			*depth = 0
+		}
+	}
+
+	if *decryptKey != "" {
+		key, err := readKeyFile(*decryptKey)
+		if err == nil {
+			w := bufio.NewWriter(os.Stdout)
+			err = decryptStream(w, os.Stdin, key)
+			w.Flush()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error decrypting:", err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	if *proxy != "" {
 		os.Setenv("PROXY", *proxy)
 		*insecure = true
 	}
-	proxyURL, _ := url.Parse(os.Getenv("PROXY"))
 
 	// Convert the headers input to a usable map (or die trying)
-	err := parseHeaders(*rawHeaders)
+	headers, err := reflector.ParseHeaders(*rawHeaders)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Error parsing headers:", err)
 		os.Exit(1)
 	}
+	headerScope, err := reflector.ParseHeaderScope(headerScopes)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error parsing headers:", err)
+		os.Exit(1)
+	}
+	var mutations []reflector.Mutation
+	if *mutationsPath != "" {
+		mutations, err = reflector.LoadMutations(*mutationsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading mutations:", err)
+			os.Exit(1)
+		}
+	}
 
 	// Check for stdin input
 	stat, _ := os.Stdin.Stat()
@@ -83,174 +193,576 @@ func main() {
 		os.Exit(1)
 	}
 
-	results := make(chan string, *threads)
-	go func() {
-		// get each line of stdin, push it to the work channel
-		s := bufio.NewScanner(os.Stdin)
-		for s.Scan() {
-			url := s.Text()
-			hostname, err := extractHostname(url)
-			if err != nil {
-				//log.Println("Error parsing URL:", err)
-				return
-			}
-
-			allowed_domains := []string{hostname}
-			// if "Host" header is set, append it to allowed domains
-			if headers != nil {
-				if val, ok := headers["Host"]; ok {
-					allowed_domains = append(allowed_domains, val)
-				}
-			}
+	opts := reflector.Options{
+		Threads:            *threads,
+		Adaptive:           *adaptive,
+		MaxThreads:         *maxThreads,
+		TargetConcurrency:  *targetConcurrency,
+		TargetEnds:         *outputDir != "",
+		Depth:              *depth,
+		Insecure:           *insecure,
+		NoTLSResume:        *noTLSResume,
+		Subdomains:         *subsInScope,
+		Scope:              *scopePath,
+		Headers:            headers,
+		HeaderScope:        headerScope,
+		ResolveEachRequest: *resolveEachRequest,
+		UserAgents:         *userAgents,
+		Timeout:            *timeout,
+		Retries:            *retries,
+		CrawlRate:          *crawlRate,
+		ProbeRate:          *probeRate,
+		Identities:         *identities,
+		Rotate:             *rotate,
+		ParamsOnly:         *paramsOnly,
+		Robots:             *annotateRobots,
+		Meta:               *recordMeta,
+		Timings:            *timings,
+		RespectRobots:      *respectRobots,
+		NoDiscover:         *noDiscover,
+		NoUpgrade:          *noUpgrade,
+		Batch:              *batch,
+		Prefill:            *prefillPath,
+		Signals:            *signalsPath,
+		Strategy:           *strategy,
+		HeatMap:            *heatMap,
+		DepthTime:          *depthTime,
+		MaxRuntime:         *maxRuntime,
+		MaxURLs:            *maxURLs,
+		MaxTime:            *maxTime,
+		MaxBodySize:        *maxBodySize << 10,
+		ContentTypes:       splitList(*contentTypes),
+		Preview:            *previewPages,
+		VerifyBrowser:      *verifyBrowser,
+		Render:             *render,
+		ScreenshotDiff:     *screenshotDiff,
+		Dismiss:            dismissSelectors,
+		Browser:            *browserPath,
+		Query:              *testQuery,
+		TestHeaders:        *testHeaders,
+		DiscoverParams:     *discoverParams,
+		Probes:             splitList(*probeFamilies),
+		Mutations:          mutations,
+		ScanScripts:        *scanScripts,
+		Dig:                *dig,
+		WebSockets:         *webSockets,
+		Methods:            splitList(*methods),
+		SecondPass:         *secondPass,
+		Cluster:            *cluster,
+		State:              *statePath,
+		Resume:             *resume,
+		LoginURL:           *loginURL,
+		LoginData:          *loginData,
+		MineParams:         *paramWordlist != "",
+	}
+	var key []byte
+	if *encryptKey != "" {
+		key, err = readKeyFile(*encryptKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error setting up encryption:", err)
+			os.Exit(1)
+		}
+		// it holds form headers and anti-CSRF tokens, an encrypted store keeps checkpoints instead
+		if *statePath != "" {
+			fmt.Fprintln(os.Stderr, "Error: -state files can't be encrypted, use -store sqlite:path or bolt:path with -encrypt")
+			os.Exit(1)
+		}
+	}
 
-			// Instantiate default collector
-			c := colly.NewCollector(
-				// default user agent header
-				colly.UserAgent("Mozilla/5.0 (X11; Linux x86_64; rv:78.0) Gecko/20100101 Firefox/78.0"),
-				// set custom headers
-				colly.Headers(headers),
-				// limit crawling to the domain of the specified URL
-				colly.AllowedDomains(allowed_domains...),
-				// allow revisiting to find stored hashes
-				colly.AllowURLRevisit(),
-				// set MaxDepth to the specified depth
-				colly.MaxDepth(*depth),
-				// specify Async for threading
-				colly.Async(true),
-			)
-
-			// if -subs is present, use regex to filter out subdomains in scope.
-			if *subsInScope {
-				c.AllowedDomains = nil
-				c.URLFilters = []*regexp.Regexp{regexp.MustCompile(".*(\\.|\\/\\/)" + strings.ReplaceAll(hostname, ".", "\\.") + "((#|\\/|\\?).*)?")}
+	// findings and -u keys always go to a store, a database one also keeps
+	// checkpoints, and with -encrypt is sealed at rest like the rest
+	store := reflector.NewBoundedMemoryStore(*uniqueKeys)
+	if *storeSpec != "" {
+		if key != nil && *sqlitePath != "" && *storeSpec == "sqlite:"+*sqlitePath {
+			fmt.Fprintln(os.Stderr, "Error: an encrypted store can't share its database with -sqlite")
+			os.Exit(1)
+		}
+		store, err = openStore(*storeSpec, *uniqueKeys, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening store:", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := store.Close(); err != nil {
+				fmt.Fprintln(os.Stderr, "Error closing store:", err)
 			}
+		}()
+		opts.Store = store
+	}
+	// findings kept from earlier runs are only saved again if they change, and with -diff only they are written
+	previous := make(map[string]bool)
+	if kept, err := store.LoadFindings(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error reading store:", err)
+		os.Exit(1)
+	} else {
+		for _, finding := range kept {
+			previous[findingKey(finding)] = true
+		}
+	}
+	if *proxy != "" {
+		opts.Proxy = os.Getenv("PROXY")
+	}
+	crawler, err := reflector.New(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
 
-			// Set parallelism
-			c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: *threads})
+	// everything written from here on goes through the redactor
+	if !*noRedact {
+		redaction, err = newRedactor(secretPatterns, crawler.Headers(), append(crawler.IdentityCookies(), crawler.LoginSecrets()...))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error parsing redact pattern:", err)
+			os.Exit(1)
+		}
+	}
+	stderr := redaction.writer(os.Stderr)
+	crawler.SetLog(stderr)
 
-			c.OnResponse(func(r *colly.Response) {
-				for i := 0; i < len(injectionMap); i++ {
-					if strings.Contains(string(r.Body), injectionMap[i].Hash) {
-						// build response
-						response := fmt.Sprintf("Injection from %s found at %s", injectionMap[i].FormLocation, r.Request.URL)
-						printReflection(response, "reflector", *showSource, results)
-					}
-				}
-			})
+	var run *manifest
+	if *manifestPath != "" {
+		run = newManifest(start)
+	}
 
-			// Print every href found, and visit it
-			c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-				link := e.Attr("href")
-				/*
-					if strings.Contains(link, "?") {
-						for _, s := range fuzzParameter(link, *payloads) {
-							e.Request.Visit(s)
-						}
-					}
-				*/
-				printResult(link, "href", *showSource, results, e)
-				e.Request.Visit(link)
-			})
+	// with -upload, what is written to stdout is also spooled for the bucket
+	var up *uploader
+	var spool *os.File
+	stdouts := []io.Writer{os.Stdout}
+	if *uploadDest != "" {
+		up, err = newUploader(*uploadDest)
+		if err == nil {
+			spool, err = ioutil.TempFile("", "go-reflect-results-")
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer os.Remove(spool.Name())
+		stdouts = append(stdouts, spool)
+	}
+	// and with -o, copied to a file
+	if *outputFile != "" {
+		file, err := os.Create(*outputFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		stdouts = append(stdouts, file)
+		if run != nil {
+			run.Outputs["file"] = *outputFile
+		}
+	}
 
-			// find and print all the JavaScript files
-			c.OnHTML("script[src]", func(e *colly.HTMLElement) {
-				printResult(e.Attr("src"), "script", *showSource, results, e)
-			})
+	// with -encrypt results are sealed on their way to stdout
+	w := bufio.NewWriter(io.MultiWriter(stdouts...))
+	var out io.Writer = w
+	if key != nil {
+		out, err = newSealWriter(w, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error setting up encryption:", err)
+			os.Exit(1)
+		}
+	}
 
-			// find and print all the form action URLs
-			c.OnHTML("form[action]", func(e *colly.HTMLElement) {
-				printResult(e.Attr("action"), "form", *showSource, results, e)
-			})
+	// with -od results are also split into a file per host
+	var hosts *hostFiles
+	if *outputDir != "" {
+		ext := ".txt"
+		if key != nil {
+			ext = ".enc"
+		} else if *jsonOutput {
+			ext = ".jsonl"
+		}
+		hosts, err = newHostFiles(*outputDir, ext, key)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if run != nil {
+			run.Outputs["directory"] = *outputDir
+		}
+	}
 
-			c.OnHTML("form", func(e *colly.HTMLElement) {
-				hash := randomString(8)
-				action := e.Request.AbsoluteURL(e.Attr("action"))
-				method := e.Attr("method")
-
-				var inputs []input
-				e.ForEach("input", func(_ int, e *colly.HTMLElement) {
-					inputs = append(inputs, input{
-						Type:  e.Attr("type"),
-						Name:  e.Attr("name"),
-						Value: e.Attr("value"),
-					})
-				})
-				e.ForEach("textarea", func(_ int, e *colly.HTMLElement) {
-					inputs = append(inputs, input{
-						Type:  "text",
-						Name:  e.Attr("name"),
-						Value: e.Attr("value"),
-					})
-				})
-
-				f := form{
-					URL:    action,
-					Method: method,
-					Inputs: inputs,
-				}
+	// with -min-confidence reflections below it are held back from every
+	// output, and with -low-confidence-file written there instead
+	if *minConfidence != "" && !reflector.ValidConfidence(*minConfidence) {
+		fmt.Fprintln(os.Stderr, "Error: -min-confidence must be tentative, likely, confirmed or browser-verified")
+		os.Exit(1)
+	}
+	var low io.Writer
+	var lowBuffer *bufio.Writer
+	if *lowConfidenceFile != "" {
+		if *minConfidence == "" {
+			fmt.Fprintln(os.Stderr, "Error: -low-confidence-file needs -min-confidence")
+			os.Exit(1)
+		}
+		file, err := os.Create(*lowConfidenceFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		lowBuffer = bufio.NewWriter(file)
+		defer lowBuffer.Flush()
+		low = lowBuffer
+		if key != nil {
+			low, err = newSealWriter(lowBuffer, key)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error setting up encryption:", err)
+				os.Exit(1)
+			}
+		}
+		if run != nil {
+			run.Outputs["low-confidence"] = *lowConfidenceFile
+		}
+	}
 
-				// append to injectionMap
-				injectionMap = append(injectionMap, injection{
-					Hash:         hash,
-					FormLocation: action,
-				})
-
-				// send the form request
-				if method == "POST" || method == "post" {
-					e.Request.PostRaw(action, generateFormData(f, hash))
-				} else if method == "GET" || method == "get" {
-					e.Request.Visit(string(generateFormData(f, hash)))
-				}
+	// with -sqlite they are stored in a database, and with -encrypt it is
+	// sealed once the run is over
+	var db *sqliteSink
+	var sealedDB *sealedDatabase
+	if *sqlitePath != "" {
+		path := *sqlitePath
+		if key != nil {
+			sealedDB, err = openSealedDatabase(path, key)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Error opening database:", err)
+				os.Exit(1)
+			}
+			path = sealedDB.tmp
+		}
+		db, err = newSQLiteSink(path, start)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error opening database:", err)
+			os.Exit(1)
+		}
+		if run != nil {
+			run.Outputs["sqlite"] = *sqlitePath
+		}
+	}
 
-			})
+	// with -sarif and -burp findings are also kept for files written at the
+	// end, Burp's unredacted so its requests replay with the real session
+	var reportFindings, burpFindings []schema.Result
+	if (*sarifPath != "" || *burpPath != "") && key != nil {
+		fmt.Fprintln(os.Stderr, "Error: SARIF logs and Burp items can't be encrypted, use -o or -od with -encrypt")
+		os.Exit(1)
+	}
 
-			// add the custom headers
-			if headers != nil {
-				c.OnRequest(func(r *colly.Request) {
-					for header, value := range headers {
-						r.Headers.Set(header, value)
-					}
-				})
-			}
+	// with -nuclei-targets URLs are also written out ready for fuzzing
+	var fuzzing *fuzzTargets
+	if *nucleiTargets != "" {
+		if key != nil {
+			fmt.Fprintln(os.Stderr, "Error: -nuclei-targets files can't be encrypted, use -o or -od with -encrypt")
+			os.Exit(1)
+		}
+		fuzzing, err = newFuzzTargets(*nucleiTargets, *fuzzMarker)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+		if run != nil {
+			run.Outputs["nuclei-targets"] = *nucleiTargets
+		}
+	}
 
-			if *proxy != "" {
-				// Skip TLS verification if -insecure flag is present
-				c.WithTransport(&http.Transport{
-					Proxy:           http.ProxyURL(proxyURL),
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure},
-				})
-			} else {
-				c.WithTransport(&http.Transport{
-					TLSClientConfig: &tls.Config{InsecureSkipVerify: *insecure},
-				})
-			}
+	// with -grpc results are also streamed to a consumer as protobuf
+	var stream *grpcStream
+	if *grpcTarget != "" {
+		stream, err = newGRPCStream(*grpcTarget, *insecure)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
 
-			// Start scraping
-			c.Visit(url)
-			// Wait until threads are finished
-			c.Wait()
+	// with -publish findings also go to a message bus
+	var bus publisher
+	if *publishDest != "" {
+		bus, err = newPublisher(*publishDest, *insecure)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+			os.Exit(1)
+		}
+	}
 
+	// targets are read as they arrive, a line at a time, so a live pipeline
+	// doesn't have to finish before crawling starts
+	targets := make(chan string, *threads)
+	go func() {
+		s := bufio.NewScanner(os.Stdin)
+		for s.Scan() {
+			targets <- s.Text()
 		}
 		if err := s.Err(); err != nil {
-			fmt.Fprintln(os.Stderr, "reading standard input:", err)
+			fmt.Fprintln(stderr, "reading standard input:", err)
 		}
-		close(results)
+		close(targets)
 	}()
 
+	// bounded, a slow consumer pauses the crawl rather than growing memory
+	if *outputBuffer < 1 {
+		*outputBuffer = *threads
+	}
+	results := make(chan reflector.Result, *outputBuffer)
+	go crawler.Run(targets, results)
+
+	// an interrupt ends the run as if the results ran out, so databases are
+	// sealed and files put in place rather than left behind in plaintext.
+	// A second one kills it
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+
 	// listen to results channel and write to stdout
-	w := bufio.NewWriter(os.Stdout)
 	defer w.Flush()
-	if *unique {
-		for res := range results {
-			if isUnique(res) {
-				fmt.Fprintln(w, res)
+	saving := true
+	saved := make(map[string]bool)
+	// a host file or database that fails stops being written, what was
+	// written so far is still put in place
+	hostsFailed := false
+	dbFailed := false
+	emit := func(res reflector.Result, line string) {
+		fmt.Fprintln(out, redaction.redact(line))
+		if hosts != nil && !hostsFailed {
+			if err := hosts.write(res.URL, redaction.redact(line)); err != nil {
+				fmt.Fprintln(stderr, "Error writing results:", err)
+				hostsFailed = true
+			}
+		}
+		if db != nil && !dbFailed {
+			if err := db.add(redaction.result(res.Schema())); err != nil {
+				fmt.Fprintln(stderr, "Error storing results:", err)
+				dbFailed = true
+			}
+		}
+		if stream != nil {
+			if err := stream.send(redaction.result(res.Schema())); err != nil {
+				fmt.Fprintln(stderr, "Error streaming results:", err)
+				stream = nil
+			}
+		}
+		if saving && res.Finding() {
+			finding := redaction.result(res.Schema())
+			if key := findingKey(finding); !previous[key] && !saved[key] {
+				saved[key] = true
+				if err := store.SaveFindings([]schema.Result{finding}); err != nil {
+					fmt.Fprintln(stderr, "Error storing findings:", err)
+					saving = false
+				}
+			}
+		}
+		if *sarifPath != "" && res.Finding() {
+			reportFindings = append(reportFindings, redaction.result(res.Schema()))
+		}
+		if *burpPath != "" && res.Finding() {
+			burpFindings = append(burpFindings, res.Schema())
+		}
+		if bus != nil && res.Finding() {
+			data, _ := redaction.result(res.Schema()).JSON()
+			if err := bus.publish(data); err != nil {
+				fmt.Fprintln(stderr, "Error publishing findings:", err)
+				bus = nil
+			}
+		}
+		// flush whenever we catch up, so results stream out as they are found
+		if len(results) == 0 {
+			w.Flush()
+			if hosts != nil {
+				hosts.flush()
+			}
+		}
+	}
+	emitted := make(map[string]bool)
+	for _, kind := range splitList(*emitTypes) {
+		emitted[kind] = true
+	}
+	// each finding is kept once, and with -diff only the ones new to the store are written
+	found := make(map[string]bool)
+	fresh := 0
+	keep := func(res reflector.Result) bool {
+		// every URL goes to -nuclei-targets, whatever -emit says
+		if fuzzing != nil {
+			if err := fuzzing.add(res); err != nil {
+				fmt.Fprintln(stderr, "Error writing nuclei targets:", err)
+				fuzzing = nil
 			}
 		}
+		if len(emitted) > 0 && !emitted[res.Source] {
+			return false
+		}
+		if !res.Finding() {
+			return true
+		}
+		key := findingKey(redaction.result(res.Schema()))
+		if found[key] {
+			return !*diff
+		}
+		found[key] = true
+		if previous[key] {
+			return !*diff
+		}
+		fresh++
+		return true
 	}
-	for res := range results {
-		fmt.Fprintln(w, res)
+	format := func(res reflector.Result) string {
+		if *jsonOutput {
+			data, _ := res.MarshalJSON()
+			return string(data)
+		}
+		return res.Line(*showSource)
+	}
+	// one loop for every result, -u just skips the lines the store has seen
+collect:
+	for {
+		var res reflector.Result
+		select {
+		case r, ok := <-results:
+			if !ok {
+				break collect
+			}
+			res = r
+		case sig := <-interrupted:
+			signal.Stop(interrupted)
+			fmt.Fprintln(stderr, "Stopping on", sig)
+			break collect
+		}
+		// every line of a target is out, its host's file can go in place
+		if res.Source == "end" {
+			if hosts != nil && !hostsFailed {
+				if err := hosts.finish(res.URL); err != nil {
+					fmt.Fprintln(stderr, "Error writing results:", err)
+				}
+			}
+			continue
+		}
+		// endpoints other scanners flagged say so
+		if signals := crawler.Signals(res.URL); signals != "" {
+			res.Fields = strings.TrimSpace(res.Fields + " signals=" + signals)
+		}
+		if !keep(res) {
+			continue
+		}
+		line := format(res)
+		if *unique {
+			seen, err := store.Seen("unique " + line)
+			if err != nil {
+				fmt.Fprintln(stderr, "Error reading store:", err)
+			}
+			if seen {
+				continue
+			}
+		}
+		if !res.MeetsConfidence(*minConfidence) {
+			if low != nil {
+				fmt.Fprintln(low, redaction.redact(line))
+				if len(results) == 0 {
+					lowBuffer.Flush()
+				}
+			}
+			continue
+		}
+		emit(res, line)
+	}
+	if *diff {
+		gone := 0
+		for key := range previous {
+			if !found[key] {
+				gone++
+			}
+		}
+		fmt.Fprintf(stderr, "[diff] %d new findings, %d earlier findings not found again\n", fresh, gone)
 	}
 
+	if stream != nil {
+		if err := stream.close(); err != nil {
+			fmt.Fprintln(stderr, "Error streaming results:", err)
+		}
+	}
+	if bus != nil {
+		if err := bus.close(); err != nil {
+			fmt.Fprintln(stderr, "Error publishing findings:", err)
+		}
+	}
+	if fuzzing != nil {
+		if err := fuzzing.close(); err != nil {
+			fmt.Fprintln(stderr, "Error writing nuclei targets:", err)
+		}
+	}
+	if hosts != nil {
+		if err := hosts.close(); err != nil {
+			fmt.Fprintln(stderr, "Error writing results:", err)
+		}
+	}
+	if db != nil {
+		if err := db.close(); err != nil {
+			fmt.Fprintln(stderr, "Error storing results:", err)
+		}
+	}
+	if sealedDB != nil {
+		if err := sealedDB.close(); err != nil {
+			fmt.Fprintln(stderr, "Error encrypting database:", err)
+		}
+	}
+	if *sarifPath != "" {
+		if err := writeSARIF(*sarifPath, reportFindings); err != nil {
+			fmt.Fprintln(stderr, "Error writing SARIF log:", err)
+		} else if run != nil {
+			run.Outputs["sarif"] = *sarifPath
+		}
+	}
+	if *burpPath != "" {
+		if err := writeBurpItems(*burpPath, burpFindings, crawler.HeadersFor); err != nil {
+			fmt.Fprintln(stderr, "Error writing Burp items:", err)
+		} else if run != nil {
+			run.Outputs["burp"] = *burpPath
+		}
+	}
+
+	// summary goes to stderr so it never mixes with results
+	crawler.PrintSummary(stderr)
+	if *paramWordlist != "" {
+		var list []byte
+		for _, name := range crawler.ParamNames() {
+			list = append(list, name+"\n"...)
+		}
+		if err := writeSealed(*paramWordlist, list, key); err != nil {
+			fmt.Fprintln(stderr, "Error writing parameter wordlist:", err)
+		} else if run != nil {
+			run.Outputs["param-wordlist"] = *paramWordlist
+		}
+	}
+	runDir := start.UTC().Format("20060102T150405Z")
+	if run != nil {
+		if up != nil {
+			run.Outputs["upload"] = up.location(runDir)
+		}
+		if err := run.write(*manifestPath, crawler.Targets(), key); err != nil {
+			fmt.Fprintln(stderr, "Error writing manifest:", err)
+		}
+	}
+
+	if up != nil {
+		w.Flush()
+		name, contentType := "results.txt", "text/plain"
+		if *encryptKey != "" {
+			name, contentType = "results.enc", "application/octet-stream"
+		} else if *jsonOutput {
+			name, contentType = "results.jsonl", "application/x-ndjson"
+		}
+		if err := up.put(runDir+"/"+name, spool.Name(), contentType); err != nil {
+			fmt.Fprintln(stderr, "Error:", err)
+		}
+		if run != nil {
+			name, contentType = "manifest.json", "application/json"
+			if key != nil {
+				name, contentType = "manifest.enc", "application/octet-stream"
+			}
+			if err := up.put(runDir+"/"+name, *manifestPath, contentType); err != nil {
+				fmt.Fprintln(stderr, "Error:", err)
+			}
+		}
+	}
 }
 
 // idk about this feature.. probably better left to garlic0x1/url-miner
@@ -317,109 +829,13 @@ func fuzzParameter(u string, payloads string) []string {
 }
 */
 
-// takes a form struct and returns a byte array of form inputs
-// if its a POST form it returns POST data
-// if its a GET form it returns a URL
-func generateFormData(f form, hash string) []byte {
-	formData := url.Values{}
-	for i := 0; i < len(f.Inputs); i++ {
-		if f.Inputs[i].Type == "hidden" {
-			//payload = payload + "&" + f.Inputs[i].Name + "=" + f.Inputs[i].Value
-			formData.Add(f.Inputs[i].Name, f.Inputs[i].Value)
-		} else if f.Inputs[i].Type == "email" {
-			//payload = payload + "&" + f.Inputs[i].Name + "=" + HASH + "@gmail.com"
-			formData.Add(f.Inputs[i].Name, fmt.Sprintf("%s@gmail.com", hash))
-		} else if f.Inputs[i].Type == "text" {
-			//payload = payload + "&" + f.Inputs[i].Name + "=http://" + HASH
-			formData.Add(f.Inputs[i].Name, hash)
-		} else if f.Inputs[i].Type == "password" {
-			//payload = payload + "&" + f.Inputs[i].Name + "=" + hash
-			formData.Add(f.Inputs[i].Name, hash)
-		} else {
-			formData.Add(f.Inputs[i].Name, hash)
-		}
-	}
-	byteData, err := ioutil.ReadAll(strings.NewReader(formData.Encode()))
-	if err != nil {
-		log.Println(err)
-	}
-	if f.Method == "POST" || f.Method == "post" {
-		return byteData
-	}
-	return []byte(f.URL + "?" + string(byteData))
-}
-
-// parseHeaders does validation of headers input and saves it to a formatted map.
-func parseHeaders(rawHeaders string) error {
-	if rawHeaders != "" {
-		if !strings.Contains(rawHeaders, ":") {
-			return errors.New("headers flag not formatted properly (no colon to separate header and value)")
-		}
-
-		headers = make(map[string]string)
-		rawHeaders := strings.Split(rawHeaders, ";;")
-		for _, header := range rawHeaders {
-			var parts []string
-			if strings.Contains(header, ": ") {
-				parts = strings.SplitN(header, ": ", 2)
-			} else if strings.Contains(header, ":") {
-				parts = strings.SplitN(header, ":", 2)
-			} else {
-				continue
-			}
-			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
-		}
-	}
-	return nil
-}
-
-// extractHostname() extracts the hostname from a URL and returns it
-func extractHostname(urlString string) (string, error) {
-	u, err := url.Parse(urlString)
-	if err != nil {
-		return "", err
-	}
-	return u.Hostname(), nil
-}
-
-// print result constructs output lines and sends them to the results chan
-func printResult(link string, sourceName string, showSource bool, results chan string, e *colly.HTMLElement) {
-	result := e.Request.AbsoluteURL(link)
-	if result != "" {
-		if showSource {
-			result = "[" + sourceName + "] " + result
-		}
-		results <- result
-	}
-}
-
-// print result constructs output lines and sends them to the results chan
-func printReflection(link string, sourceName string, showSource bool, results chan string) {
-	result := link
-	if result != "" {
-		if showSource {
-			result = "[" + sourceName + "] " + result
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
 		}
-		results <- result
-	}
-}
-
-// returns whether the supplied url is unique or not
-func isUnique(url string) bool {
-	_, present := sm.Load(url)
-	if present {
-		return false
-	}
-	sm.Store(url, true)
-	return true
-}
-
-// returns a random alphabetical string of provided length
-func randomString(length int) string {
-	charset := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
 	}
-	return string(b)
+	return list
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+	"golang.org/x/net/http2"
+)
+
+// the client streaming method of the Findings service in pkg/schema/findings.proto
+const grpcStreamPath = "/reflector.v1.Findings/Stream"
+
+// grpcStream sends results to a Findings service as one long-lived gRPC call
+type grpcStream struct {
+	body *io.PipeWriter
+	done chan error
+}
+
+// newGRPCStream opens the stream, target is http://host:port for cleartext
+// HTTP/2 or https://host:port for TLS
+func newGRPCStream(target string, insecure bool) (*grpcStream, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	t := &http2.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure}}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		// gRPC without TLS is HTTP/2 with prior knowledge
+		t.AllowHTTP = true
+		t.DialTLS = func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		}
+	default:
+		return nil, fmt.Errorf("gRPC target must be http:// or https://, got %q", target)
+	}
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest("POST", strings.TrimRight(u.String(), "/")+grpcStreamPath, pr)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("TE", "trailers")
+
+	s := &grpcStream{body: pw, done: make(chan error, 1)}
+	go func() {
+		err := grpcCall(t, req)
+		// unblock send once the call is over
+		pr.CloseWithError(fmt.Errorf("gRPC stream closed: %v", err))
+		s.done <- err
+	}()
+	return s, nil
+}
+
+// grpcCall runs the call and returns its status as an error
+func grpcCall(t *http2.Transport, req *http.Request) error {
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gRPC stream: HTTP %s", resp.Status)
+	}
+	// an error before any message comes back in the headers, otherwise the trailers
+	status, message := resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	if status == "" {
+		status, message = resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return fmt.Errorf("gRPC stream: status %s %s", status, message)
+	}
+	return nil
+}
+
+// send writes one result as a length-prefixed message, blocking while
+// the consumer is behind
+func (s *grpcStream) send(res schema.Result) error {
+	msg := res.MarshalProto()
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	_, err := s.body.Write(append(frame, msg...))
+	return err
+}
+
+// close ends the stream and waits for the consumer's status
+func (s *grpcStream) close() error {
+	s.body.Close()
+	return <-s.done
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Kafka API keys and the versions used, the oldest ones current brokers still accept
+const (
+	kafkaProduce                 = 0
+	kafkaProduceVersion          = 3
+	kafkaMetadata                = 3
+	kafkaMetadataVersion         = 4
+	kafkaSaslHandshake           = 17
+	kafkaSaslHandshakeVersion    = 1
+	kafkaSaslAuthenticate        = 36
+	kafkaSaslAuthenticateVersion = 0
+	kafkaClientID                = "go-reflect"
+)
+
+// Kafka error codes a produce can succeed after, once the partition leaders
+// are looked up again
+const (
+	kafkaUnknownTopicOrPartition      = 3
+	kafkaLeaderNotAvailable           = 5
+	kafkaNotLeaderForPartition        = 6
+	kafkaRequestTimedOut              = 7
+	kafkaNetworkException             = 13
+	kafkaNotEnoughReplicas            = 19
+	kafkaNotEnoughReplicasAfterAppend = 20
+)
+
+// a produce is tried this many times more after a leader change or a lost
+// connection, waiting kafkaBackoff longer each time
+const kafkaRetries = 3
+
+var kafkaBackoff = 500 * time.Millisecond
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaError is an error code returned by a broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	return fmt.Sprintf("error code %d", int16(e))
+}
+
+func (e kafkaError) retriable() bool {
+	switch e {
+	case kafkaUnknownTopicOrPartition, kafkaLeaderNotAvailable, kafkaNotLeaderForPartition, kafkaRequestTimedOut,
+		kafkaNetworkException, kafkaNotEnoughReplicas, kafkaNotEnoughReplicasAfterAppend:
+		return true
+	}
+	return false
+}
+
+// kafkaPublisher is a minimal Kafka producer: it produces each message, round
+// robin across the topic's partitions, with acks=1. The partition leaders are
+// looked up again and the message retried when a leader moves or a broker
+// connection drops
+type kafkaPublisher struct {
+	bootstrap  string
+	topic      string
+	dialer     kafkaDialer
+	partitions []int32
+	leaders    map[int32]string
+	conns      map[string]*kafkaConn
+	next       int
+}
+
+// kafkaDialer connects to brokers, over TLS if tls isn't nil and
+// authenticating with SASL PLAIN if user isn't empty
+type kafkaDialer struct {
+	tls            *tls.Config
+	user, password string
+}
+
+// kafkaConn is a connection to one broker, requests on it are sent one at a time
+type kafkaConn struct {
+	conn          net.Conn
+	r             *bufio.Reader
+	correlationID int32
+}
+
+func (d kafkaDialer) dial(addr string) (*kafkaConn, error) {
+	var conn net.Conn
+	var err error
+	if d.tls != nil {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: 10 * time.Second}, "tcp", addr, d.tls)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, 10*time.Second)
+	}
+	if err != nil {
+		return nil, err
+	}
+	k := &kafkaConn{conn: conn, r: bufio.NewReader(conn)}
+	if d.user != "" {
+		if err := k.authenticate(d.user, d.password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("kafka %s: %w", addr, err)
+		}
+	}
+	return k, nil
+}
+
+// authenticate logs in with SASL PLAIN
+func (k *kafkaConn) authenticate(user, password string) error {
+	var req kafkaWriter
+	req.string("PLAIN")
+	rd, err := k.request(kafkaSaslHandshake, kafkaSaslHandshakeVersion, req.buf)
+	if err != nil {
+		return err
+	}
+	if code := rd.int16(); code != 0 {
+		return fmt.Errorf("SASL PLAIN not enabled: %w", kafkaError(code))
+	}
+
+	req = kafkaWriter{}
+	req.bytes([]byte("\x00" + user + "\x00" + password))
+	if rd, err = k.request(kafkaSaslAuthenticate, kafkaSaslAuthenticateVersion, req.buf); err != nil {
+		return err
+	}
+	code := rd.int16()
+	message := rd.string()
+	if code != 0 {
+		return fmt.Errorf("SASL authentication failed: %s", message)
+	}
+	return rd.err
+}
+
+// request sends one request and returns the response body after its correlation id
+func (k *kafkaConn) request(apiKey, apiVersion int16, body []byte) (*kafkaReader, error) {
+	k.correlationID++
+	var msg kafkaWriter
+	msg.int16(apiKey)
+	msg.int16(apiVersion)
+	msg.int32(k.correlationID)
+	msg.string(kafkaClientID)
+	msg.buf = append(msg.buf, body...)
+
+	k.conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer k.conn.SetDeadline(time.Time{})
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(msg.buf)))
+	if _, err := k.conn.Write(append(size, msg.buf...)); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(k.r, size); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint32(size))
+	if _, err := io.ReadFull(k.r, resp); err != nil {
+		return nil, err
+	}
+	rd := &kafkaReader{buf: resp}
+	if id := rd.int32(); id != k.correlationID {
+		return nil, fmt.Errorf("kafka: response %d to request %d", id, k.correlationID)
+	}
+	return rd, nil
+}
+
+// newKafkaPublisher connects to the cluster u points to, over TLS if config
+// isn't nil and with SASL PLAIN if u has a user
+func newKafkaPublisher(u *url.URL, topic string, config *tls.Config) (*kafkaPublisher, error) {
+	bootstrap := u.Host
+	if u.Port() == "" {
+		bootstrap = net.JoinHostPort(u.Hostname(), "9092")
+	}
+	p := &kafkaPublisher{bootstrap: bootstrap, topic: topic, dialer: kafkaDialer{tls: config}, conns: make(map[string]*kafkaConn)}
+	if u.User != nil {
+		p.dialer.user = u.User.Username()
+		p.dialer.password, _ = u.User.Password()
+	}
+	if err := p.refresh(); err != nil {
+		return nil, fmt.Errorf("kafka topic %s: %w", topic, err)
+	}
+	return p, nil
+}
+
+// refresh looks up the topic's partition leaders through the bootstrap
+// broker, closing the connections to brokers that no longer lead any
+func (p *kafkaPublisher) refresh() error {
+	boot, err := p.dialer.dial(p.bootstrap)
+	if err != nil {
+		return err
+	}
+	defer boot.conn.Close()
+
+	// a topic that was just auto created has no leaders for a moment
+	var leaders map[int32]string
+	for attempt := 0; ; attempt++ {
+		leaders, err = kafkaLeaders(boot, p.topic)
+		if err != errLeaderNotAvailable || attempt == 5 {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.leaders = leaders
+	p.partitions = p.partitions[:0]
+	leading := make(map[string]bool)
+	for partition, addr := range leaders {
+		p.partitions = append(p.partitions, partition)
+		leading[addr] = true
+	}
+	sort.Slice(p.partitions, func(i, j int) bool { return p.partitions[i] < p.partitions[j] })
+	for addr, conn := range p.conns {
+		if !leading[addr] {
+			conn.conn.Close()
+			delete(p.conns, addr)
+		}
+	}
+	return nil
+}
+
+var errLeaderNotAvailable = errors.New("no partitions with a leader")
+
+// kafkaLeaders asks a broker for the address of each of topic's partition leaders
+func kafkaLeaders(boot *kafkaConn, topic string) (map[int32]string, error) {
+	var req kafkaWriter
+	req.int32(1)
+	req.string(topic)
+	req.bool(true) // allow auto topic creation
+	rd, err := boot.request(kafkaMetadata, kafkaMetadataVersion, req.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	rd.int32() // throttle time
+	brokers := make(map[int32]string)
+	for n := rd.int32(); n > 0 && rd.err == nil; n-- {
+		id := rd.int32()
+		host := rd.string()
+		port := rd.int32()
+		rd.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	rd.string() // cluster id
+	rd.int32()  // controller id
+
+	leaders := make(map[int32]string)
+	for n := rd.int32(); n > 0 && rd.err == nil; n-- {
+		code := rd.int16()
+		rd.string() // name
+		rd.bool()   // internal
+		if code == kafkaLeaderNotAvailable {
+			return nil, errLeaderNotAvailable
+		}
+		if code != 0 {
+			return nil, kafkaError(code)
+		}
+		for m := rd.int32(); m > 0 && rd.err == nil; m-- {
+			rd.int16() // partition error, the leader is what matters
+			partition := rd.int32()
+			leader := rd.int32()
+			rd.int32Array() // replicas
+			rd.int32Array() // in sync replicas
+			if addr, ok := brokers[leader]; ok {
+				leaders[partition] = addr
+			}
+		}
+	}
+	if rd.err != nil {
+		return nil, rd.err
+	}
+	if len(leaders) == 0 {
+		return nil, errLeaderNotAvailable
+	}
+	return leaders, nil
+}
+
+func (p *kafkaPublisher) publish(data []byte) error {
+	partition := p.partitions[p.next%len(p.partitions)]
+	p.next++
+
+	batch := recordBatch(data, time.Now())
+	for attempt := 0; ; attempt++ {
+		err := p.produce(partition, batch)
+		var code kafkaError
+		if err == nil || errors.As(err, &code) && !code.retriable() || attempt == kafkaRetries {
+			return err
+		}
+		time.Sleep(time.Duration(attempt+1) * kafkaBackoff)
+		if err := p.refresh(); err != nil {
+			return fmt.Errorf("kafka topic %s: %w", p.topic, err)
+		}
+	}
+}
+
+// produce sends batch to partition's leader
+func (p *kafkaPublisher) produce(partition int32, batch []byte) error {
+	addr, ok := p.leaders[partition]
+	if !ok {
+		return fmt.Errorf("kafka produce to %s/%d: %w", p.topic, partition, kafkaError(kafkaLeaderNotAvailable))
+	}
+	conn, ok := p.conns[addr]
+	if !ok {
+		var err error
+		if conn, err = p.dialer.dial(addr); err != nil {
+			return fmt.Errorf("kafka produce: %w", err)
+		}
+		p.conns[addr] = conn
+	}
+
+	var req kafkaWriter
+	req.nullString() // transactional id
+	req.int16(1)     // acks from the leader
+	req.int32(30000) // timeout ms
+	req.int32(1)
+	req.string(p.topic)
+	req.int32(1)
+	req.int32(partition)
+	req.bytes(batch)
+
+	rd, err := conn.request(kafkaProduce, kafkaProduceVersion, req.buf)
+	if err != nil {
+		// whatever was left of the exchange can't be told apart from the next one
+		conn.conn.Close()
+		delete(p.conns, addr)
+		return fmt.Errorf("kafka produce: %w", err)
+	}
+	for n := rd.int32(); n > 0; n-- {
+		rd.string()
+		for m := rd.int32(); m > 0; m-- {
+			rd.int32() // partition
+			if code := rd.int16(); code != 0 {
+				return fmt.Errorf("kafka produce to %s/%d: %w", p.topic, partition, kafkaError(code))
+			}
+			rd.int64() // base offset
+			rd.int64() // log append time
+		}
+	}
+	return rd.err
+}
+
+func (p *kafkaPublisher) close() error {
+	for _, conn := range p.conns {
+		conn.conn.Close()
+	}
+	return nil
+}
+
+// recordBatch encodes value as the only record of a v2 record batch
+func recordBatch(value []byte, now time.Time) []byte {
+	var record kafkaWriter
+	record.buf = append(record.buf, 0) // attributes
+	record.varint(0)                   // timestamp delta
+	record.varint(0)                   // offset delta
+	record.varint(-1)                  // no key
+	record.varint(int64(len(value)))   // value
+	record.buf = append(record.buf, value...)
+	record.varint(0) // no headers
+
+	// everything the CRC covers, from the attributes on
+	var tail kafkaWriter
+	tail.int16(0) // attributes: no compression, create time
+	tail.int32(0) // last offset delta
+	ms := now.UnixNano() / int64(time.Millisecond)
+	tail.int64(ms) // first timestamp
+	tail.int64(ms) // max timestamp
+	tail.int64(-1) // producer id
+	tail.int16(-1) // producer epoch
+	tail.int32(-1) // base sequence
+	tail.int32(1)  // records
+	tail.varint(int64(len(record.buf)))
+	tail.buf = append(tail.buf, record.buf...)
+
+	var batch kafkaWriter
+	batch.int64(0)                                // base offset
+	batch.int32(int32(4 + 1 + 4 + len(tail.buf))) // length after this field
+	batch.int32(-1)                               // partition leader epoch
+	batch.buf = append(batch.buf, 2)              // magic
+	batch.int32(int32(crc32.Checksum(tail.buf, castagnoli)))
+	batch.buf = append(batch.buf, tail.buf...)
+	return batch.buf
+}
+
+// kafkaWriter encodes Kafka protocol primitives
+type kafkaWriter struct {
+	buf []byte
+}
+
+func (w *kafkaWriter) int16(v int16) {
+	w.buf = append(w.buf, byte(v>>8), byte(v))
+}
+
+func (w *kafkaWriter) int32(v int32) {
+	w.buf = append(w.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (w *kafkaWriter) int64(v int64) {
+	w.int32(int32(v >> 32))
+	w.int32(int32(v))
+}
+
+func (w *kafkaWriter) bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *kafkaWriter) string(s string) {
+	w.int16(int16(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *kafkaWriter) nullString() {
+	w.int16(-1)
+}
+
+func (w *kafkaWriter) bytes(b []byte) {
+	w.int32(int32(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// varint is a zigzag encoded variable length integer, as used inside records
+func (w *kafkaWriter) varint(v int64) {
+	b := make([]byte, binary.MaxVarintLen64)
+	w.buf = append(w.buf, b[:binary.PutVarint(b, v)]...)
+}
+
+// kafkaReader decodes Kafka protocol primitives, remembering the first error
+type kafkaReader struct {
+	buf []byte
+	err error
+}
+
+func (r *kafkaReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = errors.New("short response")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *kafkaReader) int16() int16 {
+	if b := r.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int32() int32 {
+	if b := r.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) int64() int64 {
+	if b := r.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (r *kafkaReader) bool() bool {
+	if b := r.take(1); b != nil {
+		return b[0] != 0
+	}
+	return false
+}
+
+// string reads a string, null strings read as empty
+func (r *kafkaReader) string() string {
+	n := r.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(r.take(int(n)))
+}
+
+func (r *kafkaReader) int32Array() []int32 {
+	var values []int32
+	for n := r.int32(); n > 0 && r.err == nil; n-- {
+		values = append(values, r.int32())
+	}
+	return values
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// varint reads a zigzag encoded variable length integer
+func (r *kafkaReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func TestRecordBatch(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ms := now.UnixNano() / int64(time.Millisecond)
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "empty", value: []byte{}},
+		{name: "finding", value: []byte(`{"source":"reflector","url":"https://example.com/?q=rflk8f2a9x0m3p_q"}`)},
+		{name: "binary", value: []byte{0, 1, 0xff, '\r', '\n', 0}},
+		{name: "large", value: bytes.Repeat([]byte("a"), 1<<16)},
+	}
+	for _, test := range tests {
+		batch := recordBatch(test.value, now)
+		rd := &kafkaReader{buf: batch}
+		if offset := rd.int64(); offset != 0 {
+			t.Errorf("%s: base offset %d", test.name, offset)
+		}
+		if length := rd.int32(); int(length) != len(rd.buf) {
+			t.Errorf("%s: batch length %d, %d bytes follow", test.name, length, len(rd.buf))
+		}
+		rd.int32() // partition leader epoch
+		if magic := rd.take(1); len(magic) != 1 || magic[0] != 2 {
+			t.Errorf("%s: magic %v", test.name, magic)
+		}
+		if crc := uint32(rd.int32()); crc != crc32.Checksum(rd.buf, castagnoli) {
+			t.Errorf("%s: CRC %x doesn't match", test.name, crc)
+		}
+		if attributes := rd.int16(); attributes != 0 {
+			t.Errorf("%s: batch attributes %d", test.name, attributes)
+		}
+		rd.int32() // last offset delta
+		if first, max := rd.int64(), rd.int64(); first != ms || max != ms {
+			t.Errorf("%s: timestamps %d and %d, want %d", test.name, first, max, ms)
+		}
+		rd.int64() // producer id
+		rd.int16() // producer epoch
+		rd.int32() // base sequence
+		if records := rd.int32(); records != 1 {
+			t.Errorf("%s: %d records", test.name, records)
+		}
+		if length := rd.varint(); int(length) != len(rd.buf) {
+			t.Errorf("%s: record length %d, %d bytes follow", test.name, length, len(rd.buf))
+		}
+		rd.take(1)  // attributes
+		rd.varint() // timestamp delta
+		rd.varint() // offset delta
+		if key := rd.varint(); key != -1 {
+			t.Errorf("%s: key length %d", test.name, key)
+		}
+		value := rd.take(int(rd.varint()))
+		if headers := rd.varint(); headers != 0 {
+			t.Errorf("%s: %d headers", test.name, headers)
+		}
+		if rd.err != nil {
+			t.Fatalf("%s: %v", test.name, rd.err)
+		}
+		if !bytes.Equal(value, test.value) || len(rd.buf) != 0 {
+			t.Errorf("%s: value %q with %d bytes left over", test.name, value, len(rd.buf))
+		}
+	}
+}
+
+// fakeBroker answers metadata requests with itself as the only partition's
+// leader, and produce requests with the next of codes
+type fakeBroker struct {
+	addr string
+
+	mu       sync.Mutex
+	codes    []int16
+	metadata int
+	produced [][]byte
+}
+
+func (b *fakeBroker) serve(t *testing.T, l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(t, conn)
+	}
+}
+
+func (b *fakeBroker) handle(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint32(size))
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+		rd := &kafkaReader{buf: msg}
+		apiKey := rd.int16()
+		rd.int16() // version
+		id := rd.int32()
+		rd.string() // client id
+
+		var resp kafkaWriter
+		resp.int32(id)
+		b.mu.Lock()
+		switch apiKey {
+		case kafkaMetadata:
+			b.metadata++
+			host, port, _ := net.SplitHostPort(b.addr)
+			n, _ := strconv.Atoi(port)
+			resp.int32(0) // throttle time
+			resp.int32(1)
+			resp.int32(1)
+			resp.string(host)
+			resp.int32(int32(n))
+			resp.nullString() // rack
+			resp.nullString() // cluster id
+			resp.int32(1)     // controller
+			resp.int32(1)
+			resp.int16(0)
+			resp.string("findings")
+			resp.bool(false)
+			resp.int32(1)
+			resp.int16(0)
+			resp.int32(0) // partition
+			resp.int32(1) // leader
+			resp.int32(0) // replicas
+			resp.int32(0) // in sync replicas
+		case kafkaProduce:
+			rd.string() // transactional id
+			rd.int16()  // acks
+			rd.int32()  // timeout
+			rd.int32()
+			rd.string() // topic
+			rd.int32()
+			rd.int32() // partition
+			b.produced = append(b.produced, rd.take(int(rd.int32())))
+			code := b.codes[0]
+			b.codes = b.codes[1:]
+			resp.int32(1)
+			resp.string("findings")
+			resp.int32(1)
+			resp.int32(0)
+			resp.int16(code)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0) // throttle time
+		default:
+			t.Errorf("unexpected API key %d", apiKey)
+		}
+		b.mu.Unlock()
+		binary.BigEndian.PutUint32(size, uint32(len(resp.buf)))
+		conn.Write(append(size, resp.buf...))
+	}
+}
+
+func TestKafkaPublishRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		codes    []int16
+		fails    bool
+		produced int
+		metadata int
+	}{
+		{name: "accepted", codes: []int16{0}, produced: 1, metadata: 1},
+		{name: "leader moved", codes: []int16{kafkaNotLeaderForPartition, 0}, produced: 2, metadata: 2},
+		{name: "leader not available twice", codes: []int16{kafkaLeaderNotAvailable, kafkaLeaderNotAvailable, 0}, produced: 3, metadata: 3},
+		{name: "message too large", codes: []int16{10}, fails: true, produced: 1, metadata: 1},
+		{name: "leader never comes back", codes: []int16{kafkaNotLeaderForPartition, kafkaNotLeaderForPartition, kafkaNotLeaderForPartition, kafkaNotLeaderForPartition}, fails: true, produced: kafkaRetries + 1, metadata: kafkaRetries + 1},
+	}
+	defer func(backoff time.Duration) { kafkaBackoff = backoff }(kafkaBackoff)
+	kafkaBackoff = time.Millisecond
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		broker := &fakeBroker{addr: l.Addr().String(), codes: test.codes}
+		go broker.serve(t, l)
+
+		p, err := newKafkaPublisher(&url.URL{Scheme: "kafka", Host: broker.addr}, "findings", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		err = p.publish([]byte(`{"source":"reflector"}`))
+		if (err != nil) != test.fails {
+			t.Errorf("%s: publish returned %v", test.name, err)
+		}
+		broker.mu.Lock()
+		if len(broker.produced) != test.produced || broker.metadata != test.metadata {
+			t.Errorf("%s: %d produce and %d metadata requests, want %d and %d", test.name, len(broker.produced), broker.metadata, test.produced, test.metadata)
+		}
+		for _, batch := range broker.produced {
+			if !bytes.Equal(batch, broker.produced[0]) {
+				t.Errorf("%s: retried with a different batch", test.name)
+			}
+		}
+		broker.mu.Unlock()
+		p.close()
+		l.Close()
+	}
+}
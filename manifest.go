@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"time"
+)
+
+// manifest records how a run was made and where its output went,
+// so results can be audited and the scan reproduced later
+type manifest struct {
+	Tool      string            `json:"tool"`
+	Version   string            `json:"version"`
+	GoVersion string            `json:"go_version"`
+	Command   []string          `json:"command"`
+	Config    map[string]string `json:"config"`
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Targets   []string          `json:"targets"`
+	Outputs   map[string]string `json:"outputs"`
+}
+
+// newManifest captures the effective value of every flag, secrets redacted
+func newManifest(start time.Time) *manifest {
+	m := &manifest{
+		Tool:      "go-reflect",
+		Version:   toolVersion(),
+		GoVersion: runtime.Version(),
+		Config:    make(map[string]string),
+		Start:     start,
+		Outputs:   make(map[string]string),
+	}
+	for _, arg := range os.Args {
+		m.Command = append(m.Command, redaction.redact(arg))
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		m.Config[f.Name] = redaction.redact(f.Value.String())
+	})
+	m.Outputs["results"] = outputPath(os.Stdout)
+	return m
+}
+
+// toolVersion returns the module version go-reflect was built at, (devel) for a local build
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// outputPath names where f is going, the file path when it's redirected to one
+func outputPath(f *os.File) string {
+	if stat, err := f.Stat(); err == nil && stat.Mode().IsRegular() {
+		if path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(f.Fd()))); err == nil {
+			return path
+		}
+	}
+	return f.Name()
+}
+
+// write finishes the manifest and saves it as indented JSON, sealed with
+// key if it isn't nil
+func (m *manifest) write(path string, targets []string, key []byte) error {
+	m.End = time.Now()
+	m.Targets = targets
+	m.Outputs["manifest"] = path
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSealed(path, append(data, '\n'), key)
+}
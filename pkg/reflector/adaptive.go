@@ -0,0 +1,148 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveLimiter is an AIMD concurrency window for one host: every clean, fast
+// response grows the window by one request per window, errors and latency spikes halve it
+type adaptiveLimiter struct {
+	mu           sync.Mutex
+	cond         *sync.Cond
+	window       float64
+	max          float64
+	inflight     int
+	baseline     time.Duration
+	lastDecrease time.Time
+}
+
+func newAdaptiveLimiter(start, max int) *adaptiveLimiter {
+	if max < start {
+		max = start
+	}
+	a := &adaptiveLimiter{
+		window: float64(start),
+		max:    float64(max),
+	}
+	a.cond = sync.NewCond(&a.mu)
+	return a
+}
+
+// acquire blocks until the window has room for another request
+func (a *adaptiveLimiter) acquire() {
+	a.mu.Lock()
+	for float64(a.inflight) >= a.window {
+		a.cond.Wait()
+	}
+	a.inflight++
+	a.mu.Unlock()
+}
+
+// release frees a slot and adjusts the window from how the request went
+func (a *adaptiveLimiter) release(latency time.Duration, failed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.inflight > 0 {
+		a.inflight--
+	}
+	if !failed && (a.baseline == 0 || latency < a.baseline) {
+		a.baseline = latency
+	}
+
+	// a host that slows to a crawl is as overwhelmed as one returning errors
+	slow := a.baseline > 0 && latency > 4*a.baseline && latency > 500*time.Millisecond
+	if failed || slow {
+		// one decrease per second, a burst of failures is one congestion event
+		if time.Since(a.lastDecrease) > time.Second {
+			a.window /= 2
+			if a.window < 1 {
+				a.window = 1
+			}
+			a.lastDecrease = time.Now()
+		}
+	} else if a.window < a.max {
+		a.window += 1 / a.window
+	}
+	a.cond.Broadcast()
+}
+
+// current returns the window size, rounded down
+func (a *adaptiveLimiter) current() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return int(a.window)
+}
+
+// adaptiveHosts keeps one adaptive window per host and times each request
+type adaptiveHosts struct {
+	start, max int
+
+	mu     sync.Mutex
+	hosts  map[string]*adaptiveLimiter
+	starts sync.Map
+}
+
+// requestKey tells requests apart across collectors, colly numbers the
+// requests of each collector from one
+type requestKey struct {
+	collector, request uint32
+}
+
+// inflightRequest is where and when a timed request started,
+// kept by id since redirects can change the request's own URL
+type inflightRequest struct {
+	host  string
+	start time.Time
+}
+
+func newAdaptiveHosts(start, max int) *adaptiveHosts {
+	return &adaptiveHosts{
+		start: start,
+		max:   max,
+		hosts: make(map[string]*adaptiveLimiter),
+	}
+}
+
+func (h *adaptiveHosts) host(host string) *adaptiveLimiter {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	a, ok := h.hosts[host]
+	if !ok {
+		a = newAdaptiveLimiter(h.start, h.max)
+		h.hosts[host] = a
+	}
+	return a
+}
+
+// begin waits for room on host and starts timing request id
+func (h *adaptiveHosts) begin(id requestKey, host string) {
+	h.host(host).acquire()
+	h.starts.Store(id, inflightRequest{host: host, start: time.Now()})
+}
+
+// end finishes request id, status 0 meaning it never got a response
+func (h *adaptiveHosts) end(id requestKey, status int, err error) {
+	v, ok := h.starts.Load(id)
+	if !ok {
+		return
+	}
+	h.starts.Delete(id)
+	req := v.(inflightRequest)
+	failed := (status == 0 && err != nil) ||
+		status == http.StatusTooManyRequests ||
+		status >= 500
+	h.host(req.host).release(time.Since(req.start), failed)
+}
+
+// printStats writes the window each host settled on for the run summary
+func (h *adaptiveHosts) printStats(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for host, a := range h.hosts {
+		fmt.Fprintf(w, "[adaptive] %s threads=%d\n", host, a.current())
+	}
+}
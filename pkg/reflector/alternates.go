@@ -0,0 +1,118 @@
+package reflector
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// selects the AMP version, translations and feeds a page links to
+const alternateSelector = "link[rel~=amphtml][href], link[rel~=alternate][href]"
+
+// alternateKind describes an alternate link for output, e.g. rel=amphtml, hreflang=de or feed=rss
+func alternateKind(e *colly.HTMLElement) string {
+	if strings.Contains(strings.ToLower(e.Attr("rel")), "amphtml") {
+		return "rel=amphtml"
+	}
+	if lang := e.Attr("hreflang"); lang != "" {
+		return "hreflang=" + lang
+	}
+	typ := strings.ToLower(e.Attr("type"))
+	for _, feed := range []string{"rss", "atom", "json"} {
+		if strings.Contains(typ, feed) {
+			return "feed=" + feed
+		}
+	}
+	return "rel=alternate"
+}
+
+// feedLinks returns the links of an RSS, Atom or JSON feed, its entries and
+// home page, and nil for any other response
+func feedLinks(contentType string, body []byte) []string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		return jsonFeedLinks(body)
+	case strings.Contains(contentType, "xml"), strings.Contains(contentType, "rss"), strings.Contains(contentType, "atom"):
+		return xmlFeedLinks(body)
+	}
+	return nil
+}
+
+// xmlFeedLinks reads the <link> elements of an RSS or RDF feed, whose text
+// is the link, and of an Atom feed, whose href is
+func xmlFeedLinks(body []byte) []string {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	// feeds declare all sorts of charsets, links are ASCII anyway
+	decoder.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	var links []string
+	root := true
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return links
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if root {
+			// sitemaps and other XML documents have links of their own
+			switch start.Name.Local {
+			case "rss", "RDF", "feed":
+			default:
+				return nil
+			}
+			root = false
+			continue
+		}
+		if start.Name.Local != "link" {
+			continue
+		}
+		href := ""
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "href" {
+				href = attr.Value
+			}
+		}
+		if href == "" {
+			var text string
+			if decoder.DecodeElement(&text, &start) == nil {
+				href = text
+			}
+		}
+		if href = strings.TrimSpace(href); href != "" {
+			links = append(links, href)
+		}
+	}
+}
+
+// jsonFeedLinks reads the home page and item URLs of a JSON Feed
+func jsonFeedLinks(body []byte) []string {
+	var feed struct {
+		Version  string `json:"version"`
+		HomePage string `json:"home_page_url"`
+		Items    []struct {
+			URL         string `json:"url"`
+			ExternalURL string `json:"external_url"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil || !strings.Contains(feed.Version, "jsonfeed.org") {
+		return nil
+	}
+	links := []string{feed.HomePage}
+	for _, item := range feed.Items {
+		links = append(links, item.URL, item.ExternalURL)
+	}
+	var filled []string
+	for _, link := range links {
+		if link != "" {
+			filled = append(filled, link)
+		}
+	}
+	return filled
+}
@@ -0,0 +1,59 @@
+package reflector
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// bodyFilter tells crawled responses worth downloading from the PDFs,
+// videos and huge bundles that aren't, by their headers alone
+type bodyFilter struct {
+	// 0 for no limit
+	maxBytes int64
+	// media types, e.g. text/html or text/*, or words of their subtypes,
+	// e.g. html or json, nil for every type
+	types []string
+}
+
+// newBodyFilter returns nil when nothing is filtered
+func newBodyFilter(maxBytes int64, types []string) *bodyFilter {
+	var kept []string
+	for _, t := range types {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			kept = append(kept, t)
+		}
+	}
+	if maxBytes <= 0 && len(kept) == 0 {
+		return nil
+	}
+	return &bodyFilter{maxBytes: maxBytes, types: kept}
+}
+
+// skip reports whether a response with these Content-Length and
+// Content-Type headers is left undownloaded. Responses that don't say are
+// kept, the ones without a length are cut off at the limit instead
+func (f *bodyFilter) skip(length, contentType string) bool {
+	if f.maxBytes > 0 {
+		if n, err := strconv.ParseInt(strings.TrimSpace(length), 10, 64); err == nil && n > f.maxBytes {
+			return true
+		}
+	}
+	if len(f.types) == 0 || contentType == "" {
+		return false
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	subtype := media[strings.Index(media, "/")+1:]
+	for _, t := range f.types {
+		switch {
+		case t == media,
+			strings.HasSuffix(t, "/*") && strings.HasPrefix(media, t[:len(t)-1]),
+			!strings.Contains(t, "/") && strings.Contains(subtype, t):
+			return false
+		}
+	}
+	return true
+}
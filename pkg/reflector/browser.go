@@ -0,0 +1,88 @@
+package reflector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// headless Chrome/Chromium binaries tried when no path is given
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome"}
+
+// browser drives a headless Chrome over the DevTools protocol, one process
+// for the whole run and a browser context for each page
+type browser struct {
+	path    string
+	timeout time.Duration
+	// proxy server pages are loaded through, in Chrome's --proxy-server format
+	proxy string
+	// selectors of consent and age gate buttons to click in rendered pages
+	dismiss []string
+
+	mu sync.Mutex
+	// the running browser's DevTools endpoint, empty until it is started
+	endpoint string
+	running  *exec.Cmd
+	stop     context.CancelFunc
+}
+
+// newBrowser finds the browser binary, path may be empty to search $PATH
+func newBrowser(path string) (*browser, error) {
+	if path != "" {
+		if _, err := exec.LookPath(path); err != nil {
+			return nil, err
+		}
+		return &browser{path: path, timeout: 30 * time.Second}, nil
+	}
+	for _, name := range browserNames {
+		if found, err := exec.LookPath(name); err == nil {
+			return &browser{path: found, timeout: 30 * time.Second}, nil
+		}
+	}
+	return nil, errors.New("no headless Chrome or Chromium found, set one with -browser")
+}
+
+// browserMarker is the benign payload used to prove a reflection renders,
+// it breaks out of attributes and inline scripts and adds a custom element
+// that only shows up in the DOM if the page didn't encode it
+func browserMarker(hash string) string {
+	return fmt.Sprintf(`"'></script><rfl-%s></rfl-%s>`, hash, hash)
+}
+
+// verifyInBrowser re-sends the probe with the marker in the reflected params
+// through the browser, in the crawl's session, and reports whether the
+// marker element made it into the DOM
+func verifyInBrowser(b *browser, f Form, inj injection, params []string, session browserSession) bool {
+	marked := injection{
+		FormLocation: inj.FormLocation,
+		Params:       inj.Params,
+		Hashes:       make([]string, len(inj.Hashes)),
+	}
+	hash := strings.ToLower(randomString(8))
+	for i, name := range inj.Params {
+		if inj.Hashes[i] != "" && containsString(params, name) {
+			marked.Hashes[i] = browserMarker(hash)
+		}
+	}
+
+	d, err := b.openDevtools()
+	if err != nil {
+		return false
+	}
+	defer d.close()
+	if err := d.useSession(f.URL, session); err != nil {
+		return false
+	}
+	if err := d.load(f, marked, renderSettle); err != nil {
+		return false
+	}
+	var dom string
+	if err := d.evaluate("document.documentElement.outerHTML", &dom); err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(dom), "<rfl-"+hash)
+}
@@ -0,0 +1,169 @@
+package reflector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// A canary is what gets sent in place of a test string: canaryPrefix and
+// random letters and digits, which are what responses are searched for, then
+// the name of the parameter it went out in so it reads well in logs and proxy
+// history, e.g. rflk8f2a9x0m3p_q. Everything is lowercase, so canaries
+// survive being lowercased, and nothing in them needs encoding in a URL,
+// header or email
+const (
+	canaryPrefix = "rfl"
+	canaryRandom = 10
+	// longer parameter names are cut short
+	canaryNameLength = 16
+)
+
+var (
+	canaryRegex   = regexp.MustCompile(fmt.Sprintf("^%s[a-z0-9]{%d}", canaryPrefix, canaryRandom))
+	canaryNameMap = regexp.MustCompile("[^a-z0-9]+")
+)
+
+// newCanary picks a fresh canary for param
+func newCanary(param string) string {
+	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
+	b := make([]byte, canaryRandom)
+	for i := range b {
+		b[i] = charset[randomIndex(len(charset))]
+	}
+	if name := canaryName(param); name != "" {
+		return canaryPrefix + string(b) + "_" + name
+	}
+	return canaryPrefix + string(b)
+}
+
+// canaryName makes param fit in a canary, header[X-Forwarded-Host] becomes xforwardedhost
+func canaryName(param string) string {
+	if open := strings.LastIndex(param, "["); open >= 0 && strings.HasSuffix(param, "]") && open+1 < len(param)-1 {
+		param = param[open+1 : len(param)-1]
+	}
+	name := canaryNameMap.ReplaceAllString(strings.ToLower(param), "")
+	if len(name) > canaryNameLength {
+		name = name[:canaryNameLength]
+	}
+	return name
+}
+
+// canaryID returns the part of a canary responses are searched for, so one cut
+// short by a length limit is still found. Hashes that aren't canaries, from
+// state files written by older versions, are searched for whole
+func canaryID(hash string) string {
+	if id := canaryRegex.FindString(hash); id != "" {
+		return id
+	}
+	return hash
+}
+
+// canaryOrigin is the parameter a canary was sent in and the request that first carried it
+type canaryOrigin struct {
+	canary string
+	param  string
+	// empty for canaries sent before a resume
+	method string
+	url    string
+	// the encoded body of a POST, as it was sent
+	body string
+	sent time.Time
+}
+
+// canaryRegistry records every canary sent, so a reflection found anywhere,
+// in a later response, on another page or in an error page, is traced back
+// to the parameter and request it came from
+type canaryRegistry struct {
+	mu      sync.Mutex
+	origins map[string]*canaryOrigin
+}
+
+func newCanaryRegistry() *canaryRegistry {
+	return &canaryRegistry{origins: make(map[string]*canaryOrigin)}
+}
+
+// add registers the canaries of inj and returns it to be sent. A canary
+// already registered for another parameter is replaced with a fresh one,
+// so no reflection is ever traced back to the wrong origin
+func (g *canaryRegistry) add(inj injection) injection {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// copied before the first replacement, batches may share their hashes
+	hashes, copied := inj.Hashes, false
+	for i, hash := range hashes {
+		if hash == "" {
+			continue
+		}
+		for {
+			origin, ok := g.origins[canaryID(hash)]
+			if !ok {
+				g.origins[canaryID(hash)] = &canaryOrigin{canary: hash, param: inj.Params[i]}
+				break
+			}
+			// the same canary again, e.g. a batch split into singles
+			if origin.canary == hash && origin.param == inj.Params[i] {
+				break
+			}
+			if !copied {
+				hashes, copied = append([]string{}, inj.Hashes...), true
+			}
+			hash = strings.Replace(hash, canaryID(hash), canaryID(newCanary(inj.Params[i])), 1)
+			hashes[i] = hash
+		}
+	}
+	inj.Hashes = hashes
+	return inj
+}
+
+// sent notes r as the request carrying the canaries of its injection,
+// unless an earlier one already did, with the body sendProbe put in its context
+func (g *canaryRegistry) sent(r *colly.Request) {
+	inj, ok := r.Ctx.GetAny("injection").(injection)
+	if !ok {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, hash := range inj.Hashes {
+		if origin, ok := g.origins[canaryID(hash)]; ok && origin.method == "" {
+			origin.method, origin.url, origin.sent = r.Method, r.URL.String(), time.Now()
+			origin.body = r.Ctx.Get("body")
+		}
+	}
+}
+
+// fields annotates a reflection of params of inj with their canaries and
+// the request that first sent them, its body too if it had one
+func (g *canaryRegistry) fields(inj injection, params []string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var canaries []string
+	var first *canaryOrigin
+	for _, param := range params {
+		origin, ok := g.origins[canaryID(inj.hash(param))]
+		if !ok {
+			continue
+		}
+		canaries = append(canaries, origin.canary)
+		if origin.method != "" && (first == nil || origin.sent.Before(first.sent)) {
+			first = origin
+		}
+	}
+	if len(canaries) == 0 {
+		return ""
+	}
+	fields := []string{"canary=" + strings.Join(canaries, ",")}
+	if first != nil {
+		fields = append(fields, "origin="+first.method+":"+first.url, "sent="+first.sent.UTC().Format(time.RFC3339))
+		// form encoded, so it holds no spaces
+		if first.body != "" {
+			fields = append(fields, "origin-body="+first.body)
+		}
+	}
+	return strings.Join(fields, " ")
+}
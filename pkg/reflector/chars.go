@@ -0,0 +1,95 @@
+package reflector
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// characters needed to break out of HTML, attribute and script contexts
+const specialChars = `<>"'&;()`
+
+// encodings that keep a character from doing anything: HTML entities and backslash escapes
+var encodedCharRegex = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z][a-zA-Z0-9]*);|\\.`)
+
+// survivingChars re-sends the probe with the special characters between two
+// canaries in each reflected param and returns, per param, the characters that
+// came back unencoded. A param whose canaries didn't come back is left out
+func survivingChars(p *prober, f Form, inj injection, params []string) map[string]string {
+	probe := injection{
+		FormLocation: inj.FormLocation,
+		Params:       inj.Params,
+		Hashes:       make([]string, len(inj.Hashes)),
+	}
+	canaries := make(map[string][2]string)
+	for i, name := range inj.Params {
+		if inj.Hashes[i] != "" && containsString(params, name) {
+			pre, post := randomString(8), randomString(8)
+			canaries[name] = [2]string{pre, post}
+			probe.Hashes[i] = pre + specialChars + post
+		}
+	}
+
+	resp, body, err := p.submit(f, probe)
+	if err != nil {
+		return nil
+	}
+	// characters can come back in a header as well as the body
+	var headers []byte
+	for name, values := range resp.Header {
+		headers = append(headers, name+": "+strings.Join(values, ", ")+"\n"...)
+	}
+
+	surviving := make(map[string]string)
+	for _, param := range params {
+		c, ok := canaries[param]
+		if !ok {
+			continue
+		}
+		between := regexp.MustCompile(regexp.QuoteMeta(c[0]) + `(.{0,64}?)` + regexp.QuoteMeta(c[1]))
+		found := false
+		best := ""
+		// the most permissive reflection is the one worth knowing about
+		for _, m := range between.FindAllSubmatch(append(body, headers...), -1) {
+			found = true
+			if chars := unencodedChars(m[1]); len(chars) > len(best) {
+				best = chars
+			}
+		}
+		if found {
+			surviving[param] = best
+		}
+	}
+	return surviving
+}
+
+// unencodedChars returns the special characters literally in reflected
+func unencodedChars(reflected []byte) string {
+	literal := encodedCharRegex.ReplaceAll(reflected, nil)
+	var chars []byte
+	for i := 0; i < len(specialChars); i++ {
+		if bytes.IndexByte(literal, specialChars[i]) >= 0 {
+			chars = append(chars, specialChars[i])
+		}
+	}
+	return string(chars)
+}
+
+// charsField formats surviving characters for output, e.g. `chars=q:<>"',lang:none`
+func charsField(params []string, surviving map[string]string) string {
+	var fields []string
+	for _, param := range params {
+		chars, ok := surviving[param]
+		if !ok {
+			continue
+		}
+		if chars == "" {
+			chars = "none"
+		}
+		fields = append(fields, param+":"+chars)
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "chars=" + strings.Join(fields, ",")
+}
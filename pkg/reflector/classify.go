@@ -0,0 +1,240 @@
+package reflector
+
+import (
+	"bytes"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// vulnerability classes a reflection can point to, each needing a different follow-up
+const (
+	classXSS            = "reflected-xss-candidate"
+	classOpenRedirect   = "open-redirect"
+	classHeaderInject   = "header-injection"
+	classJSONP          = "jsonp"
+	classDOMSink        = "dom-sink"
+	classCachePoisoning = "cache-poisoning-candidate"
+	classRFD            = "rfd-candidate"
+)
+
+var (
+	// JavaScript that writes strings into the DOM or runs them
+	domSinkRegex = regexp.MustCompile(`(?i)(innerHTML|outerHTML|insertAdjacentHTML|document\.write|eval\s*\(|setTimeout\s*\(|setInterval\s*\(|new\s+Function|location(\.href)?\s*=|\.html\s*\()`)
+	// the attribute whose value a position inside a tag falls in
+	attrNameRegex = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*("[^"]*|'[^']*|[^\s"'>]*)$`)
+	// the start of the value of an attribute that navigates to it, e.g. href=" or content="0; url=
+	urlAttrRegex = regexp.MustCompile(`(?i)(href|src|action|formaction|data|content)\s*=\s*["']?\s*((https?:)?//|[0-9]+\s*;\s*url=)?$`)
+)
+
+// reflectedHeaders returns the parameters of the injection whose hash appears
+// in a response header, with the header it appeared in
+func (inj injection) reflectedHeaders(h *http.Header) map[string]string {
+	found := make(map[string]string)
+	if h == nil {
+		return found
+	}
+	for i, hash := range inj.Hashes {
+		if hash == "" {
+			continue
+		}
+		for name, values := range *h {
+			if strings.Contains(strings.Join(values, "\n"), canaryID(hash)) {
+				found[inj.Params[i]] = name
+			}
+		}
+	}
+	return found
+}
+
+// reflectionLocations says where in r each of params came back: a named response
+// header, a named attribute inside a tag, or the body text
+func reflectionLocations(r *colly.Response, inj injection, params []string) []string {
+	seen := make(map[string]bool)
+	var locations []string
+	add := func(location string) {
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+
+	headers := inj.reflectedHeaders(r.Headers)
+	for _, param := range params {
+		if name, ok := headers[param]; ok {
+			add("header:" + name)
+		}
+		hash := []byte(inj.hash(param))
+		for offset := 0; offset < len(r.Body); {
+			i := bytes.Index(r.Body[offset:], hash)
+			if i < 0 {
+				break
+			}
+			i += offset
+			offset = i + len(hash)
+
+			before := r.Body[:i]
+			if open := bytes.LastIndexByte(before, '<'); open > bytes.LastIndexByte(before, '>') {
+				if m := attrNameRegex.FindSubmatch(before[open:]); m != nil {
+					add("attribute:" + strings.ToLower(string(m[1])))
+					continue
+				}
+			}
+			add("body")
+		}
+	}
+	return locations
+}
+
+// hash returns what responses are searched for of the hash sent in param
+func (inj injection) hash(param string) string {
+	for i, name := range inj.Params {
+		if name == param {
+			return canaryID(inj.Hashes[i])
+		}
+	}
+	return ""
+}
+
+// reflectionClasses sorts a reflection of inj's params in r into vulnerability classes
+// from where each hash landed: response headers, a JSONP callback, an inline script,
+// a URL attribute, plain HTML or a response that downloads as a file
+func reflectionClasses(r *colly.Response, inj injection, params []string) []string {
+	classes := make(map[string]bool)
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	html := contentType == "" || strings.Contains(contentType, "html")
+	script := strings.Contains(contentType, "javascript") || strings.Contains(contentType, "json")
+	// reflected file download: what a link to the URL saves can be made to
+	// look like a script, and with a chosen name, like a batch file. That
+	// takes a response saved under a name the link picks: an attachment
+	// without a filename of its own, or one whose path came back with the
+	// hash in it, extension and all
+	download := unnamedAttachment(r.Headers) || (!html && pathReflected(r, inj, params))
+
+	headers := inj.reflectedHeaders(r.Headers)
+	for _, param := range params {
+		if name, ok := headers[param]; ok {
+			if name == "Location" || name == "Refresh" {
+				classes[classOpenRedirect] = true
+			} else {
+				classes[classHeaderInject] = true
+			}
+			// the name the file is saved under
+			if name == "Content-Disposition" {
+				classes[classRFD] = true
+			}
+		}
+
+		hash := []byte(inj.hash(param))
+		for offset := 0; offset < len(r.Body); {
+			i := bytes.Index(r.Body[offset:], hash)
+			if i < 0 {
+				break
+			}
+			i += offset
+			offset = i + len(hash)
+
+			if download {
+				classes[classRFD] = true
+			}
+			switch {
+			case script:
+				// the callback name is what JSONP endpoints reflect
+				if bytes.HasPrefix(bytes.TrimLeft(r.Body[offset:], " "), []byte("(")) {
+					classes[classJSONP] = true
+				}
+			case html:
+				classes[classXSS] = true
+				before := r.Body[:i]
+				if open := bytes.LastIndex(bytes.ToLower(before), []byte("<script")); open > bytes.LastIndex(bytes.ToLower(before), []byte("</script")) {
+					if domSinkRegex.Match(scriptBlock(r.Body, open)) {
+						classes[classDOMSink] = true
+					}
+				} else if urlAttrRegex.Match(tail(before, 64)) {
+					classes[classOpenRedirect] = true
+				}
+			}
+		}
+	}
+
+	// a reflection the cache keeps is served to everyone asking for the page
+	if len(classes) > 0 && r.Request.Method == "GET" && cacheable(r.Headers) {
+		classes[classCachePoisoning] = true
+	}
+
+	var list []string
+	for class := range classes {
+		list = append(list, class)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// unnamedAttachment reports whether a response downloads as a file named
+// after the URL it came from
+func unnamedAttachment(h *http.Header) bool {
+	if h == nil {
+		return false
+	}
+	disposition := strings.ToLower(h.Get("Content-Disposition"))
+	return strings.HasPrefix(strings.TrimSpace(disposition), "attachment") && !strings.Contains(disposition, "filename")
+}
+
+// pathReflected reports whether the hash of one of params came back from the
+// path of the request, which any link can then end in a name of its choosing
+func pathReflected(r *colly.Response, inj injection, params []string) bool {
+	for _, param := range params {
+		if hash := inj.hash(param); hash != "" && strings.Contains(r.Request.URL.Path, hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// scriptBlock returns the inline script starting at open, a sink anywhere in it
+// may end up using the reflected value
+func scriptBlock(body []byte, open int) []byte {
+	if end := bytes.Index(bytes.ToLower(body[open:]), []byte("</script")); end >= 0 {
+		return body[open : open+end]
+	}
+	return body[open:]
+}
+
+// tail returns at most the last n bytes of b
+func tail(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[len(b)-n:]
+	}
+	return b
+}
+
+// cacheable reports whether a shared cache may keep the response
+func cacheable(h *http.Header) bool {
+	if h == nil {
+		return false
+	}
+	// the cache already served or stored it
+	if h.Get("Age") != "" || strings.Contains(strings.ToLower(h.Get("X-Cache")+h.Get("CF-Cache-Status")), "hit") {
+		return true
+	}
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") || strings.Contains(cc, "no-cache") {
+		return false
+	}
+	if strings.Contains(cc, "public") {
+		return true
+	}
+	for _, directive := range strings.Split(cc, ",") {
+		parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+		if len(parts) == 2 && (parts[0] == "max-age" || parts[0] == "s-maxage") {
+			if age, err := strconv.Atoi(parts[1]); err == nil && age > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
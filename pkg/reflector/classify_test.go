@@ -0,0 +1,63 @@
+package reflector
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestReflectionClassesRFD(t *testing.T) {
+	const canary = "rflk8f2a9x0m3p_q"
+	inj := injection{Params: []string{"q"}, Hashes: []string{canary}}
+	tests := []struct {
+		name    string
+		link    string
+		headers http.Header
+		body    string
+		rfd     bool
+	}{
+		{
+			name:    "plain JSON echo",
+			link:    "https://example.com/api/search?q=" + canary,
+			headers: http.Header{"Content-Type": {"application/json"}},
+			body:    `{"query":"` + canary + `"}`,
+		},
+		{
+			name:    "attachment with a fixed filename",
+			link:    "https://example.com/api/export?q=" + canary,
+			headers: http.Header{"Content-Type": {"application/json"}, "Content-Disposition": {`attachment; filename="export.json"`}},
+			body:    `{"query":"` + canary + `"}`,
+		},
+		{
+			name:    "attachment named after the URL",
+			link:    "https://example.com/api/export?q=" + canary,
+			headers: http.Header{"Content-Type": {"application/json"}, "Content-Disposition": {"attachment"}},
+			body:    `{"query":"` + canary + `"}`,
+			rfd:     true,
+		},
+		{
+			name:    "hash in the path",
+			link:    "https://example.com/api/items/" + canary,
+			headers: http.Header{"Content-Type": {"application/json"}},
+			body:    `{"error":"no item ` + canary + `"}`,
+			rfd:     true,
+		},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &colly.Response{
+			StatusCode: http.StatusOK,
+			Body:       []byte(test.body),
+			Headers:    &test.headers,
+			Request:    &colly.Request{URL: u, Method: "GET"},
+		}
+		if rfd := containsString(reflectionClasses(r, inj, []string{"q"}), classRFD); rfd != test.rfd {
+			t.Errorf("%s: rfd-candidate is %v, want %v", test.name, rfd, test.rfd)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package reflector
+
+import (
+	"net/http"
+	"strings"
+)
+
+// framingProtection reports whether a page's headers stop other sites from framing it,
+// and describes what it found
+func framingProtection(h *http.Header) (string, bool) {
+	for _, policy := range h.Values("Content-Security-Policy") {
+		for _, directive := range strings.Split(policy, ";") {
+			fields := strings.Fields(strings.ToLower(directive))
+			if len(fields) == 0 || fields[0] != "frame-ancestors" {
+				continue
+			}
+			// frame-ancestors * allows any site, anything narrower counts as protection
+			if len(fields) == 2 && fields[1] == "*" {
+				return "frame-ancestors=*", false
+			}
+			return "frame-ancestors=" + strings.Join(fields[1:], ","), true
+		}
+	}
+	switch xfo := strings.ToUpper(strings.TrimSpace(h.Get("X-Frame-Options"))); xfo {
+	case "DENY", "SAMEORIGIN":
+		return "x-frame-options=" + strings.ToLower(xfo), true
+	case "":
+		return "x-frame-options=missing frame-ancestors=missing", false
+	default:
+		// ALLOW-FROM and anything else is ignored by current browsers
+		return "x-frame-options=" + strings.ToLower(strings.Fields(xfo)[0]) + " frame-ancestors=missing", false
+	}
+}
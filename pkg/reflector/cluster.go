@@ -0,0 +1,232 @@
+package reflector
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// pages whose template signatures differ in at most this many bits are one template
+	clusterDistance = 4
+	// pages with fewer tags than this are too bare to tell templates apart by,
+	// each is a cluster of its own
+	minTemplateTags = 16
+)
+
+var (
+	tagRegex       = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9-]*)([^>]*)>`)
+	tagAttrRegex   = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*(=\s*("[^"]*"|'[^']*'|[^\s"'>]*))?`)
+	htmlLangRegex  = regexp.MustCompile(`(?i)<html[^>]*\slang\s*=\s*["']?([a-zA-Z]{2,3})`)
+	scriptStyleTag = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	wordRegex      = regexp.MustCompile(`\p{L}+`)
+)
+
+// the most common words of the languages sites are most often localized to,
+// for pages that don't declare theirs
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "for", "with", "you", "your", "this"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "sie", "für", "auf"},
+	"fr": {"le", "la", "les", "et", "des", "est", "pour", "vous", "dans", "une"},
+	"es": {"el", "los", "las", "y", "del", "es", "para", "con", "una", "por"},
+	"it": {"il", "di", "che", "è", "per", "della", "con", "sono", "gli", "una"},
+	"pt": {"os", "do", "da", "não", "para", "com", "uma", "você", "seu", "são"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "voor", "met", "zijn"},
+}
+
+// templateSignature fingerprints the template page was built from: a simhash
+// over runs of three tags, each with its attribute names and its id and class,
+// so text and links, which change from locale to locale, don't count.
+// Pages with too few tags have no signature
+func templateSignature(page []byte) (uint64, bool) {
+	var tags []string
+	for _, m := range tagRegex.FindAllSubmatch(page, -1) {
+		tag := []string{strings.ToLower(string(m[1]))}
+		for _, attr := range tagAttrRegex.FindAllSubmatch(m[2], -1) {
+			name := strings.ToLower(string(attr[1]))
+			if name == "id" || name == "class" {
+				name += "=" + strings.Trim(string(attr[3]), `"'`)
+			}
+			tag = append(tag, name)
+		}
+		tags = append(tags, strings.Join(tag, " "))
+	}
+	if len(tags) < minTemplateTags {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+3 <= len(tags); i++ {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(tags[i:i+3], "\n")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var signature uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			signature |= 1 << uint(bit)
+		}
+	}
+	return signature, true
+}
+
+// pageLanguage is the language a page is in: what its html tag or
+// Content-Language header declares, or else the one whose common words
+// it uses most. Empty when there's no telling
+func pageLanguage(h *http.Header, page []byte) string {
+	if m := htmlLangRegex.FindSubmatch(page); m != nil {
+		return strings.ToLower(string(m[1]))
+	}
+	if h != nil {
+		if lang := strings.TrimSpace(strings.SplitN(h.Get("Content-Language"), ",", 2)[0]); lang != "" {
+			return strings.ToLower(strings.SplitN(lang, "-", 2)[0])
+		}
+	}
+
+	text := tagRegex.ReplaceAll(scriptStyleTag.ReplaceAll(page, nil), []byte(" "))
+	counts := make(map[string]int)
+	for _, word := range wordRegex.FindAll(text, 2000) {
+		counts[strings.ToLower(string(word))]++
+	}
+	var langs []string
+	for lang := range stopwords {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	best, bestScore := "", 0
+	for _, lang := range langs {
+		score := 0
+		for _, word := range stopwords[lang] {
+			score += counts[word]
+		}
+		if score > bestScore {
+			best, bestScore = lang, score
+		}
+	}
+	// a handful of matches is too few to tell languages sharing words apart
+	if bestScore < 5 {
+		return ""
+	}
+	return best
+}
+
+// templateClusters groups the pages of a target by template, so the same
+// page served in twenty locales is one cluster with one representative,
+// the first page of it crawled
+type templateClusters struct {
+	// with Options.Cluster, only representatives get per-page probes
+	representatives bool
+
+	mu       sync.Mutex
+	clusters []*templateCluster
+	pages    map[string]pageCluster
+	// pages that went without probes
+	skipped map[string]bool
+}
+
+type templateCluster struct {
+	id        string
+	signature uint64
+	first     string
+	// pages without a signature match nothing
+	matchable bool
+}
+
+type pageCluster struct {
+	cluster *templateCluster
+	lang    string
+}
+
+func newTemplateClusters(representatives bool) *templateClusters {
+	return &templateClusters{
+		representatives: representatives,
+		pages:           make(map[string]pageCluster),
+		skipped:         make(map[string]bool),
+	}
+}
+
+// assign puts the page at link into the cluster of its template, starting a
+// new one when it matches none. Each page is only assigned once
+func (t *templateClusters) assign(link string, h *http.Header, page []byte) {
+	t.mu.Lock()
+	if _, ok := t.pages[link]; ok {
+		t.mu.Unlock()
+		return
+	}
+	t.mu.Unlock()
+	signature, ok := templateSignature(page)
+	lang := pageLanguage(h, page)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.pages[link]; ok {
+		return
+	}
+	var cluster *templateCluster
+	for _, c := range t.clusters {
+		if ok && c.matchable && bits.OnesCount64(c.signature^signature) <= clusterDistance {
+			cluster = c
+			break
+		}
+	}
+	if cluster == nil {
+		cluster = &templateCluster{id: fmt.Sprintf("%08x", signature>>32), signature: signature, first: link, matchable: ok}
+		if !ok {
+			sum := fnv.New32a()
+			sum.Write([]byte(link))
+			cluster.id = fmt.Sprintf("%08x", sum.Sum32())
+		}
+		t.clusters = append(t.clusters, cluster)
+	}
+	t.pages[link] = pageCluster{cluster: cluster, lang: lang}
+}
+
+// skip reports whether the page at link goes without its per-page probes,
+// as another page of its cluster already had them
+func (t *templateClusters) skip(link string) bool {
+	if !t.representatives {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pc, ok := t.pages[link]
+	if !ok || pc.cluster.first == link {
+		return false
+	}
+	t.skipped[link] = true
+	return true
+}
+
+// field annotates a finding from the page at link with its cluster and language
+func (t *templateClusters) field(link string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	pc, ok := t.pages[link]
+	if !ok {
+		return ""
+	}
+	if pc.lang == "" {
+		return "cluster=" + pc.cluster.id
+	}
+	return "cluster=" + pc.cluster.id + " lang=" + pc.lang
+}
+
+// counts returns the pages clustered, the clusters they formed and the
+// pages that went unprobed for being in a cluster already probed
+func (t *templateClusters) counts() (int, int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.pages), len(t.clusters), len(t.skipped)
+}
@@ -0,0 +1,79 @@
+package reflector
+
+import (
+	"net/url"
+	"sync"
+)
+
+// limits on what observedValues remembers
+const (
+	maxObservedEndpoints = 10000
+	maxObservedParams    = 100
+)
+
+// observedValues remembers the first value each parameter of an endpoint
+// was seen with in the crawl's own traffic, e.g. cat=books from a link to
+// /search?q=shoes&cat=books. A probe fills the inputs it leaves alone with
+// them instead of blanks or made up values, as handlers often answer 400
+// when a companion parameter is missing, and the reflection goes unseen
+type observedValues struct {
+	mu        sync.Mutex
+	endpoints map[string]url.Values
+}
+
+func newObservedValues() *observedValues {
+	return &observedValues{endpoints: make(map[string]url.Values)}
+}
+
+// endpointKey identifies an endpoint by everything but its query and fragment
+func endpointKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host + u.Path
+}
+
+// observe records the values in u's query string
+func (o *observedValues) observe(u *url.URL) {
+	query := u.Query()
+	if len(query) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	key := endpointKey(u)
+	values, ok := o.endpoints[key]
+	if !ok {
+		if len(o.endpoints) >= maxObservedEndpoints {
+			return
+		}
+		values = url.Values{}
+		o.endpoints[key] = values
+	}
+	for name, v := range query {
+		if v[0] != "" && values.Get(name) == "" && len(values) < maxObservedParams {
+			values.Set(name, v[0])
+		}
+	}
+}
+
+// fill returns f with every input that has no value of its own given the
+// value it was observed with, if any
+func (o *observedValues) fill(f Form) Form {
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return f
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	values, ok := o.endpoints[endpointKey(u)]
+	if !ok {
+		return f
+	}
+	inputs := make([]Input, len(f.Inputs))
+	for i, in := range f.Inputs {
+		if in.Value == "" {
+			in.Value = values.Get(in.Name)
+		}
+		inputs[i] = in
+	}
+	f.Inputs = inputs
+	return f
+}
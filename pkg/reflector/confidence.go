@@ -0,0 +1,163 @@
+package reflector
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// confidence levels attached to reflection findings
+const (
+	// the probe's own response reflected somewhere code can run from, a
+	// re-send with fresh hashes did too and the rest of the page didn't change
+	confirmed = "confirmed"
+	// the probe's own response reflected but not all of that held
+	likely = "likely"
+	// seen somewhere other than the probe's own response, or only as a URL echo
+	tentative = "tentative"
+	// a marker element sent in its place rendered in a headless browser
+	browserVerified = "browser-verified"
+)
+
+// confidence levels from lowest to highest
+var confidenceLevels = []string{tentative, likely, confirmed, browserVerified}
+
+// ValidConfidence reports whether level is a confidence level
+func ValidConfidence(level string) bool {
+	return containsString(confidenceLevels, level)
+}
+
+// MeetsConfidence reports whether the result is at least as sure as min.
+// Results without a confidence, URLs and findings other than reflections,
+// always meet it
+func (r Result) MeetsConfidence(min string) bool {
+	if r.Reflection == nil || r.Reflection.Confidence == "" || min == "" {
+		return true
+	}
+	rank := func(level string) int {
+		for i, l := range confidenceLevels {
+			if l == level {
+				return i
+			}
+		}
+		return -1
+	}
+	return rank(r.Reflection.Confidence) >= rank(min)
+}
+
+// key identifies an injection by the hashes it sent
+func (inj injection) key() string {
+	return strings.Join(inj.Hashes, ",")
+}
+
+// contexts a reflection can't run code from, whatever gets through
+var inertContexts = []string{"comment", "script-comment"}
+
+// reflectionConfidence grades a reflection of inj's params in r, landing in
+// contexts. Fresh hashes sent to check it are registered through register
+func reflectionConfidence(p *prober, register func(injection) injection, r *colly.Response, inj injection, params []string, contexts map[string][]string, echo bool) string {
+	own, ok := r.Ctx.GetAny("injection").(injection)
+	if !ok || own.key() != inj.key() || echo {
+		return tentative
+	}
+	f, ok := r.Ctx.GetAny("form").(Form)
+	if !ok {
+		return likely
+	}
+	// a page that changes between two sends of the same probe, or that only
+	// shows the hash where it can't run, isn't sure
+	if reflected, stable := verifyReflection(p, register, r, f, inj, params); !reflected || !stable || inert(contexts) {
+		return likely
+	}
+	return confirmed
+}
+
+// inert reports whether every context of every param is one code can't run from
+func inert(contexts map[string][]string) bool {
+	if len(contexts) == 0 {
+		return false
+	}
+	for _, list := range contexts {
+		for _, context := range list {
+			if !containsString(inertContexts, context) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// verifyReflection re-sends the probe with fresh hashes in params and reports
+// whether any of them reflect again, and whether the page, hashes aside,
+// came back as it did in r
+func verifyReflection(p *prober, register func(injection) injection, r *colly.Response, f Form, inj injection, params []string) (reflected, stable bool) {
+	fresh := injection{
+		FormLocation: inj.FormLocation,
+		Page:         inj.Page,
+		Params:       inj.Params,
+		Hashes:       make([]string, len(inj.Hashes)),
+	}
+	for i, name := range inj.Params {
+		if inj.Hashes[i] != "" && containsString(params, name) {
+			fresh.Hashes[i] = newCanary(name)
+		}
+	}
+	fresh = register(fresh)
+
+	resp, body, err := p.submit(f, fresh)
+	if err != nil {
+		return false, false
+	}
+	reflected = len(fresh.reflectedIn(body, &resp.Header)) > 0
+	return reflected, similarPages(inj.strip(r.Body), fresh.strip(body))
+}
+
+// strip returns body without inj's hashes
+func (inj injection) strip(body []byte) []byte {
+	for _, hash := range inj.Hashes {
+		if hash != "" {
+			body = bytes.ReplaceAll(body, []byte(canaryID(hash)), nil)
+		}
+	}
+	return body
+}
+
+// at most this share of the tokens of two pages may differ for them to be the same page
+const maxPageDiff = 0.05
+
+// similarPages reports whether a and b differ in few enough of their tokens,
+// split on whitespace and tag brackets, e.g. just an anti-CSRF token or a timestamp
+func similarPages(a, b []byte) bool {
+	split := func(r rune) bool {
+		return r == '<' || r == '>' || unicode.IsSpace(r)
+	}
+	left, right := bytes.FieldsFunc(a, split), bytes.FieldsFunc(b, split)
+	counts := make(map[string]int)
+	for _, token := range left {
+		counts[string(token)]++
+	}
+	for _, token := range right {
+		counts[string(token)]--
+	}
+	diff := 0
+	for _, n := range counts {
+		if n < 0 {
+			n = -n
+		}
+		diff += n
+	}
+	total := len(left) + len(right)
+	return total == 0 || float64(diff) <= maxPageDiff*float64(total)
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
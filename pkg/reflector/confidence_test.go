@@ -0,0 +1,46 @@
+package reflector
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSimilarPages(t *testing.T) {
+	page := "<html><head><title>Search</title></head><body><h1>Results for rfla_q</h1>" + strings.Repeat("<p>result text here</p>", 20) + "</body></html>"
+	tests := []struct {
+		name    string
+		a, b    string
+		similar bool
+	}{
+		{name: "same", a: page, b: page, similar: true},
+		{name: "both empty", similar: true},
+		{name: "another token", a: page, b: strings.Replace(page, "<h1>", `<input name=csrf value=f00><h1>`, 1), similar: true},
+		{name: "reordered", a: page, b: strings.Replace(page, "<title>Search</title>", "", 1) + "<title>Search</title>", similar: true},
+		{name: "another page", a: page, b: "<html><body>Access denied</body></html>"},
+		{name: "half changed", a: page, b: strings.Replace(page, "result text here", "something else entirely", 10)},
+	}
+	for _, test := range tests {
+		if similar := similarPages([]byte(test.a), []byte(test.b)); similar != test.similar {
+			t.Errorf("%s: similar is %v, want %v", test.name, similar, test.similar)
+		}
+	}
+}
+
+func TestInert(t *testing.T) {
+	tests := []struct {
+		contexts map[string][]string
+		inert    bool
+	}{
+		{contexts: nil},
+		{contexts: map[string][]string{"q": {"comment"}}, inert: true},
+		{contexts: map[string][]string{"q": {"comment", "script-comment"}, "lang": {"comment"}}, inert: true},
+		{contexts: map[string][]string{"q": {"comment", "html"}}},
+		{contexts: map[string][]string{"q": {"comment"}, "lang": {"attribute-double"}}},
+		{contexts: map[string][]string{"q": {"header"}}},
+	}
+	for _, test := range tests {
+		if inert := inert(test.contexts); inert != test.inert {
+			t.Errorf("%v: inert is %v, want %v", test.contexts, inert, test.inert)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package reflector
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// consentSelectors are the accept buttons of common cookie consent
+// platforms and age gates, clicked before a rendered page is extracted
+// since their overlays keep the content behind them from loading
+var consentSelectors = []string{
+	// OneTrust
+	"#onetrust-accept-btn-handler",
+	// Cookiebot
+	"#CybotCookiebotDialogBodyLevelButtonLevelOptinAllowAll",
+	"#CybotCookiebotDialogBodyButtonAccept",
+	// Didomi
+	"#didomi-notice-agree-button",
+	// TrustArc
+	"#truste-consent-button",
+	// Quantcast Choice
+	".qc-cmp2-summary-buttons button[mode=primary]",
+	// Google Funding Choices
+	".fc-cta-consent",
+	// Osano / Cookie Consent
+	".cc-allow",
+	".cc-dismiss",
+	// CookieYes
+	".cky-btn-accept",
+	// Complianz
+	".cmplz-accept",
+	// Borlabs Cookie
+	"a[data-cookie-accept-all]",
+	// Klaro
+	".cm-btn-accept-all",
+	// Iubenda
+	".iubenda-cs-accept-btn",
+	// Termly
+	"[data-tid=banner-accept]",
+	// age gates
+	"#age-gate button[type=submit]",
+	".age-gate__submit--yes",
+	"[data-age-gate] [data-confirm]",
+	"#agegate-yes",
+}
+
+// dismissScript clicks every visible element matching the selectors it is
+// given and reports whether it clicked any
+const dismissScript = `(function(selectors) {
+	let clicked = false;
+	for (const selector of selectors) {
+		let elements;
+		try {
+			elements = document.querySelectorAll(selector);
+		} catch (e) {
+			continue;
+		}
+		for (const element of elements) {
+			if (element.getClientRects().length > 0) {
+				element.click();
+				clicked = true;
+			}
+		}
+	}
+	return clicked;
+})(%s)`
+
+// how long scripts get to build a rendered page, and to react to a dismissal
+const (
+	renderSettle  = 2 * time.Second
+	dismissSettle = 1500 * time.Millisecond
+)
+
+// renderDOM loads target in the crawl's session, dismisses any consent
+// banner or age gate matching b.dismiss and returns the DOM the page is
+// left with. Consent is never remembered, each page has a fresh profile
+func (b *browser) renderDOM(target string, session browserSession) ([]byte, error) {
+	d, err := b.openDevtools()
+	if err != nil {
+		return nil, err
+	}
+	defer d.close()
+	if err := d.useSession(target, session); err != nil {
+		return nil, err
+	}
+	if err := d.navigate(target, renderSettle); err != nil {
+		return nil, err
+	}
+
+	selectors, err := json.Marshal(b.dismiss)
+	if err != nil {
+		return nil, err
+	}
+	var clicked bool
+	if err := d.evaluate(fmt.Sprintf(dismissScript, selectors), &clicked); err != nil {
+		return nil, err
+	}
+	// an age gate may reload the page once passed
+	if clicked {
+		time.Sleep(dismissSettle)
+		if err := d.waitLoaded(0); err != nil {
+			return nil, err
+		}
+	}
+
+	var dom string
+	if err := d.evaluate("document.documentElement.outerHTML", &dom); err != nil {
+		return nil, err
+	}
+	return []byte(dom), nil
+}
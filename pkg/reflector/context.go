@@ -0,0 +1,156 @@
+package reflector
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// attributes whose value is a URL
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "data": true,
+	"poster": true, "background": true, "cite": true, "srcset": true, "xlink:href": true,
+}
+
+// reflectionContexts says, for each of params, the syntactic contexts its hash
+// landed in, which decide what it takes to break out of them:
+//
+//	html                    text between tags
+//	tag                     inside a tag, outside any attribute value
+//	attribute-<quote>       an attribute value quoted with double, single or no quotes
+//	url-<quote>             the same, for an attribute holding a URL
+//	script                  inline script code
+//	script-string-<quote>   a JavaScript string in double, single or template quotes
+//	script-comment          a JavaScript comment
+//	comment                 an HTML comment
+//	header                  a response header
+//	json, text              the body of a response that isn't HTML
+func reflectionContexts(r *colly.Response, inj injection, params []string) map[string][]string {
+	contexts := make(map[string][]string)
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	html := contentType == "" || strings.Contains(contentType, "html")
+
+	headers := inj.reflectedHeaders(r.Headers)
+	for _, param := range params {
+		seen := make(map[string]bool)
+		add := func(context string) {
+			if !seen[context] {
+				seen[context] = true
+				contexts[param] = append(contexts[param], context)
+			}
+		}
+		if _, ok := headers[param]; ok {
+			add("header")
+		}
+		hash := []byte(inj.hash(param))
+		for offset := 0; offset < len(r.Body); {
+			i := bytes.Index(r.Body[offset:], hash)
+			if i < 0 {
+				break
+			}
+			i += offset
+			offset = i + len(hash)
+
+			switch {
+			case html:
+				add(htmlContext(r.Body[:i]))
+			case strings.Contains(contentType, "javascript"):
+				add(scriptContext(r.Body[:i]))
+			case strings.Contains(contentType, "json"):
+				add("json")
+			default:
+				add("text")
+			}
+		}
+		sort.Strings(contexts[param])
+	}
+	return contexts
+}
+
+// htmlContext returns the context at the end of before, an HTML document up to a reflection
+func htmlContext(before []byte) string {
+	lower := bytes.ToLower(before)
+	if open := bytes.LastIndex(before, []byte("<!--")); open >= 0 && open > bytes.LastIndex(before, []byte("-->")) {
+		return "comment"
+	}
+	if open := bytes.LastIndex(lower, []byte("<script")); open >= 0 && open > bytes.LastIndex(lower, []byte("</script")) {
+		// still inside the opening tag, e.g. <script src="...">
+		if end := bytes.IndexByte(before[open:], '>'); end >= 0 {
+			return scriptContext(before[open+end+1:])
+		}
+	}
+	if open := bytes.LastIndexByte(before, '<'); open >= 0 && open > bytes.LastIndexByte(before, '>') {
+		m := attrNameRegex.FindSubmatch(before[open:])
+		if m == nil {
+			return "tag"
+		}
+		quote := "unquoted"
+		if len(m[2]) > 0 && m[2][0] == '"' {
+			quote = "double"
+		} else if len(m[2]) > 0 && m[2][0] == '\'' {
+			quote = "single"
+		}
+		if urlAttributes[strings.ToLower(string(m[1]))] {
+			return "url-" + quote
+		}
+		return "attribute-" + quote
+	}
+	return "html"
+}
+
+// scriptContext returns the context at the end of js, JavaScript up to a reflection.
+// Regular expression literals aren't told apart from division, a quote in one
+// can throw the result off
+func scriptContext(js []byte) string {
+	var quote byte
+	for i := 0; i < len(js); i++ {
+		c := js[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'' || c == '`':
+			quote = c
+		case c == '/' && i+1 < len(js) && js[i+1] == '/':
+			end := bytes.IndexByte(js[i:], '\n')
+			if end < 0 {
+				return "script-comment"
+			}
+			i += end
+		case c == '/' && i+1 < len(js) && js[i+1] == '*':
+			end := bytes.Index(js[i+2:], []byte("*/"))
+			if end < 0 {
+				return "script-comment"
+			}
+			i += end + 3
+		}
+	}
+	switch quote {
+	case '"':
+		return "script-string-double"
+	case '\'':
+		return "script-string-single"
+	case '`':
+		return "script-string-template"
+	}
+	return "script"
+}
+
+// contextField formats reflection contexts for output, e.g. "q:attribute-double,lang:html|script"
+func contextField(params []string, contexts map[string][]string) string {
+	var fields []string
+	for _, param := range params {
+		if len(contexts[param]) > 0 {
+			fields = append(fields, param+":"+strings.Join(contexts[param], "|"))
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "context=" + strings.Join(fields, ",")
+}
@@ -0,0 +1,81 @@
+package reflector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// cookieWatch remembers every cookie the crawl is sent, per host
+type cookieWatch struct {
+	mu       sync.Mutex
+	hosts    map[string]map[string]*http.Cookie
+	reported sync.Map
+}
+
+func newCookieWatch() *cookieWatch {
+	return &cookieWatch{hosts: make(map[string]map[string]*http.Cookie)}
+}
+
+// observe records the cookies set by a response from host and returns
+// the ones not seen from it before
+func (w *cookieWatch) observe(host string, h *http.Header) []*http.Cookie {
+	if h == nil || len(h.Values("Set-Cookie")) == 0 {
+		return nil
+	}
+	cookies := (&http.Response{Header: *h}).Cookies()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hosts[host] == nil {
+		w.hosts[host] = make(map[string]*http.Cookie)
+	}
+	var fresh []*http.Cookie
+	for _, cookie := range cookies {
+		if _, ok := w.hosts[host][cookie.Name]; !ok {
+			fresh = append(fresh, cookie)
+		}
+		w.hosts[host][cookie.Name] = cookie
+	}
+	return fresh
+}
+
+// cookieAudit reports a cookie's security attributes
+func cookieAudit(cookie *http.Cookie, page string, tags string) Result {
+	return Result{
+		Source: "cookie",
+		URL:    page,
+		Text:   fmt.Sprintf("Cookie %s set by %s", cookie.Name, page),
+		Fields: joinFields(fmt.Sprintf("secure=%t httponly=%t samesite=%s", cookie.Secure, cookie.HttpOnly, sameSiteName(cookie.SameSite)), tags),
+	}
+}
+
+// sameSiteName names a SameSite mode the way the attribute spells it
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "lax"
+	case http.SameSiteStrictMode:
+		return "strict"
+	case http.SameSiteNoneMode:
+		return "none"
+	case http.SameSiteDefaultMode:
+		return "invalid"
+	}
+	return "unset"
+}
+
+// unprotected returns the cookies from host that a cross-site POST would carry,
+// the ones without SameSite=Lax or Strict
+func (w *cookieWatch) unprotected(host string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var names []string
+	for name, cookie := range w.hosts[host] {
+		if cookie.SameSite != http.SameSiteLaxMode && cookie.SameSite != http.SameSiteStrictMode {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,62 @@
+package reflector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// paths that usually belong to an API rather than a page
+var apiPathRegex = regexp.MustCompile(`(?i)(/api/|/api$|/v[0-9]+/|/graphql|/rest/|\.json$)`)
+
+// corsChecker sends Origin probes to each API endpoint once
+type corsChecker struct {
+	seen sync.Map
+}
+
+// isAPIEndpoint reports whether a crawled response looks like an API
+func isAPIEndpoint(r *colly.Response) bool {
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	return strings.Contains(contentType, "json") || strings.Contains(contentType, "xml") && !strings.Contains(contentType, "html") ||
+		apiPathRegex.MatchString(r.Request.URL.Path)
+}
+
+// check probes target with an arbitrary and a null Origin and describes
+// each one the endpoint allows, credentials and all
+func (c *corsChecker) check(p *prober, target string) []string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil
+	}
+	endpoint := u.Scheme + "://" + u.Host + u.Path
+	if _, seen := c.seen.LoadOrStore(endpoint, true); seen {
+		return nil
+	}
+
+	probes := []struct {
+		name   string
+		origin string
+	}{
+		{"reflected", "https://" + strings.ToLower(randomString(8)) + ".com"},
+		{"null", "null"},
+	}
+	var findings []string
+	for _, probe := range probes {
+		resp, _, err := p.do("GET", target, nil, http.Header{"Origin": {probe.origin}})
+		if err != nil {
+			continue
+		}
+		allowed := resp.Header.Get("Access-Control-Allow-Origin")
+		if allowed != probe.origin {
+			continue
+		}
+		credentials := strings.EqualFold(resp.Header.Get("Access-Control-Allow-Credentials"), "true")
+		findings = append(findings, fmt.Sprintf("origin=%s credentials=%t", probe.name, credentials))
+	}
+	return findings
+}
@@ -0,0 +1,29 @@
+package reflector
+
+import (
+	"net/url"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// crossPage reports whether a reflection of inj in r is on another page
+// than the one its form was found on and submits to, rather than in the
+// response to its own probe: the value was stored and shown elsewhere,
+// like a profile page or a dashboard
+func crossPage(r *colly.Response, inj injection) bool {
+	if own, ok := r.Ctx.GetAny("injection").(injection); ok && own.key() == inj.key() {
+		return false
+	}
+	page := pageKey(r.Request.URL.String())
+	return page != pageKey(inj.Page) && page != pageKey(inj.FormLocation)
+}
+
+// pageKey identifies a page by scheme, host and path, so the same page
+// with another query string is still the same page
+func pageKey(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	return u.Scheme + "://" + u.Host + u.Path
+}
@@ -0,0 +1,148 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// input names that usually carry an anti-CSRF token
+var csrfFieldRegex = regexp.MustCompile(`(?i)(csrf|xsrf|authenticity|nonce|token|requestverification)`)
+
+// values shaped like a random token, long enough to be one
+var tokenValueRegex = regexp.MustCompile(`^[A-Za-z0-9+/=_.:-]{16,}$`)
+
+// minimum bits of entropy per character for a value to count as random
+const tokenEntropy = 3.0
+
+// hasCSRFToken reports whether a form sends anything that looks like an anti-CSRF token
+func hasCSRFToken(f Form) bool {
+	if len(f.Headers) > 0 {
+		return true
+	}
+	for _, in := range f.Inputs {
+		if csrfFieldRegex.MatchString(in.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfCandidate describes why a form could be forged cross-site, or returns ""
+// when it has a token, isn't a POST, or no cookie it would carry is known.
+// Each form is only described once per run
+func (w *cookieWatch) csrfCandidate(f Form, page string, host string, sessionCookie bool) string {
+	if f.Method != "POST" || hasCSRFToken(f) {
+		return ""
+	}
+	var reasons []string
+	if cookies := w.unprotected(host); len(cookies) > 0 {
+		reasons = append(reasons, "cookies without SameSite: "+strings.Join(cookies, ", "))
+	}
+	// session cookies from -h never come back in Set-Cookie, their SameSite is unknown
+	if sessionCookie {
+		reasons = append(reasons, "configured session cookie")
+	}
+	if len(reasons) == 0 {
+		return ""
+	}
+	if _, seen := w.reported.LoadOrStore(f.Method+" "+f.URL, true); seen {
+		return ""
+	}
+	return fmt.Sprintf("Possible CSRF on %s %s from %s: no token, %s", f.Method, f.URL, page, strings.Join(reasons, ", "))
+}
+
+// csrfTokenInputs returns the hidden inputs of f that look like anti-CSRF
+// tokens, by name or by a random looking value
+func csrfTokenInputs(f Form) []string {
+	var names []string
+	for _, in := range f.Inputs {
+		if in.Type == "hidden" && (csrfFieldRegex.MatchString(in.Name) || randomLooking(in.Value)) {
+			names = append(names, in.Name)
+		}
+	}
+	return names
+}
+
+// randomLooking reports whether a value has the shape and entropy of a random token
+func randomLooking(value string) bool {
+	if !tokenValueRegex.MatchString(value) {
+		return false
+	}
+	counts := make(map[rune]int)
+	for _, c := range value {
+		counts[c]++
+	}
+	entropy := 0.0
+	for _, n := range counts {
+		p := float64(n) / float64(len(value))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= tokenEntropy
+}
+
+// freshTokens fetches the page f was found on again and returns f with the
+// anti-CSRF tokens it now carries, in the form's inputs and the headers of
+// meta tag tokens. f comes back as it was when it has no tokens or the page
+// can't be fetched, the probe is still worth sending
+func (p *prober) freshTokens(f Form) Form {
+	names := csrfTokenInputs(f)
+	if len(names) == 0 || f.Page == "" {
+		return f
+	}
+	resp, body, err := p.do("GET", f.Page, nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return f
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return f
+	}
+
+	// the same form on the fresh page, any input of the same name elsewhere will do too
+	tokens := make(map[string]string)
+	doc.Find("form").EachWithBreak(func(_ int, form *goquery.Selection) bool {
+		method, action, values := formDefaults(form, resp.Request.URL)
+		if method != f.Method || action != f.URL {
+			return true
+		}
+		for _, name := range names {
+			if _, ok := values[name]; ok {
+				tokens[name] = values.Get(name)
+			}
+		}
+		return false
+	})
+	for _, name := range names {
+		if _, ok := tokens[name]; !ok {
+			if value, ok := doc.Find("input[name='" + name + "']").Attr("value"); ok {
+				tokens[name] = value
+			}
+		}
+	}
+
+	fresh := f
+	fresh.Inputs = append([]Input(nil), f.Inputs...)
+	for i, in := range fresh.Inputs {
+		if token, ok := tokens[in.Name]; ok {
+			fresh.Inputs[i].Value = token
+		}
+	}
+	if f.Headers != nil {
+		fresh.Headers = f.Headers.Clone()
+		for _, extractor := range tokenExtractors {
+			if extractor.Header == "" || fresh.Headers.Get(extractor.Header) == "" {
+				continue
+			}
+			if token, ok := doc.Find("meta[name='" + extractor.Meta + "']").Attr("content"); ok && token != "" {
+				fresh.Headers.Set(extractor.Header, token)
+			}
+		}
+	}
+	return fresh
+}
@@ -0,0 +1,103 @@
+package reflector
+
+import (
+	"sync"
+	"time"
+)
+
+// depthBudget caps how long a crawl keeps requesting pages at any one depth,
+// so huge flat sites can't starve the deeper levels, with a deadline, how
+// long the crawl keeps requesting anything at all, and with maxPages, how
+// many pages it requests
+type depthBudget struct {
+	mu       sync.Mutex
+	budget   time.Duration
+	started  map[int]time.Time
+	deadline time.Time
+	// something was skipped because the deadline passed
+	cut bool
+	// pages taken so far out of maxPages, 0 for no limit, and whether a
+	// page was skipped because they ran out
+	maxPages int
+	pages    int
+	full     bool
+}
+
+// newDepthBudget returns a budget of d per depth, zero means no limit
+func newDepthBudget(d time.Duration) *depthBudget {
+	return &depthBudget{
+		budget:  d,
+		started: make(map[int]time.Time),
+	}
+}
+
+// allow reports whether a request at depth is still within budget,
+// the clock for each depth starts with its first request
+func (b *depthBudget) allow(depth int) bool {
+	if b.expired() {
+		return false
+	}
+	if b.budget <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	start, ok := b.started[depth]
+	if !ok {
+		b.started[depth] = time.Now()
+		return true
+	}
+	return time.Since(start) < b.budget
+}
+
+// expired reports whether the deadline has passed, recording that
+// whatever asked is skipped because of it
+func (b *depthBudget) expired() bool {
+	if b.deadline.IsZero() || time.Now().Before(b.deadline) {
+		return false
+	}
+	b.mu.Lock()
+	b.cut = true
+	b.mu.Unlock()
+	return true
+}
+
+// cutShort reports whether the deadline ended the crawl early
+func (b *depthBudget) cutShort() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cut
+}
+
+// take reserves one of the pages of the budget for a link about to be
+// visited, false once they are all taken
+func (b *depthBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxPages <= 0 {
+		return true
+	}
+	if b.pages >= b.maxPages {
+		b.full = true
+		return false
+	}
+	b.pages++
+	return true
+}
+
+// release gives back the page taken for a link colly wouldn't visit,
+// e.g. one past the maximum depth or outside the allowed domains
+func (b *depthBudget) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.maxPages > 0 && b.pages > 0 {
+		b.pages--
+	}
+}
+
+// exhausted reports whether links were skipped because every page was taken
+func (b *depthBudget) exhausted() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.full
+}
@@ -0,0 +1,368 @@
+package reflector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// devtools is a connection to one page of the headless Chrome over the
+// DevTools protocol, for when a page has to be interacted with rather
+// than just dumped. Each page gets a browser context of its own, a fresh
+// profile that remembers no consent and shares no cookies with the others
+type devtools struct {
+	conn     *websocket.Conn
+	id       int
+	deadline time.Time
+	// the page's context and the session its commands go to
+	context string
+	session string
+}
+
+// devtoolsMessage is a DevTools protocol response or event
+type devtoolsMessage struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// start launches the browser with remote debugging unless it is running
+// already and returns its DevTools endpoint. One browser serves the whole
+// run, started again if it dies
+func (b *browser) start() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.endpoint != "" {
+		return b.endpoint, nil
+	}
+	profile, err := ioutil.TempDir("", "go-reflect-chrome-")
+	if err != nil {
+		return "", err
+	}
+	args := []string{"--headless", "--disable-gpu", "--ignore-certificate-errors", "--remote-debugging-port=0", "--remote-allow-origins=*", "--user-data-dir=" + profile}
+	// Chrome refuses to run as root with its sandbox on
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	if b.proxy != "" {
+		args = append(args, "--proxy-server="+b.proxy)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, b.path, append(args, "about:blank")...)
+	stderr, err := cmd.StderrPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		cancel()
+		os.RemoveAll(profile)
+		return "", err
+	}
+	go func() {
+		cmd.Wait()
+		os.RemoveAll(profile)
+		b.mu.Lock()
+		if b.running == cmd {
+			b.endpoint, b.running, b.stop = "", nil, nil
+		}
+		b.mu.Unlock()
+	}()
+
+	// the debugging port is picked by Chrome and announced on stderr
+	slow := time.AfterFunc(b.timeout, cancel)
+	endpoint := ""
+	scanner := bufio.NewScanner(stderr)
+	for scanner.Scan() {
+		if i := strings.Index(scanner.Text(), "DevTools listening on "); i >= 0 {
+			endpoint = strings.TrimSpace(scanner.Text()[i+len("DevTools listening on "):])
+			break
+		}
+	}
+	slow.Stop()
+	if endpoint == "" {
+		cancel()
+		return "", errors.New("browser didn't start remote debugging")
+	}
+	go io.Copy(ioutil.Discard, stderr)
+	b.endpoint, b.running, b.stop = endpoint, cmd, cancel
+	return endpoint, nil
+}
+
+// close stops the browser, the next page starts it again
+func (b *browser) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop != nil {
+		b.stop()
+	}
+	b.endpoint, b.running, b.stop = "", nil, nil
+}
+
+// openDevtools opens a blank page in a browser context of its own and
+// connects to it, until the browser's timeout from now
+func (b *browser) openDevtools() (*devtools, error) {
+	endpoint, err := b.start()
+	if err != nil {
+		return nil, err
+	}
+	browserURL, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := websocket.Dial(endpoint, "", "http://"+browserURL.Host)
+	if err != nil {
+		return nil, err
+	}
+	d := &devtools{conn: conn, deadline: time.Now().Add(b.timeout)}
+	conn.SetDeadline(d.deadline)
+
+	var created struct {
+		ID string `json:"browserContextId"`
+	}
+	params := map[string]interface{}{}
+	if b.proxy != "" {
+		params["proxyServer"] = b.proxy
+	}
+	if err := d.send("", "Target.createBrowserContext", params, &created); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	d.context = created.ID
+	var page struct {
+		ID string `json:"targetId"`
+	}
+	if err := d.send("", "Target.createTarget", map[string]string{"url": "about:blank", "browserContextId": d.context}, &page); err != nil {
+		d.close()
+		return nil, err
+	}
+	var attached struct {
+		ID string `json:"sessionId"`
+	}
+	if err := d.send("", "Target.attachToTarget", map[string]interface{}{"targetId": page.ID, "flatten": true}, &attached); err != nil {
+		d.close()
+		return nil, err
+	}
+	d.session = attached.ID
+	return d, nil
+}
+
+// browserSession is what the crawl sends with a page's requests, so the
+// browser loads the page the way the crawl saw it
+type browserSession struct {
+	// the headers the request went out with, Cookie and User-Agent among them
+	headers http.Header
+	// the cookies of the crawl's jar for the page
+	cookies []*http.Cookie
+}
+
+// useSession makes the page send the session's headers and cookies for
+// target. The headers go with every request the page makes, the cookies
+// only to target's host
+func (d *devtools) useSession(target string, s browserSession) error {
+	if err := d.call("Network.enable", nil, nil); err != nil {
+		return err
+	}
+	if agent := s.headers.Get("User-Agent"); agent != "" {
+		if err := d.call("Network.setUserAgentOverride", map[string]string{"userAgent": agent}, nil); err != nil {
+			return err
+		}
+	}
+	extra := make(map[string]string)
+	for name, values := range s.headers {
+		switch name {
+		// Chrome sets these itself
+		case "Cookie", "User-Agent", "Host", "Content-Length", "Content-Type", "Accept-Encoding":
+			continue
+		}
+		extra[name] = strings.Join(values, ", ")
+	}
+	if len(extra) > 0 {
+		if err := d.call("Network.setExtraHTTPHeaders", map[string]interface{}{"headers": extra}, nil); err != nil {
+			return err
+		}
+	}
+	cookies := append([]*http.Cookie(nil), s.cookies...)
+	if header := s.headers.Get("Cookie"); header != "" {
+		cookies = append(cookies, (&http.Request{Header: http.Header{"Cookie": {header}}}).Cookies()...)
+	}
+	if len(cookies) == 0 {
+		return nil
+	}
+	var params []map[string]string
+	for _, c := range cookies {
+		params = append(params, map[string]string{"name": c.Name, "value": c.Value, "url": target, "path": "/"})
+	}
+	return d.call("Network.setCookies", map[string]interface{}{"cookies": params}, nil)
+}
+
+// call sends a DevTools command to the page and decodes its result
+func (d *devtools) call(method string, params interface{}, result interface{}) error {
+	return d.send(d.session, method, params, result)
+}
+
+// send sends a DevTools command to session, the browser itself if it is
+// empty, and decodes its result, skipping the events sent meanwhile
+func (d *devtools) send(session, method string, params interface{}, result interface{}) error {
+	d.id++
+	command := map[string]interface{}{"id": d.id, "method": method}
+	if params != nil {
+		command["params"] = params
+	}
+	if session != "" {
+		command["sessionId"] = session
+	}
+	if err := websocket.JSON.Send(d.conn, command); err != nil {
+		return err
+	}
+	for {
+		var msg devtoolsMessage
+		if err := websocket.JSON.Receive(d.conn, &msg); err != nil {
+			return err
+		}
+		if msg.ID != d.id {
+			continue
+		}
+		if msg.Error != nil {
+			return fmt.Errorf("%s: %s", method, msg.Error.Message)
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// evaluate runs a JavaScript expression in the page and decodes its value
+func (d *devtools) evaluate(expression string, value interface{}) error {
+	var result struct {
+		Result struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"result"`
+		Exception *struct {
+			Text string `json:"text"`
+		} `json:"exceptionDetails"`
+	}
+	params := map[string]interface{}{"expression": expression, "returnByValue": true}
+	if err := d.call("Runtime.evaluate", params, &result); err != nil {
+		return err
+	}
+	if result.Exception != nil {
+		return errors.New(result.Exception.Text)
+	}
+	return json.Unmarshal(result.Result.Value, value)
+}
+
+// navigate loads target and waits for it to finish loading, then settle
+// longer for scripts to build the page
+func (d *devtools) navigate(target string, settle time.Duration) error {
+	if err := d.call("Page.navigate", map[string]string{"url": target}, nil); err != nil {
+		return err
+	}
+	return d.waitLoaded(settle)
+}
+
+// waitLoaded polls until the document has loaded, then waits settle. A
+// page that submitted a form hasn't loaded until the response replaces it
+func (d *devtools) waitLoaded(settle time.Duration) error {
+	for {
+		var state string
+		// evaluating fails while a navigation swaps the document
+		if err := d.evaluate(`window.rflSubmitted ? "" : document.readyState`, &state); err == nil && state == "complete" {
+			break
+		}
+		if time.Now().After(d.deadline) {
+			return errors.New("timed out waiting for the page to load")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(settle)
+	return nil
+}
+
+// load sends a probe of f, a GET is navigated to and a POST submitted
+// from the page the form was found on, the way a user would send it, then
+// waits settle
+func (d *devtools) load(f Form, inj injection, settle time.Duration) error {
+	target := string(generateFormData(f, inj))
+	if f.Method != "POST" {
+		return d.navigate(target, settle)
+	}
+	from := f.Page
+	if from == "" {
+		u, err := url.Parse(f.URL)
+		if err != nil {
+			return err
+		}
+		from = u.Scheme + "://" + u.Host + "/"
+	}
+	if err := d.navigate(from, 0); err != nil {
+		return err
+	}
+	var fields [][2]string
+	for _, pair := range strings.Split(target, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+		name, _ = url.QueryUnescape(name)
+		value, _ = url.QueryUnescape(value)
+		fields = append(fields, [2]string{name, value})
+	}
+	action, err := json.Marshal(f.URL)
+	if err != nil {
+		return err
+	}
+	list, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	var ignored interface{}
+	if err := d.evaluate(fmt.Sprintf(submitScript, action, list), &ignored); err != nil {
+		return err
+	}
+	return d.waitLoaded(settle)
+}
+
+// submitScript POSTs the fields it is given to the action it is given from
+// the page, marking the page so waitLoaded waits for the response
+const submitScript = `(function(action, fields) {
+	var form = document.createElement("form");
+	form.method = "POST";
+	form.action = action;
+	for (var i = 0; i < fields.length; i++) {
+		var input = document.createElement("input");
+		input.type = "hidden";
+		input.name = fields[i][0];
+		input.value = fields[i][1];
+		form.appendChild(input);
+	}
+	(document.body || document.documentElement).appendChild(form);
+	window.rflSubmitted = true;
+	HTMLFormElement.prototype.submit.call(form);
+	return true;
+})(%s, %s)`
+
+// close closes the page along with its browser context
+func (d *devtools) close() {
+	if d.context != "" {
+		d.send("", "Target.disposeBrowserContext", map[string]string{"browserContextId": d.context}, nil)
+	}
+	d.conn.Close()
+}
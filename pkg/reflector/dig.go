@@ -0,0 +1,179 @@
+package reflector
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+var (
+	digURLRegex = regexp.MustCompile(`\bhttps?://[^\s"'<>()]+`)
+	// root relative paths, e.g. "see /debug/vars"
+	digPathRegex = regexp.MustCompile(`(?:^|[\s"'(=])(/[A-Za-z0-9_~%-][A-Za-z0-9_~%./-]*(?:\?[^\s"'<>()]*)?)`)
+	// hosts that only resolve inside a network, or that name a non-production environment
+	digHostRegex  = regexp.MustCompile(`(?i)\b(?:[a-z0-9-]+\.)+(?:internal|local|localdomain|lan|corp|intranet|private)\b|\b(?:[a-z0-9-]+\.)*(?:staging|stage|dev|test|qa|uat|preprod|sandbox)[0-9]*(?:[.-][a-z0-9-]+)*\.[a-z]{2,}\b|\b(?:10\.\d{1,3}|172\.(?:1[6-9]|2\d|3[01])|192\.168)\.\d{1,3}\.\d{1,3}\b`)
+	digEmailRegex = regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)
+	// assignments to credential-like names and the shapes of well-known keys
+	digCredentialRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:password|passwd|pwd|secret|api[_-]?key|access[_-]?key|auth[_-]?token|token)\s*[:=]\s*["']?[^\s"'<>,;]{4,}`),
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+		regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36}\b`),
+		regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`),
+		regexp.MustCompile(`\beyJ[a-zA-Z0-9_-]{5,}\.eyJ[a-zA-Z0-9_-]{5,}\.[a-zA-Z0-9_-]*`),
+		regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`),
+	}
+	// meta tags every page has, not worth digging through
+	dullMetas = map[string]bool{"viewport": true, "charset": true, "theme-color": true, "robots": true, "format-detection": true}
+)
+
+// digger reads HTML comments and meta tags for URLs, internal hosts, emails
+// and credentials developers left behind, each comment or tag once per
+// target since templates repeat them on every page
+type digger struct {
+	seen sync.Map
+}
+
+// dug is what a comment or meta tag gave away
+type dug struct {
+	urls, hosts, emails, credentials []string
+}
+
+func (d dug) empty() bool {
+	return len(d.urls)+len(d.hosts)+len(d.emails)+len(d.credentials) == 0
+}
+
+func (d dug) fields() string {
+	var fields []string
+	for _, f := range []struct {
+		name   string
+		values []string
+	}{{"urls", d.urls}, {"hosts", d.hosts}, {"emails", d.emails}, {"credentials", d.credentials}} {
+		if len(f.values) > 0 {
+			fields = append(fields, f.name+"="+strings.Join(f.values, ","))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// digText returns what text gives away, each thing once
+func digText(text string) dug {
+	var d dug
+	seen := make(map[string]bool)
+	add := func(list *[]string, value string) {
+		value = strings.TrimRight(value, ".,;:")
+		if value != "" && !seen[value] {
+			seen[value] = true
+			*list = append(*list, value)
+		}
+	}
+	for _, link := range digURLRegex.FindAllString(text, -1) {
+		add(&d.urls, link)
+	}
+	for _, m := range digPathRegex.FindAllStringSubmatch(text, -1) {
+		add(&d.urls, m[1])
+	}
+	for _, host := range digHostRegex.FindAllString(text, -1) {
+		add(&d.hosts, strings.ToLower(host))
+	}
+	for _, email := range digEmailRegex.FindAllString(text, -1) {
+		add(&d.emails, email)
+	}
+	for _, regex := range digCredentialRegexes {
+		for _, credential := range regex.FindAllString(text, -1) {
+			// fields are space separated
+			add(&d.credentials, strings.Join(strings.Fields(credential), ""))
+		}
+	}
+	return d
+}
+
+// dig returns a comment or meta result for each comment and meta tag in
+// body that gives something away and wasn't seen on an earlier page, and
+// the URLs they mention, for crawling
+func (g *digger) dig(body []byte, page, tags string) ([]Result, []string) {
+	var results []Result
+	var links []string
+	report := func(source, what, text, field string) {
+		if _, seen := g.seen.LoadOrStore(fmt.Sprintf("%s %x", source, sha1.Sum([]byte(text))), true); seen {
+			return
+		}
+		d := digText(text)
+		if source == "meta" {
+			d.urls = foreignURLs(d.urls, page)
+		}
+		if d.empty() {
+			return
+		}
+		results = append(results, Result{
+			Source: source,
+			URL:    page,
+			Text:   fmt.Sprintf("%s on %s: %s", what, page, excerpt(text, 120)),
+			Fields: joinFields(field, d.fields(), tags),
+		})
+		links = append(links, d.urls...)
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return results, links
+		case html.CommentToken:
+			report("comment", "Comment", string(z.Text()), "")
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			if token.Data != "meta" {
+				continue
+			}
+			var name, content string
+			for _, a := range token.Attr {
+				switch a.Key {
+				case "name", "property", "http-equiv", "itemprop":
+					if name == "" {
+						name = strings.ToLower(a.Val)
+					}
+				case "content":
+					content = a.Val
+				}
+			}
+			if name != "" && content != "" && !dullMetas[name] && name != "refresh" {
+				report("meta", "Meta "+name, content, "meta="+unsafeFieldChars.ReplaceAllString(name, "_"))
+			}
+		}
+	}
+}
+
+// foreignURLs returns the absolute URLs of links on other hosts than page,
+// meta tags point at the page itself and its images all the time
+func foreignURLs(links []string, page string) []string {
+	own, err := url.Parse(page)
+	if err != nil {
+		return nil
+	}
+	var foreign []string
+	for _, link := range links {
+		if u, err := url.Parse(link); err == nil && u.Host != "" && !strings.EqualFold(u.Host, own.Host) {
+			foreign = append(foreign, link)
+		}
+	}
+	return foreign
+}
+
+// unsafeFieldChars are replaced in values put in output fields
+var unsafeFieldChars = regexp.MustCompile(`[\s=]`)
+
+// excerpt collapses the whitespace in text and cuts it to n characters
+func excerpt(text string, n int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) > n {
+		return string(runes[:n]) + "..."
+	}
+	return string(runes)
+}
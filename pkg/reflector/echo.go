@@ -0,0 +1,93 @@
+package reflector
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+// urlEcho tells a page that echoes the request URL (e.g. "Not found: /x?q=HASH")
+// apart from a genuine parameter sink. It sends a path-only probe, with a hash
+// in a path segment of its own and the original query, an unknown-parameter
+// probe, where the hash sits in a parameter the app can't know about, and a
+// param-only probe with fresh hashes in the real parameters. It returns the
+// parts of the URL the page echoes, path and query, and whether the
+// reflection is only an echo: the unknown-parameter probe reflects and every
+// param-only reflection sits inside an echoed query string
+func urlEcho(p *prober, probeURL string, params []string) (parts []string, echo bool) {
+	u, err := url.Parse(probeURL)
+	if err != nil {
+		return nil, false
+	}
+	original := u.Query()
+
+	// path-only: the query as the probe sent it, the hash in an extra segment
+	pathHash := newCanary(probePath)
+	pathOnly := *u
+	pathOnly.Path = strings.TrimSuffix(u.Path, "/") + "/" + pathHash
+	pathOnly.RawPath = ""
+	if _, body, err := p.do("GET", pathOnly.String(), nil, nil); err == nil && bytes.Contains(body, []byte(pathHash)) {
+		parts = append(parts, "path")
+	}
+
+	// unknown-parameter: real parameters get plain values, the hash goes in a bogus one
+	unknownHash := newCanary("")
+	unknownQuery := url.Values{}
+	for name := range original {
+		unknownQuery.Set(name, "1")
+	}
+	unknownQuery.Set(unknownHash, "1")
+	unknown := *u
+	unknown.RawQuery = unknownQuery.Encode()
+	_, body, err := p.do("GET", unknown.String(), nil, nil)
+	if err != nil || !bytes.Contains(body, []byte(unknownHash)) {
+		return parts, false
+	}
+	parts = append(parts, "query")
+
+	// param-only: fresh hashes in the reflecting parameters
+	paramQuery := url.Values{}
+	for name, values := range original {
+		paramQuery[name] = values
+	}
+	hashes := make(map[string]string)
+	for _, name := range params {
+		hashes[name] = newCanary(name)
+		paramQuery.Set(name, hashes[name])
+	}
+	paramOnly := *u
+	paramOnly.RawQuery = paramQuery.Encode()
+	_, body, err = p.do("GET", paramOnly.String(), nil, nil)
+	if err != nil {
+		return parts, false
+	}
+	for name, hash := range hashes {
+		if reflectsOutsideQuery(body, name, hash) {
+			return parts, false
+		}
+	}
+	return parts, true
+}
+
+// reflectsOutsideQuery reports whether hash shows up anywhere other than
+// right after "name=" as part of an echoed query string
+func reflectsOutsideQuery(body []byte, name, hash string) bool {
+	prefixes := [][]byte{[]byte(name + "="), []byte(url.QueryEscape(name) + "=")}
+	for offset := 0; ; {
+		i := bytes.Index(body[offset:], []byte(hash))
+		if i < 0 {
+			return false
+		}
+		i += offset
+		echoed := false
+		for _, prefix := range prefixes {
+			if bytes.HasSuffix(body[:i], prefix) {
+				echoed = true
+			}
+		}
+		if !echoed {
+			return true
+		}
+		offset = i + len(hash)
+	}
+}
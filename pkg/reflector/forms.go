@@ -0,0 +1,360 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// Input is a form field as it would be submitted
+type Input struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Form is a form ready to be submitted: where, how, and with which fields,
+// and the page it was found on
+type Form struct {
+	URL     string
+	Method  string
+	Inputs  []Input
+	Headers http.Header
+	Page    string
+	// the page's language, e.g. de-DE, for filling in dates and amounts
+	Lang string
+}
+
+// selects every element that can submit a form when clicked, a button with
+// a missing or unknown type is a submit button
+const submitSelector = "button:not([type=reset i]):not([type=button i]), input[type=submit i], input[type=image i]"
+
+// parseForm reads a <form> element the way a browser would submit it, returning
+// one variant per distinct submit button since each can apply its own
+// formaction/formmethod and send its own name/value
+func parseForm(e *colly.HTMLElement) []Form {
+	base := Form{
+		URL:    formAction(e, e.Attr("action")),
+		Method: formMethod(e.Attr("method")),
+		Page:   e.Request.URL.String(),
+		Lang:   formLang(e),
+	}
+
+	e.ForEach("input", func(_ int, e *colly.HTMLElement) {
+		switch strings.ToLower(e.Attr("type")) {
+		case "submit", "image", "reset", "button":
+			// only the submitter sends its value, see below
+			return
+		}
+		if e.Attr("name") == "" {
+			return
+		}
+		base.Inputs = append(base.Inputs, Input{
+			Type:  strings.ToLower(e.Attr("type")),
+			Name:  e.Attr("name"),
+			Value: e.Attr("value"),
+		})
+	})
+	e.ForEach("textarea", func(_ int, e *colly.HTMLElement) {
+		if e.Attr("name") == "" {
+			return
+		}
+		base.Inputs = append(base.Inputs, Input{
+			Type:  "text",
+			Name:  e.Attr("name"),
+			Value: e.Attr("value"),
+		})
+	})
+	// a select sends its selected option, or its first one
+	e.ForEach("select", func(_ int, e *colly.HTMLElement) {
+		if e.Attr("name") == "" {
+			return
+		}
+		option := e.DOM.Find("option[selected]").First()
+		if option.Length() == 0 {
+			option = e.DOM.Find("option").First()
+		}
+		value, ok := option.Attr("value")
+		if !ok {
+			value = strings.TrimSpace(option.Text())
+		}
+		base.Inputs = append(base.Inputs, Input{
+			Type:  "select",
+			Name:  e.Attr("name"),
+			Value: value,
+		})
+	})
+
+	// framework tokens have to go back as they are or the probe gets rejected
+	applyTokenExtractors(&base, e.DOM.Parents().Last())
+
+	var variants []Form
+	seen := make(map[string]bool)
+	e.ForEach(submitSelector, func(_ int, button *colly.HTMLElement) {
+		f := base
+		f.Inputs = append([]Input(nil), base.Inputs...)
+		if action, ok := button.DOM.Attr("formaction"); ok {
+			f.URL = formAction(e, action)
+		}
+		if method, ok := button.DOM.Attr("formmethod"); ok {
+			f.Method = formMethod(method)
+		}
+		name := button.Attr("name")
+		if name != "" {
+			f.Inputs = append(f.Inputs, Input{
+				Type:  "submit",
+				Name:  name,
+				Value: button.Attr("value"),
+			})
+		}
+
+		// buttons that would send the exact same request only need one probe
+		key := f.Method + " " + f.URL + " " + name + "=" + button.Attr("value")
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		variants = append(variants, f)
+	})
+
+	// forms without a button can still be submitted with enter
+	if len(variants) == 0 {
+		variants = append(variants, base)
+	}
+	return variants
+}
+
+// formMethod normalizes a method or formmethod attribute,
+// anything missing or unknown falls back to GET like browsers do
+func formMethod(method string) string {
+	switch strings.ToLower(strings.TrimSpace(method)) {
+	case "post":
+		return "POST"
+	case "dialog":
+		return "DIALOG"
+	default:
+		return "GET"
+	}
+}
+
+// formAction resolves an action or formaction attribute,
+// an empty or fragment-only action submits to the current page
+func formAction(e *colly.HTMLElement, action string) string {
+	if u := e.Request.AbsoluteURL(strings.TrimSpace(action)); u != "" {
+		return u
+	}
+	return e.Request.AbsoluteURL(e.Request.URL.String())
+}
+
+// formDefaults reads the method, action and default values of a form in a
+// page fetched outside colly, the values a browser would submit untouched
+func formDefaults(form *goquery.Selection, page *url.URL) (string, string, url.Values) {
+	action := page.String()
+	if attr, ok := form.Attr("action"); ok && strings.TrimSpace(attr) != "" {
+		if u, err := page.Parse(strings.TrimSpace(attr)); err == nil {
+			action = u.String()
+		}
+	}
+	values := url.Values{}
+	form.Find("input[name], textarea[name], select[name]").Each(func(_ int, in *goquery.Selection) {
+		name, _ := in.Attr("name")
+		switch typ, _ := in.Attr("type"); strings.ToLower(typ) {
+		case "submit", "image", "reset", "button", "file":
+			return
+		case "checkbox", "radio":
+			if _, checked := in.Attr("checked"); !checked {
+				return
+			}
+		}
+		value, _ := in.Attr("value")
+		values.Add(name, value)
+	})
+	return formMethod(form.AttrOr("method", "")), action, values
+}
+
+// newInjection picks a fresh canary for every input of f that gets one,
+// hidden inputs and the submitter keep their own value
+func newInjection(f Form) injection {
+	inj := injection{FormLocation: f.URL, Page: f.Page}
+	for _, in := range f.Inputs {
+		hash := ""
+		if in.Type != "hidden" && in.Type != "submit" {
+			hash = newCanary(in.Name)
+		}
+		inj.Params = append(inj.Params, in.Name)
+		inj.Hashes = append(inj.Hashes, hash)
+	}
+	return inj
+}
+
+// splitInjection spreads the hashes of inj over requests of at most size
+// parameters each, parameters left out of a request get a harmless value
+// instead. A size of zero or less keeps everything in one request
+func splitInjection(inj injection, size int) []injection {
+	if size <= 0 || inj.injected() <= size {
+		return []injection{inj}
+	}
+	var batches []injection
+	var current injection
+	for i, hash := range inj.Hashes {
+		if hash == "" {
+			continue
+		}
+		if current.injected() == 0 {
+			current = injection{
+				FormLocation: inj.FormLocation,
+				Page:         inj.Page,
+				Params:       inj.Params,
+				Hashes:       make([]string, len(inj.Hashes)),
+			}
+		}
+		current.Hashes[i] = hash
+		if current.injected() == size {
+			batches = append(batches, current)
+			current = injection{}
+		}
+	}
+	if current.injected() > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// fillerValue is sent for inputs that aren't being probed in this request,
+// in the format the input's type or the page's language expects
+func fillerValue(in Input, lang string) string {
+	if in.Value != "" {
+		return in.Value
+	}
+	if in.Type == "email" {
+		return "test@example.com"
+	}
+	now := time.Now()
+	if value := typedFillerValue(in.Type, now); value != "" {
+		return value
+	}
+	if in.Type == "" || in.Type == "text" {
+		if value := localizedFillerValue(in.Name, lang, now); value != "" {
+			return value
+		}
+	}
+	return "1"
+}
+
+// formLang returns the language of the page a form is on, from the html
+// element's lang attribute or the Content-Language header
+func formLang(e *colly.HTMLElement) string {
+	if lang, ok := e.DOM.Closest("[lang]").Attr("lang"); ok && lang != "" {
+		return lang
+	}
+	if e.Response != nil {
+		return strings.TrimSpace(strings.SplitN(e.Response.Headers.Get("Content-Language"), ",", 2)[0])
+	}
+	return ""
+}
+
+// submitForm sends the form with the injection's hashes, dialog forms never leave the browser.
+// Probes get their own context so they are paced separately and not crawled further
+func submitForm(c *colly.Collector, f Form, inj injection) {
+	sendProbe(c, f, inj, probeContext(f, inj))
+}
+
+// submitBatches sends the batches of a form probe. Those of a form with
+// anti-CSRF tokens go out in turn, each once the one before is answered and
+// with a token fetched for it, as batches sent together would all carry the
+// same single use token
+func submitBatches(c *colly.Collector, f Form, batches []injection) {
+	if len(csrfTokenInputs(f)) == 0 {
+		for _, inj := range batches {
+			submitForm(c, f, inj)
+		}
+		return
+	}
+	ctx := probeContext(f, batches[0])
+	ctx.Put("batches", batches[1:])
+	sendProbe(c, f, batches[0], ctx)
+}
+
+// probeContext is the context a probe of f with inj is sent with
+func probeContext(f Form, inj injection) *colly.Context {
+	ctx := colly.NewContext()
+	ctx.Put("probe", f.URL)
+	ctx.Put("form", f)
+	ctx.Put("injection", inj)
+	return ctx
+}
+
+// sendProbe sends the form with the injection's hashes in ctx
+func sendProbe(c *colly.Collector, f Form, inj injection, ctx *colly.Context) {
+	var hdr http.Header
+	if f.Headers != nil {
+		hdr = f.Headers.Clone()
+		hdr.Set("User-Agent", c.UserAgent)
+	}
+	switch f.Method {
+	case "POST":
+		// kept for the origin-body field, the reader is gone once sent
+		body := generateFormData(f, inj)
+		ctx.Put("body", string(body))
+		c.Request("POST", f.URL, bytes.NewReader(body), ctx, hdr)
+	case "GET":
+		c.Request("GET", string(generateFormData(f, inj)), nil, ctx, hdr)
+	}
+}
+
+// isProbe reports whether a request was sent by submitForm
+func isProbe(r *colly.Request) bool {
+	return r.Ctx.Get("probe") != ""
+}
+
+// takes a form struct and returns a byte array of form inputs
+// if its a POST form it returns POST data
+// if its a GET form it returns a URL
+func generateFormData(f Form, inj injection) []byte {
+	formData := url.Values{}
+	for i := 0; i < len(f.Inputs); i++ {
+		hash := inj.Hashes[i]
+		if f.Inputs[i].Type == "hidden" || f.Inputs[i].Type == "submit" {
+			//payload = payload + "&" + f.Inputs[i].Name + "=" + f.Inputs[i].Value
+			formData.Add(f.Inputs[i].Name, f.Inputs[i].Value)
+		} else if hash == "" {
+			// probed in another batch
+			formData.Add(f.Inputs[i].Name, fillerValue(f.Inputs[i], f.Lang))
+		} else if f.Inputs[i].Type == "email" {
+			//payload = payload + "&" + f.Inputs[i].Name + "=" + HASH + "@gmail.com"
+			formData.Add(f.Inputs[i].Name, fmt.Sprintf("%s@gmail.com", hash))
+		} else if f.Inputs[i].Type == "text" {
+			//payload = payload + "&" + f.Inputs[i].Name + "=http://" + HASH
+			formData.Add(f.Inputs[i].Name, hash)
+		} else if f.Inputs[i].Type == "password" {
+			//payload = payload + "&" + f.Inputs[i].Name + "=" + hash
+			formData.Add(f.Inputs[i].Name, hash)
+		} else {
+			formData.Add(f.Inputs[i].Name, hash)
+		}
+	}
+	byteData, err := ioutil.ReadAll(strings.NewReader(formData.Encode()))
+	if err != nil {
+		log.Println(err)
+	}
+	if f.Method == "POST" {
+		return byteData
+	}
+	// a GET submission replaces whatever query the action already had
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return []byte(f.URL + "?" + string(byteData))
+	}
+	u.RawQuery = string(byteData)
+	// nor is the action's fragment ever sent
+	u.Fragment, u.RawFragment = "", ""
+	return []byte(u.String())
+}
@@ -0,0 +1,136 @@
+package reflector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestSplitInjection(t *testing.T) {
+	inj := injection{
+		FormLocation: "https://example.com/search",
+		Page:         "https://example.com/",
+		Params:       []string{"q", "csrf", "lang", "page", "sort"},
+		Hashes:       []string{"rfla_q", "", "rflb_lang", "rflc_page", "rfld_sort"},
+	}
+	tests := []struct {
+		name string
+		size int
+		want [][]string
+	}{
+		{name: "no limit", size: 0, want: [][]string{inj.Hashes}},
+		{name: "fits", size: 4, want: [][]string{inj.Hashes}},
+		{name: "larger", size: 10, want: [][]string{inj.Hashes}},
+		{name: "pairs", size: 2, want: [][]string{
+			{"rfla_q", "", "rflb_lang", "", ""},
+			{"", "", "", "rflc_page", "rfld_sort"},
+		}},
+		{name: "three and one", size: 3, want: [][]string{
+			{"rfla_q", "", "rflb_lang", "rflc_page", ""},
+			{"", "", "", "", "rfld_sort"},
+		}},
+		{name: "singles", size: 1, want: [][]string{
+			{"rfla_q", "", "", "", ""},
+			{"", "", "rflb_lang", "", ""},
+			{"", "", "", "rflc_page", ""},
+			{"", "", "", "", "rfld_sort"},
+		}},
+	}
+	for _, test := range tests {
+		batches := splitInjection(inj, test.size)
+		var got [][]string
+		for _, batch := range batches {
+			got = append(got, batch.Hashes)
+			if batch.FormLocation != inj.FormLocation || batch.Page != inj.Page || !reflect.DeepEqual(batch.Params, inj.Params) {
+				t.Errorf("%s: batch %+v lost the form", test.name, batch)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestGenerateFormData(t *testing.T) {
+	inputs := []Input{
+		{Type: "text", Name: "q"},
+		{Type: "hidden", Name: "csrf", Value: "t0k3n"},
+		{Type: "email", Name: "email"},
+		{Type: "text", Name: "lang", Value: "en"},
+	}
+	tests := []struct {
+		name   string
+		method string
+		action string
+		hashes []string
+		want   string
+	}{
+		{
+			name:   "POST body",
+			method: "POST",
+			action: "https://example.com/search",
+			hashes: []string{"rfla_q", "", "rflb_email", "rflc_lang"},
+			want:   "csrf=t0k3n&email=rflb_email%40gmail.com&lang=rflc_lang&q=rfla_q",
+		},
+		{
+			name:   "batch with fillers",
+			method: "POST",
+			action: "https://example.com/search",
+			hashes: []string{"rfla_q", "", "", ""},
+			want:   "csrf=t0k3n&email=test%40example.com&lang=en&q=rfla_q",
+		},
+		{
+			name:   "GET replaces the action's query",
+			method: "GET",
+			action: "https://example.com/search?old=1",
+			hashes: []string{"rfla_q", "", "", ""},
+			want:   "https://example.com/search?csrf=t0k3n&email=test%40example.com&lang=en&q=rfla_q",
+		},
+		{
+			name:   "GET drops the action's fragment",
+			method: "GET",
+			action: "https://example.com/search#results",
+			hashes: []string{"rfla_q", "", "", ""},
+			want:   "https://example.com/search?csrf=t0k3n&email=test%40example.com&lang=en&q=rfla_q",
+		},
+	}
+	for _, test := range tests {
+		f := Form{URL: test.action, Method: test.method, Inputs: inputs}
+		inj := injection{FormLocation: test.action, Params: []string{"q", "csrf", "email", "lang"}, Hashes: test.hashes}
+		if got := string(generateFormData(f, inj)); got != test.want {
+			t.Errorf("%s: %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSubmitSelector(t *testing.T) {
+	tests := []struct {
+		html   string
+		submit bool
+	}{
+		{html: `<button>Go</button>`, submit: true},
+		{html: `<button type="submit">Go</button>`, submit: true},
+		{html: `<button type="SUBMIT">Go</button>`, submit: true},
+		{html: `<button type="">Go</button>`, submit: true},
+		{html: `<button type="bogus">Go</button>`, submit: true},
+		{html: `<button type="reset">Clear</button>`},
+		{html: `<button type="Reset">Clear</button>`},
+		{html: `<button type="button">Menu</button>`},
+		{html: `<button type="BUTTON">Menu</button>`},
+		{html: `<input type="submit" value="Go">`, submit: true},
+		{html: `<input type="Image" src="go.png">`, submit: true},
+		{html: `<input type="button" value="Menu">`},
+		{html: `<input type="text" name="q">`},
+	}
+	for _, test := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader("<form>" + test.html + "</form>"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if submit := doc.Find(submitSelector).Length() > 0; submit != test.submit {
+			t.Errorf("%s: submit is %v, want %v", test.html, submit, test.submit)
+		}
+	}
+}
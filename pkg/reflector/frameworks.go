@@ -0,0 +1,185 @@
+package reflector
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// limits on what a framework's build files may add to a crawl
+const (
+	maxFrameworkScripts = 20
+	maxFrameworkRoutes  = 1000
+)
+
+var (
+	// the build ID in __NEXT_DATA__, or in the path of the build manifest itself
+	nextBuildIDRegex  = regexp.MustCompile(`"buildId"\s*:\s*"([^"]+)"`)
+	nextManifestRegex = regexp.MustCompile(`/_next/static/([^/"']+)/_buildManifest\.js`)
+	// pages are the keys of the build manifest, e.g. "/blog/[slug]":[...], and listed in sortedPages
+	nextRouteRegex  = regexp.MustCompile(`"(/[^"]*)"\s*:\s*\[`)
+	nextSortedRegex = regexp.MustCompile(`sortedPages\s*:\s*\[((?:\s*"[^"]*"\s*,?)*)\]`)
+	// the chunk files of each page, e.g. "static/chunks/pages/index-abc.js"
+	nextChunkRegex = regexp.MustCompile(`"(static/chunks/[^"]+\.js)"`)
+	// scripts a Nuxt page loads, e.g. /_nuxt/entry.abc.js
+	nuxtScriptRegex = regexp.MustCompile(`["'](/_nuxt/[^"']+\.js)["']`)
+	// records of a vue-router table, e.g. path:"/users/:id"
+	vueRouteRegex = regexp.MustCompile(`path\s*:\s*["'](/[^"']*)["']`)
+	// path literals in scripts that look like API endpoints, query strings left off
+	apiLiteralRegex = regexp.MustCompile("[\"'`](/api/[A-Za-z0-9_\\-./:\\[\\]]*)(?:\\?[^\"'`]*)?[\"'`]")
+	// any quoted string, for the entries of sortedPages
+	quotedRegex = regexp.MustCompile(`"([^"]*)"`)
+)
+
+// detectFramework fingerprints a page built with Next.js or Nuxt from the
+// data and scripts they render into it, "" for anything else
+func detectFramework(body []byte) string {
+	switch {
+	case bytes.Contains(body, []byte("__NEXT_DATA__")) || bytes.Contains(body, []byte("/_next/static/")):
+		return "nextjs"
+	case bytes.Contains(body, []byte("__NUXT__")) || bytes.Contains(body, []byte("/_nuxt/")) || bytes.Contains(body, []byte(`id="__nuxt"`)):
+		return "nuxt"
+	}
+	return ""
+}
+
+// frameworkRoutes returns the page and API routes the build files of a
+// Next.js or Nuxt site list, as URLs on page's host. Next.js lists every
+// page in its build manifest and Nuxt its prerendered pages in its build
+// metadata, the scripts of both add their router tables and /api/ paths
+func frameworkRoutes(p *prober, framework string, page *url.URL, body []byte) []string {
+	root := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/"}
+	var routes []string
+	seen := make(map[string]bool)
+	add := func(route string) {
+		route = fillRoute(route)
+		if !seen[route] && len(routes) < maxFrameworkRoutes {
+			seen[route] = true
+			routes = append(routes, root.ResolveReference(&url.URL{Path: route}).String())
+		}
+	}
+	var scripts []string
+
+	switch framework {
+	case "nextjs":
+		buildID := ""
+		if m := nextBuildIDRegex.FindSubmatch(body); m != nil {
+			buildID = string(m[1])
+		} else if m := nextManifestRegex.FindSubmatch(body); m != nil {
+			buildID = string(m[1])
+		}
+		if buildID == "" {
+			break
+		}
+		manifest, ok := fetchBuildFile(p, root, "/_next/static/"+buildID+"/_buildManifest.js")
+		if !ok {
+			break
+		}
+		manifest = unescapeSlashes(manifest)
+		for _, m := range nextRouteRegex.FindAllSubmatch(manifest, -1) {
+			if isNextPage(string(m[1])) {
+				add(string(m[1]))
+			}
+		}
+		if m := nextSortedRegex.FindSubmatch(manifest); m != nil {
+			for _, page := range quotedRegex.FindAllSubmatch(m[1], -1) {
+				if isNextPage(string(page[1])) {
+					add(string(page[1]))
+				}
+			}
+		}
+		for _, m := range nextChunkRegex.FindAllSubmatch(manifest, -1) {
+			scripts = append(scripts, "/_next/"+string(m[1]))
+		}
+	case "nuxt":
+		if latest, ok := fetchBuildFile(p, root, "/_nuxt/builds/latest.json"); ok {
+			var build struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(latest, &build) == nil && build.ID != "" {
+				if data, ok := fetchBuildFile(p, root, "/_nuxt/builds/meta/"+build.ID+".json"); ok {
+					var meta struct {
+						Prerendered []string `json:"prerendered"`
+					}
+					if json.Unmarshal(data, &meta) == nil {
+						for _, route := range meta.Prerendered {
+							add(route)
+						}
+					}
+				}
+			}
+		}
+		for _, m := range nuxtScriptRegex.FindAllSubmatch(body, -1) {
+			scripts = append(scripts, string(m[1]))
+		}
+	}
+
+	fetched := make(map[string]bool)
+	for _, script := range scripts {
+		if fetched[script] || len(fetched) >= maxFrameworkScripts {
+			continue
+		}
+		fetched[script] = true
+		data, ok := fetchBuildFile(p, root, script)
+		if !ok {
+			continue
+		}
+		data = unescapeSlashes(data)
+		if framework == "nuxt" {
+			for _, m := range vueRouteRegex.FindAllSubmatch(data, -1) {
+				add(string(m[1]))
+			}
+		}
+		for _, m := range apiLiteralRegex.FindAllSubmatch(data, -1) {
+			add(string(m[1]))
+		}
+	}
+	return routes
+}
+
+// fetchBuildFile fetches a file on the site's root, reporting whether it was there
+func fetchBuildFile(p *prober, root *url.URL, path string) ([]byte, bool) {
+	resp, body, err := p.do("GET", root.ResolveReference(&url.URL{Path: path}).String(), nil, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, false
+	}
+	return body, true
+}
+
+// isNextPage reports whether a build manifest key is a page rather than one
+// of Next's own entries like /_app, /_error and the error pages
+func isNextPage(route string) bool {
+	return !strings.HasPrefix(route, "/_") && route != "/404" && route != "/500"
+}
+
+// unescapeSlashes undoes the \u002F and \/ escaping of slashes in generated scripts
+func unescapeSlashes(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte(`\u002F`), []byte("/"))
+	return bytes.ReplaceAll(data, []byte(`\/`), []byte("/"))
+}
+
+// fillRoute turns a route pattern into a path that can be requested: Next's
+// [id] and vue-router's :id segments become 1, optional and catch-all
+// segments are dropped
+func fillRoute(route string) string {
+	var segments []string
+	for _, segment := range strings.Split(route, "/") {
+		switch {
+		case strings.HasPrefix(segment, "[["), segment == "*", strings.HasPrefix(segment, "(.*)"):
+			continue
+		case strings.HasPrefix(segment, ":") && (strings.HasSuffix(segment, "?") || strings.HasSuffix(segment, "*")):
+			continue
+		case strings.HasPrefix(segment, "[") || strings.HasPrefix(segment, ":"):
+			segments = append(segments, "1")
+		default:
+			segments = append(segments, segment)
+		}
+	}
+	if path := strings.Join(segments, "/"); path != "" {
+		return path
+	}
+	return "/"
+}
@@ -0,0 +1,246 @@
+package reflector
+
+import (
+	"container/heap"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// crawl strategies accepted by -strategy, the empty one leaves ordering to colly
+var strategies = []string{"", "bfs", "dfs", "priority"}
+
+// pendingLink is a link waiting in the frontier
+type pendingLink struct {
+	parent *colly.Request
+	url    string
+	depth  int
+	score  int
+	seq    int
+}
+
+// frontier orders discovered links by the chosen strategy and only lets
+// limit of them be in flight at once, so the order actually holds in async mode
+type frontier struct {
+	c        *colly.Collector
+	strategy string
+	limit    int
+	budget   *depthBudget
+	// endpoints other scanners flagged, which go first by priority
+	signals *signals
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	items    linkHeap
+	seq      int
+	inflight int
+	// links queued or visited already, the collector allows revisits for
+	// the probes, so the crawl has to keep from going round in circles itself
+	seen map[string]bool
+}
+
+// newFrontier returns a frontier for c, an empty strategy visits links immediately.
+// Links are dropped once their depth has used up its budget, or the budget
+// has no pages left
+func newFrontier(c *colly.Collector, strategy string, limit int, budget *depthBudget) *frontier {
+	f := &frontier{
+		c:        c,
+		strategy: strategy,
+		limit:    limit,
+		budget:   budget,
+		seen:     make(map[string]bool),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	f.items.strategy = strategy
+	if f.limit < 1 {
+		f.limit = 1
+	}
+	return f
+}
+
+// validStrategy checks a -strategy value
+func validStrategy(strategy string) error {
+	for _, s := range strategies {
+		if s == strategy {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown strategy %q, expected bfs, dfs or priority", strategy)
+}
+
+// push queues link found on parent's page, a nil parent starts a new crawl.
+// Links already pushed are dropped, before they take a page of the budget
+func (f *frontier) push(parent *colly.Request, link string) {
+	depth := 1
+	if parent != nil {
+		depth = parent.Depth + 1
+		link = parent.AbsoluteURL(link)
+	}
+	if link == "" || !f.first(link) {
+		return
+	}
+	if f.strategy == "" {
+		if !f.budget.allow(depth) || !f.budget.take() {
+			return
+		}
+		var err error
+		if parent == nil {
+			err = f.c.Visit(link)
+		} else {
+			err = parent.Visit(link)
+		}
+		if err != nil {
+			f.budget.release()
+		}
+		return
+	}
+
+	f.mu.Lock()
+	f.seq++
+	heap.Push(&f.items, &pendingLink{
+		parent: parent,
+		url:    link,
+		depth:  depth,
+		score:  linkPriority(link) + f.signals.boost(link),
+		seq:    f.seq,
+	})
+	f.mu.Unlock()
+	f.cond.Signal()
+}
+
+// first reports whether link hasn't been pushed before, fragments aside
+func (f *frontier) first(link string) bool {
+	if u, err := url.Parse(link); err == nil {
+		u.Fragment = ""
+		u.RawFragment = ""
+		link = u.String()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.seen[link] {
+		return false
+	}
+	f.seen[link] = true
+	return true
+}
+
+// run hands queued links to colly until the frontier is empty and nothing is in flight
+func (f *frontier) run() {
+	if f.strategy == "" {
+		return
+	}
+	for {
+		f.mu.Lock()
+		for (len(f.items.links) == 0 && f.inflight > 0) || (len(f.items.links) > 0 && f.inflight >= f.limit) {
+			f.cond.Wait()
+		}
+		if len(f.items.links) == 0 {
+			f.mu.Unlock()
+			return
+		}
+		next := heap.Pop(&f.items).(*pendingLink)
+		if !f.budget.allow(next.depth) || !f.budget.take() {
+			f.mu.Unlock()
+			continue
+		}
+		f.inflight++
+		f.mu.Unlock()
+
+		var err error
+		if next.parent == nil {
+			err = f.c.Visit(next.url)
+		} else {
+			err = next.parent.Visit(next.url)
+		}
+		// filtered links never reach a callback, so free their slot here
+		if err != nil {
+			f.budget.release()
+			f.done()
+		}
+	}
+}
+
+// done frees the slot of a finished crawl request
+func (f *frontier) done() {
+	if f.strategy == "" {
+		return
+	}
+	f.mu.Lock()
+	if f.inflight > 0 {
+		f.inflight--
+	}
+	f.mu.Unlock()
+	f.cond.Signal()
+}
+
+// linkPriority scores how likely a link leads to reflection surface,
+// parameters and form-ish pages first and static assets last
+func linkPriority(link string) int {
+	u, err := url.Parse(link)
+	if err != nil {
+		return 0
+	}
+	score := 0
+	if u.RawQuery != "" {
+		score += 10 + len(u.Query())
+	}
+	p := strings.ToLower(u.Path)
+	for _, word := range []string{"search", "query", "login", "register", "signup", "comment", "contact", "feedback", "profile", "account", "redirect", "callback", "api"} {
+		if strings.Contains(p, word) {
+			score += 5
+		}
+	}
+	switch path.Ext(p) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".svg", ".ico", ".css", ".woff", ".woff2", ".ttf", ".mp4", ".pdf", ".zip":
+		score -= 20
+	}
+	return score
+}
+
+// linkHeap implements heap.Interface ordered by strategy
+type linkHeap struct {
+	strategy string
+	links    []*pendingLink
+}
+
+func (h linkHeap) Len() int { return len(h.links) }
+
+func (h linkHeap) Less(i, j int) bool {
+	a, b := h.links[i], h.links[j]
+	switch h.strategy {
+	case "dfs":
+		if a.depth != b.depth {
+			return a.depth > b.depth
+		}
+		return a.seq > b.seq
+	case "priority":
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		return a.seq < b.seq
+	default:
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		return a.seq < b.seq
+	}
+}
+
+func (h linkHeap) Swap(i, j int) { h.links[i], h.links[j] = h.links[j], h.links[i] }
+
+func (h *linkHeap) Push(x interface{}) { h.links = append(h.links, x.(*pendingLink)) }
+
+func (h *linkHeap) Pop() interface{} {
+	old := h.links
+	n := len(old)
+	x := old[n-1]
+	h.links = old[:n-1]
+	return x
+}
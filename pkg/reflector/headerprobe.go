@@ -0,0 +1,95 @@
+package reflector
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// headers apps commonly echo, with the canary wrapped the way each one's
+// format expects so it isn't dropped as invalid
+var canaryHeaders = []struct {
+	name   string
+	format string
+}{
+	{"User-Agent", "Mozilla/5.0 (%s)"},
+	{"Referer", "https://%s.example.com/"},
+	{"X-Forwarded-For", "%s"},
+	{"X-Forwarded-Host", "%s.example.com"},
+	{"Origin", "https://%s.example.com"},
+}
+
+// headerInjection picks a hash for each canary header, with headers, and for
+// each cookie sent to page, from the cookie jar and the custom Cookie header,
+// with cookies. Params are named header[<name>] and cookie[<name>]
+func headerInjection(page string, jar []*http.Cookie, custom string, headers, cookies bool) injection {
+	inj := injection{FormLocation: page, Page: page}
+	if headers {
+		for _, header := range canaryHeaders {
+			// canaries are lowercase, host names may come back lowercased
+			inj.Params = append(inj.Params, "header["+header.name+"]")
+			inj.Hashes = append(inj.Hashes, newCanary(header.name))
+		}
+	}
+
+	names := make(map[string]bool)
+	if cookies {
+		for _, cookie := range jar {
+			names[cookie.Name] = true
+		}
+		for _, pair := range strings.Split(custom, ";") {
+			if name := strings.TrimSpace(strings.SplitN(pair, "=", 2)[0]); name != "" {
+				names[name] = true
+			}
+		}
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		inj.Params = append(inj.Params, "cookie["+name+"]")
+		inj.Hashes = append(inj.Hashes, newCanary(name))
+	}
+	return inj
+}
+
+// headerCanaries returns the headers that carry the hashes of a header
+// injection, each canary header's wrapped in its format
+func headerCanaries(inj injection) http.Header {
+	canaries := http.Header{}
+	var pairs []string
+	for i, param := range inj.Params {
+		switch {
+		case strings.HasPrefix(param, "header["):
+			name := strings.TrimSuffix(strings.TrimPrefix(param, "header["), "]")
+			for _, header := range canaryHeaders {
+				if header.name == name {
+					canaries.Set(name, fmt.Sprintf(header.format, inj.Hashes[i]))
+				}
+			}
+		case strings.HasPrefix(param, "cookie["):
+			pairs = append(pairs, strings.TrimSuffix(strings.TrimPrefix(param, "cookie["), "]")+"="+inj.Hashes[i])
+		}
+	}
+	// the jar's own cookies still get appended after these, most
+	// frameworks read the first cookie of a name
+	if len(pairs) > 0 {
+		canaries.Set("Cookie", strings.Join(pairs, "; "))
+	}
+	return canaries
+}
+
+// sendHeaderProbe requests page again with the canaries, which are set after
+// every other header so neither custom headers nor identities replace them
+func sendHeaderProbe(c *colly.Collector, page string, inj injection) {
+	ctx := colly.NewContext()
+	ctx.Put("probe", page)
+	ctx.Put("injection", inj)
+	ctx.Put("canaries", headerCanaries(inj))
+	c.Request("GET", page, nil, ctx, nil)
+}
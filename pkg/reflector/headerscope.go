@@ -0,0 +1,151 @@
+package reflector
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// headerScope keeps custom headers to the URLs their rules allow, e.g.
+// Authorization only to api.example.com, so tokens aren't sent to the
+// third-party and out of scope hosts an in-scope page links to or
+// redirects to. Headers without rules are sent everywhere
+type headerScope struct {
+	// rules by canonical header name, patterns as in a scope file
+	rules map[string][]*regexp.Regexp
+	// names of the cookies in the custom Cookie header, the only ones a
+	// Cookie rule holds back, cookies the target set are the jar's business
+	cookies map[string]bool
+}
+
+// newHeaderScope compiles the rules of Options.HeaderScope for the custom
+// headers, nil without any rules
+func newHeaderScope(rules map[string][]string, headers map[string]string) (*headerScope, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	s := &headerScope{
+		rules:   make(map[string][]*regexp.Regexp, len(rules)),
+		cookies: make(map[string]bool),
+	}
+	for header, patterns := range rules {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "Host" {
+			return nil, fmt.Errorf("header scope: the Host header can't be scoped")
+		}
+		for _, pattern := range patterns {
+			rule, err := scopeRule(strings.TrimSpace(pattern))
+			if err != nil {
+				return nil, fmt.Errorf("header scope: %s: %w", header, err)
+			}
+			s.rules[header] = append(s.rules[header], rule)
+		}
+	}
+	for header, value := range headers {
+		if http.CanonicalHeaderKey(header) != "Cookie" {
+			continue
+		}
+		for _, cookie := range (&http.Request{Header: http.Header{"Cookie": {value}}}).Cookies() {
+			s.cookies[cookie.Name] = true
+		}
+	}
+	return s, nil
+}
+
+// ParseHeaderScope parses header scope rules as "Name: pattern", e.g.
+// "Authorization: api.example.com", into Options.HeaderScope
+func ParseHeaderScope(rules []string) (map[string][]string, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	scoped := make(map[string][]string)
+	for _, rule := range rules {
+		i := strings.Index(rule, ":")
+		if i < 0 || strings.TrimSpace(rule[:i]) == "" || strings.TrimSpace(rule[i+1:]) == "" {
+			return nil, fmt.Errorf("header scope %q: expected a header name, a colon and a pattern", rule)
+		}
+		header := http.CanonicalHeaderKey(strings.TrimSpace(rule[:i]))
+		scoped[header] = append(scoped[header], strings.TrimSpace(rule[i+1:]))
+	}
+	return scoped, nil
+}
+
+// allows reports whether header may be sent to link
+func (s *headerScope) allows(header, link string) bool {
+	if s == nil {
+		return true
+	}
+	rules, ok := s.rules[http.CanonicalHeaderKey(header)]
+	if !ok {
+		return true
+	}
+	for _, rule := range rules {
+		if rule.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the headers of values that may be sent to link
+func (s *headerScope) filter(values map[string]string, link string) map[string]string {
+	if s == nil {
+		return values
+	}
+	filtered := make(map[string]string, len(values))
+	for header, value := range values {
+		if s.allows(header, link) {
+			filtered[header] = value
+		}
+	}
+	return filtered
+}
+
+// wrap returns a transport that holds back the headers a request's URL
+// isn't allowed, whichever client set them and redirects included
+func (s *headerScope) wrap(base http.RoundTripper) http.RoundTripper {
+	return &headerScopeTransport{base: base, scope: s}
+}
+
+type headerScopeTransport struct {
+	base  http.RoundTripper
+	scope *headerScope
+}
+
+func (t *headerScopeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	link := req.URL.String()
+	var held []string
+	for header := range t.scope.rules {
+		if _, ok := req.Header[header]; ok && !t.scope.allows(header, link) {
+			held = append(held, header)
+		}
+	}
+	if len(held) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	// a transport mustn't change the request it was given
+	req = req.Clone(req.Context())
+	for _, header := range held {
+		if header == "Cookie" {
+			t.scope.holdCookies(req)
+			continue
+		}
+		req.Header.Del(header)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// holdCookies removes the custom cookies from req, keeping the others
+func (s *headerScope) holdCookies(req *http.Request) {
+	var kept []string
+	for _, cookie := range req.Cookies() {
+		if !s.cookies[cookie.Name] {
+			kept = append(kept, cookie.String())
+		}
+	}
+	req.Header.Del("Cookie")
+	if len(kept) > 0 {
+		req.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
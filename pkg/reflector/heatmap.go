@@ -0,0 +1,184 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// heat map layouts, see Options.HeatMap
+var heatMapLayouts = []string{"", "tree", "table"}
+
+// path segments that are ids rather than names: numbers, UUIDs, hashes and
+// other long runs with digits in them
+var idSegmentRegex = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}|[0-9a-fA-F]{16,}|[A-Za-z0-9_-]*\d[A-Za-z0-9_-]*\d[A-Za-z0-9_-]{10,})$`)
+
+// validHeatMap checks a -heatmap value
+func validHeatMap(layout string) error {
+	for _, l := range heatMapLayouts {
+		if l == layout {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown heat map layout %q, expected tree or table", layout)
+}
+
+// heatMap counts a target's reflections by the path of the page they were
+// found on, ids in paths collapsed into {id}, so the template behind many
+// findings stands out
+type heatMap struct {
+	mu   sync.Mutex
+	root *heatNode
+}
+
+type heatNode struct {
+	segment string
+	// reflections on this path and under it
+	count int
+	// reflections on this very path
+	own      int
+	children map[string]*heatNode
+	// and by parameter
+	params map[string]int
+}
+
+func newHeatNode(segment string) *heatNode {
+	return &heatNode{segment: segment, children: make(map[string]*heatNode), params: make(map[string]int)}
+}
+
+func newHeatMap() *heatMap {
+	return &heatMap{root: newHeatNode("")}
+}
+
+// pathTemplate returns the segments of link's path with ids replaced by {id}
+func pathTemplate(link string) []string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil
+	}
+	var segments []string
+	for _, segment := range strings.Split(u.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		if idSegmentRegex.MatchString(segment) {
+			segment = "{id}"
+		}
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// record counts a reflection of params found on link
+func (h *heatMap) record(link string, params []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	node := h.root
+	node.count++
+	for _, segment := range pathTemplate(link) {
+		child, ok := node.children[segment]
+		if !ok {
+			child = newHeatNode(segment)
+			node.children[segment] = child
+		}
+		child.count++
+		node = child
+	}
+	node.own++
+	for _, param := range params {
+		node.params[param]++
+	}
+}
+
+// hottest returns a node's children, the most reflections first
+func (n *heatNode) hottest() []*heatNode {
+	children := make([]*heatNode, 0, len(n.children))
+	for _, child := range n.children {
+		children = append(children, child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].count != children[j].count {
+			return children[i].count > children[j].count
+		}
+		return children[i].segment < children[j].segment
+	})
+	return children
+}
+
+// paramCounts formats the reflections of a path by parameter, e.g. "q=20 lang=10"
+func (n *heatNode) paramCounts() string {
+	names := make([]string, 0, len(n.params))
+	for name := range n.params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if n.params[names[i]] != n.params[names[j]] {
+			return n.params[names[i]] > n.params[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	counts := make([]string, len(names))
+	for i, name := range names {
+		counts[i] = fmt.Sprintf("%s=%d", name, n.params[name])
+	}
+	return strings.Join(counts, " ")
+}
+
+// print writes the heat map of target as a tree of path prefixes, each
+// with the reflections under it, or as a table of the paths reflecting
+// most. Nothing is written for a target without reflections
+func (h *heatMap) print(w io.Writer, target, layout string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.root.count == 0 {
+		return
+	}
+	fmt.Fprintf(w, "[heatmap] %s reflections=%d\n", target, h.root.count)
+	// aligned in a buffer, so the padding of an empty last column can go
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	if layout == "table" {
+		type row struct {
+			path string
+			node *heatNode
+		}
+		var rows []row
+		var walk func(path string, n *heatNode)
+		walk = func(path string, n *heatNode) {
+			if n.own > 0 {
+				rows = append(rows, row{path, n})
+			}
+			for _, child := range n.hottest() {
+				walk(strings.TrimSuffix(path, "/")+"/"+child.segment, child)
+			}
+		}
+		walk("/", h.root)
+		sort.SliceStable(rows, func(i, j int) bool { return rows[i].node.own > rows[j].node.own })
+		fmt.Fprintln(tw, "[heatmap]   PATH\tREFLECTIONS\tPARAMS")
+		for _, r := range rows {
+			fmt.Fprintf(tw, "[heatmap]   %s\t%d\t%s\n", r.path, r.node.own, r.node.paramCounts())
+		}
+	} else {
+		var walk func(depth int, n *heatNode)
+		walk = func(depth int, n *heatNode) {
+			name := "/" + n.segment
+			fmt.Fprintf(tw, "[heatmap]   %s%s\t%d\t%s\n", strings.Repeat("  ", depth), name, n.count, n.paramCounts())
+			for _, child := range n.hottest() {
+				walk(depth+1, child)
+			}
+		}
+		walk(0, h.root)
+	}
+	tw.Flush()
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			fmt.Fprintln(w, strings.TrimRight(line, " \n"))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package reflector
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// hostSlots caps the requests in flight per host across every target
+// crawled at once. colly only limits each target's own collector, so two
+// targets on one host would otherwise get Threads each
+type hostSlots struct {
+	size  int
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+func newHostSlots(size int) *hostSlots {
+	if size < 1 {
+		size = 1
+	}
+	return &hostSlots{size: size, hosts: make(map[string]chan struct{})}
+}
+
+func (s *hostSlots) host(host string) chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slots, ok := s.hosts[host]
+	if !ok {
+		slots = make(chan struct{}, s.size)
+		s.hosts[host] = slots
+	}
+	return slots
+}
+
+// wrap returns a transport that waits for a free slot on the request's
+// host, and holds it until the response body is closed
+func (s *hostSlots) wrap(base http.RoundTripper) http.RoundTripper {
+	return &slotTransport{base: base, slots: s}
+}
+
+type slotTransport struct {
+	base  http.RoundTripper
+	slots *hostSlots
+}
+
+func (t *slotTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	slots := t.slots.host(req.URL.Host)
+	select {
+	case slots <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		<-slots
+		return nil, err
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: func() { <-slots }}
+	return resp, nil
+}
+
+// slotBody frees its request's slot when it is first closed
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// Write passes through to a switched protocol's connection, see prober.upgrade
+func (b *slotBody) Write(p []byte) (int, error) {
+	return writeThrough(b.ReadCloser, p)
+}
@@ -0,0 +1,66 @@
+package reflector
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// elements whose URLs are loaded as subresources, and so count as mixed content
+const subresourceSelector = "script[src], link[href], img[src], iframe[src], frame[src], audio[src], video[src], source[src], embed[src], object[data]"
+
+// upgradeTarget returns the https version of an http target if it answers over https,
+// otherwise the target unchanged
+func upgradeTarget(transport *http.Transport, target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "http" {
+		return target
+	}
+	u.Scheme = "https"
+	if u.Port() == "80" {
+		u.Host = u.Hostname()
+	}
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Head(u.String())
+	if err != nil {
+		return target
+	}
+	resp.Body.Close()
+	return u.String()
+}
+
+// mixedContent returns the http URL an element on an https page loads, if any
+func mixedContent(e *colly.HTMLElement) string {
+	if e.Request.URL.Scheme != "https" {
+		return ""
+	}
+	// a <link> only loads something for stylesheets, icons, preloads and the like
+	if e.Name == "link" {
+		switch e.Attr("rel") {
+		case "", "alternate", "canonical", "next", "prev", "author", "help", "license", "search", "bookmark", "amphtml":
+			return ""
+		}
+	}
+	attr := "src"
+	switch e.Name {
+	case "link":
+		attr = "href"
+	case "object":
+		attr = "data"
+	}
+	resource := e.Request.AbsoluteURL(e.Attr(attr))
+	u, err := url.Parse(resource)
+	if err != nil || u.Scheme != "http" {
+		return ""
+	}
+	return resource
+}
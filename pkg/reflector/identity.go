@@ -0,0 +1,185 @@
+package reflector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// internal header used to tell the transport which identity a probe belongs to,
+// it is stripped before the request leaves
+const identityHeader = "X-Reflector-Identity"
+
+// identity is one proxy + user agent + cookie set that probes can be sent as
+type identity struct {
+	Proxy     string
+	UserAgent string
+	Cookie    string
+
+	probes  int
+	blocked int
+	errors  int
+}
+
+// identityPool hands out identities to probes, moving on to the next one
+// every rotate probes or as soon as the current one looks blocked
+type identityPool struct {
+	mu         sync.Mutex
+	identities []*identity
+	rotate     int
+	current    int
+	used       int
+}
+
+// loadIdentities reads an identity file, one identity per line as
+// proxy;;user-agent;;cookies where any field may be left empty
+func loadIdentities(path string, rotate int) (*identityPool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pool := &identityPool{rotate: rotate}
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := parseIdentity(line)
+		if err != nil {
+			return nil, err
+		}
+		pool.identities = append(pool.identities, id)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(pool.identities) == 0 {
+		return nil, fmt.Errorf("no identities found in %s", path)
+	}
+	if pool.rotate < 1 {
+		pool.rotate = 1
+	}
+	return pool, nil
+}
+
+// parseIdentity reads one proxy;;user-agent;;cookies line. Placeholders are
+// filled in field by field, after the split, so a value holding ;; can't
+// shift the fields after it
+func parseIdentity(line string) (*identity, error) {
+	parts := strings.SplitN(line, ";;", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	for i, part := range parts {
+		resolved, err := resolvePlaceholders(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = resolved
+	}
+	id := &identity{Proxy: parts[0], UserAgent: parts[1], Cookie: parts[2]}
+	if id.Proxy != "" {
+		if _, err := url.Parse(id.Proxy); err != nil {
+			return nil, fmt.Errorf("identity proxy %q: %w", id.Proxy, err)
+		}
+	}
+	return id, nil
+}
+
+// next picks the identity for a new probe and counts it
+func (p *identityPool) next() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.used >= p.rotate {
+		p.current = (p.current + 1) % len(p.identities)
+		p.used = 0
+	}
+	p.used++
+	p.identities[p.current].probes++
+	return p.current
+}
+
+// report records the outcome of a probe, a blocked identity is rotated out immediately
+func (p *identityPool) report(i int, status int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if i < 0 || i >= len(p.identities) {
+		return
+	}
+	id := p.identities[i]
+	switch {
+	case status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		id.blocked++
+		if i == p.current {
+			p.used = p.rotate
+		}
+	case err != nil:
+		id.errors++
+	}
+}
+
+// apply sets the identity's headers on an outgoing probe
+func (p *identityPool) apply(i int, h *http.Header) {
+	id := p.identities[i]
+	h.Set(identityHeader, strconv.Itoa(i))
+	if id.UserAgent != "" {
+		h.Set("User-Agent", id.UserAgent)
+	}
+	if id.Cookie != "" {
+		h.Set("Cookie", id.Cookie)
+	}
+}
+
+// wrap returns a transport sending each probe through its identity's proxy,
+// everything else goes through base untouched
+func (p *identityPool) wrap(base *http.Transport) http.RoundTripper {
+	t := &identityTransport{base: base}
+	for _, id := range p.identities {
+		if id.Proxy == "" {
+			t.transports = append(t.transports, base)
+			continue
+		}
+		proxyURL, _ := url.Parse(id.Proxy)
+		clone := base.Clone()
+		clone.Proxy = http.ProxyURL(proxyURL)
+		t.transports = append(t.transports, clone)
+	}
+	return t
+}
+
+// printStats writes per-identity statistics for the run summary
+func (p *identityPool) printStats(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, id := range p.identities {
+		proxy := id.Proxy
+		if proxy == "" {
+			proxy = "direct"
+		}
+		fmt.Fprintf(w, "[identity] #%d %s probes=%d blocked=%d errors=%d\n", i+1, proxy, id.probes, id.blocked, id.errors)
+	}
+}
+
+type identityTransport struct {
+	base       http.RoundTripper
+	transports []http.RoundTripper
+}
+
+func (t *identityTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i, err := strconv.Atoi(req.Header.Get(identityHeader))
+	if err != nil || i < 0 || i >= len(t.transports) {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Del(identityHeader)
+	return t.transports[i].RoundTrip(req)
+}
@@ -0,0 +1,66 @@
+package reflector
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseIdentity(t *testing.T) {
+	os.Setenv("REFLECTOR_TEST_COOKIE", "sid=a;;b")
+	defer os.Unsetenv("REFLECTOR_TEST_COOKIE")
+	os.Setenv("REFLECTOR_TEST_PROXY", "http://127.0.0.1:8080")
+	defer os.Unsetenv("REFLECTOR_TEST_PROXY")
+
+	tests := []struct {
+		line  string
+		want  identity
+		fails bool
+	}{
+		{
+			line: "http://127.0.0.1:8080;;Mozilla/5.0;;sid=abc",
+			want: identity{Proxy: "http://127.0.0.1:8080", UserAgent: "Mozilla/5.0", Cookie: "sid=abc"},
+		},
+		{
+			line: " socks5://10.0.0.1:1080 ;; curl/8.0 ;; a=1; b=2 ",
+			want: identity{Proxy: "socks5://10.0.0.1:1080", UserAgent: "curl/8.0", Cookie: "a=1; b=2"},
+		},
+		{
+			line: ";;Mozilla/5.0",
+			want: identity{UserAgent: "Mozilla/5.0"},
+		},
+		{
+			line: "http://127.0.0.1:8080",
+			want: identity{Proxy: "http://127.0.0.1:8080"},
+		},
+		{
+			// a value holding ;; stays in its own field
+			line: ";;Mozilla/5.0;;{{env:REFLECTOR_TEST_COOKIE}}",
+			want: identity{UserAgent: "Mozilla/5.0", Cookie: "sid=a;;b"},
+		},
+		{
+			line: "{{env:REFLECTOR_TEST_PROXY}};;;;",
+			want: identity{Proxy: "http://127.0.0.1:8080"},
+		},
+		{
+			line:  ";;;;{{env:REFLECTOR_TEST_UNSET}}",
+			fails: true,
+		},
+		{
+			line:  "http://[::1;;Mozilla/5.0;;",
+			fails: true,
+		},
+	}
+	for _, test := range tests {
+		id, err := parseIdentity(test.line)
+		if (err != nil) != test.fails {
+			t.Errorf("%q: parseIdentity returned %v", test.line, err)
+			continue
+		}
+		if test.fails {
+			continue
+		}
+		if id.Proxy != test.want.Proxy || id.UserAgent != test.want.UserAgent || id.Cookie != test.want.Cookie {
+			t.Errorf("%q: %+v, want %+v", test.line, *id, test.want)
+		}
+	}
+}
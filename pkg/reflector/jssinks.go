@@ -0,0 +1,124 @@
+package reflector
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// scriptPattern is a sink or source looked for in scripts, by the name it is reported as
+type scriptPattern struct {
+	name  string
+	regex *regexp.Regexp
+	// sources worth reporting without a sink in the same script
+	lead bool
+}
+
+var (
+	// JavaScript that writes strings into the DOM, runs them or navigates to them
+	scriptSinks = []scriptPattern{
+		{name: "innerHTML", regex: regexp.MustCompile(`\.innerHTML\s*\+?=[^=]`)},
+		{name: "outerHTML", regex: regexp.MustCompile(`\.outerHTML\s*\+?=[^=]`)},
+		{name: "insertAdjacentHTML", regex: regexp.MustCompile(`\.insertAdjacentHTML\s*\(`)},
+		{name: "document.write", regex: regexp.MustCompile(`document\.write(ln)?\s*\(`)},
+		{name: "eval", regex: regexp.MustCompile(`\beval\s*\(`)},
+		// only with code in a string, a function argument is harmless
+		{name: "setTimeout", regex: regexp.MustCompile("\\bset(Timeout|Interval)\\s*\\(\\s*[\"'`]")},
+		{name: "Function", regex: regexp.MustCompile(`\bnew\s+Function\s*\(`)},
+		{name: "location", regex: regexp.MustCompile(`\blocation(\.href)?\s*=[^=]|\blocation\.(assign|replace)\s*\(`)},
+		{name: "srcdoc", regex: regexp.MustCompile(`\.srcdoc\s*=[^=]`)},
+		{name: "jquery.html", regex: regexp.MustCompile(`\.html\s*\(\s*[^)\s]`)},
+	}
+	// where attacker-controlled strings come from on the client
+	scriptSources = []scriptPattern{
+		{name: "location.hash", regex: regexp.MustCompile(`\blocation\.hash\b`), lead: true},
+		{name: "location.search", regex: regexp.MustCompile(`\blocation\.search\b`)},
+		{name: "document.URL", regex: regexp.MustCompile(`\bdocument\.(URL|documentURI|baseURI)\b`)},
+		{name: "document.referrer", regex: regexp.MustCompile(`\bdocument\.referrer\b`)},
+		{name: "window.name", regex: regexp.MustCompile(`\bwindow\.name\b`)},
+		// postMessage handlers take data from any window that can get a reference to this one
+		{name: "message", regex: regexp.MustCompile(`addEventListener\s*\(\s*["']message["']|\bonmessage\s*=[^=]`), lead: true},
+	}
+)
+
+// scriptMatches returns each pattern found in script as name:line, the line it first appears on
+func scriptMatches(script []byte, patterns []scriptPattern) ([]string, bool) {
+	var found []string
+	lead := false
+	for _, p := range patterns {
+		loc := p.regex.FindIndex(script)
+		if loc == nil {
+			continue
+		}
+		line := bytes.Count(script[:loc[0]], []byte("\n")) + 1
+		found = append(found, p.name+":"+strconv.Itoa(line))
+		lead = lead || p.lead
+	}
+	return found, lead
+}
+
+// scriptScanner statically scans scripts for DOM XSS sinks and sources, each
+// external script and each distinct inline script only once
+type scriptScanner struct {
+	seen sync.Map
+}
+
+// fetch reports whether an external script is new and needs fetching
+func (s *scriptScanner) fetch(link string) bool {
+	_, seen := s.seen.LoadOrStore(link, true)
+	return !seen
+}
+
+// scan reports the sinks and sources in a script at location, an external
+// script's URL or the page an inline script is on, found on page. Scripts
+// with neither a sink nor a lead source give no result, and neither do
+// inline scripts already scanned on another page
+func (s *scriptScanner) scan(script []byte, location, page string, inline bool, tags string) (Result, bool) {
+	if inline {
+		if _, seen := s.seen.LoadOrStore(fmt.Sprintf("inline %x", sha1.Sum(script)), true); seen {
+			return Result{}, false
+		}
+	}
+	sinks, _ := scriptMatches(script, scriptSinks)
+	sources, lead := scriptMatches(script, scriptSources)
+	if len(sinks) == 0 && !lead {
+		return Result{}, false
+	}
+
+	what := "Script " + location
+	if inline {
+		what = "Inline script on " + location
+	}
+	var names []string
+	for _, match := range append(sinks, sources...) {
+		names = append(names, match[:strings.LastIndex(match, ":")])
+	}
+	res := Result{
+		Source: "js-sink",
+		URL:    location,
+		Text:   fmt.Sprintf("%s uses %s", what, strings.Join(names, ", ")),
+	}
+	var fields []string
+	if len(sinks) > 0 {
+		fields = append(fields, "sinks="+strings.Join(sinks, ","))
+	}
+	if len(sources) > 0 {
+		fields = append(fields, "sources="+strings.Join(sources, ","))
+	}
+	if !inline {
+		fields = append(fields, "page="+page)
+	}
+	res.Fields = joinFields(strings.Join(fields, " "), tags)
+	return res, true
+}
+
+// isJavaScript reports whether a script element's type attribute makes it
+// run as a script, rather than hold data or a template
+func isJavaScript(typ string) bool {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	return typ == "" || typ == "module" || strings.Contains(typ, "javascript") || strings.Contains(typ, "ecmascript")
+}
@@ -0,0 +1,117 @@
+package reflector
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// text fields that take a date, in the languages a crawl runs into most,
+	// but not the ones about updates
+	dateFieldRegex = regexp.MustCompile(`(?i)(^|[^p])(date|dob|birth|datum|fecha|giorno|tarih|дата|日付|日期)`)
+	// text fields that take an amount with decimals
+	decimalFieldRegex = regexp.MustCompile(`(?i)(amount|price|cost|total|weight|height|betrag|preis|gewicht|prix|montant|poids|importe|precio|peso|prezzo|importo|bedrag|prijs|kwota|cena|сумма|цена)`)
+)
+
+// fillerLocale is how people whose browser speaks a page's language write
+// dates and decimals, so filled in text fields pass server-side validation
+type fillerLocale struct {
+	// a time.Format layout
+	date    string
+	decimal string
+}
+
+var (
+	usLocale  = fillerLocale{date: "01/02/2006", decimal: "."}
+	isoLocale = fillerLocale{date: "2006-01-02", decimal: "."}
+	// by language tag, region specific tags before their language
+	fillerLocales = map[string]fillerLocale{
+		"en-us": usLocale,
+		"en-ca": isoLocale,
+		"en":    {date: "02/01/2006", decimal: "."},
+		"fr-ca": {date: "2006-01-02", decimal: ","},
+		"fr":    {date: "02/01/2006", decimal: ","},
+		"es":    {date: "02/01/2006", decimal: ","},
+		"it":    {date: "02/01/2006", decimal: ","},
+		"pt":    {date: "02/01/2006", decimal: ","},
+		"el":    {date: "02/01/2006", decimal: ","},
+		"vi":    {date: "02/01/2006", decimal: ","},
+		"de":    {date: "02.01.2006", decimal: ","},
+		"ru":    {date: "02.01.2006", decimal: ","},
+		"uk":    {date: "02.01.2006", decimal: ","},
+		"pl":    {date: "02.01.2006", decimal: ","},
+		"cs":    {date: "02.01.2006", decimal: ","},
+		"sk":    {date: "02.01.2006", decimal: ","},
+		"ro":    {date: "02.01.2006", decimal: ","},
+		"tr":    {date: "02.01.2006", decimal: ","},
+		"fi":    {date: "02.01.2006", decimal: ","},
+		"nb":    {date: "02.01.2006", decimal: ","},
+		"no":    {date: "02.01.2006", decimal: ","},
+		"da":    {date: "02.01.2006", decimal: ","},
+		"nl":    {date: "02-01-2006", decimal: ","},
+		"sv":    {date: "2006-01-02", decimal: ","},
+		"lt":    {date: "2006-01-02", decimal: ","},
+		"hu":    {date: "2006.01.02", decimal: ","},
+		"ja":    {date: "2006/01/02", decimal: "."},
+		"zh":    {date: "2006/01/02", decimal: "."},
+		"ko":    {date: "2006.01.02", decimal: "."},
+	}
+)
+
+// localeFor returns the date and decimal conventions of a language tag,
+// e.g. de-AT, US English for pages that don't say
+func localeFor(lang string) fillerLocale {
+	lang = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+	if lang == "" {
+		return usLocale
+	}
+	if locale, ok := fillerLocales[lang]; ok {
+		return locale
+	}
+	if locale, ok := fillerLocales[strings.SplitN(lang, "-", 2)[0]]; ok {
+		return locale
+	}
+	return isoLocale
+}
+
+// typedFillerValue is what a browser would submit for an input type with
+// a fixed wire format, whatever the language, "" for other types
+func typedFillerValue(typ string, now time.Time) string {
+	switch typ {
+	case "date":
+		return now.Format("2006-01-02")
+	case "datetime-local":
+		return now.Format("2006-01-02T15:04")
+	case "month":
+		return now.Format("2006-01")
+	case "week":
+		year, week := now.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "time":
+		return "12:00"
+	case "number", "range":
+		return "1"
+	case "url":
+		return "https://example.com/"
+	case "tel":
+		return "5555555555"
+	case "color":
+		return "#000000"
+	}
+	return ""
+}
+
+// localizedFillerValue is a date or an amount written the way lang does,
+// for text fields whose name asks for one, "" for other fields
+func localizedFillerValue(name, lang string, now time.Time) string {
+	locale := localeFor(lang)
+	switch {
+	case dateFieldRegex.MatchString(name):
+		return now.Format(locale.date)
+	case decimalFieldRegex.MatchString(name):
+		return "1" + locale.decimal + "50"
+	}
+	return ""
+}
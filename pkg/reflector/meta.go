@@ -0,0 +1,95 @@
+package reflector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// targetMeta is the connection metadata recorded for a target
+type targetMeta struct {
+	Target     string
+	Proto      string
+	Server     string
+	TLSVersion string
+	ALPN       string
+	Subject    string
+	SANs       []string
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS1.0",
+	tls.VersionTLS11: "TLS1.1",
+	tls.VersionTLS12: "TLS1.2",
+	tls.VersionTLS13: "TLS1.3",
+}
+
+// fetchTargetMeta requests the target once and records its HTTP version, server
+// banner and TLS details. HTTP/2 is offered so ALPN shows what the server prefers
+func fetchTargetMeta(transport *http.Transport, target string, headers map[string]string) (targetMeta, error) {
+	meta := targetMeta{Target: target}
+
+	t := transport.Clone()
+	t.ForceAttemptHTTP2 = true
+	client := &http.Client{
+		Transport: t,
+		Timeout:   10 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return meta, err
+	}
+	for header, value := range headers {
+		req.Header.Set(header, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return meta, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	meta.Proto = resp.Proto
+	meta.Server = resp.Header.Get("Server")
+	if resp.TLS != nil {
+		meta.TLSVersion = tlsVersions[resp.TLS.Version]
+		meta.ALPN = resp.TLS.NegotiatedProtocol
+		if len(resp.TLS.PeerCertificates) > 0 {
+			cert := resp.TLS.PeerCertificates[0]
+			meta.Subject = cert.Subject.String()
+			meta.SANs = append(meta.SANs, cert.DNSNames...)
+			for _, ip := range cert.IPAddresses {
+				meta.SANs = append(meta.SANs, ip.String())
+			}
+		}
+	}
+	return meta, nil
+}
+
+// print writes the metadata as one summary line
+func (m targetMeta) print(w io.Writer) {
+	fields := []string{"proto=" + m.Proto}
+	if m.Server != "" {
+		fields = append(fields, fmt.Sprintf("server=%q", m.Server))
+	}
+	if m.TLSVersion != "" {
+		fields = append(fields, "tls="+m.TLSVersion)
+	}
+	if m.ALPN != "" {
+		fields = append(fields, "alpn="+m.ALPN)
+	}
+	if m.Subject != "" {
+		fields = append(fields, fmt.Sprintf("subject=%q", m.Subject))
+	}
+	if len(m.SANs) > 0 {
+		fields = append(fields, "san="+strings.Join(m.SANs, ","))
+	}
+	fmt.Fprintf(w, "[meta] %s %s\n", m.Target, strings.Join(fields, " "))
+}
@@ -0,0 +1,106 @@
+package reflector
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a method nothing implements, what an endpoint answers to it is what it
+// answers to methods it doesn't accept
+const bogusMethod = "REFLECTOR"
+
+// methods every endpoint is expected to answer to, not worth reporting from an Allow header
+var commonMethods = map[string]bool{"GET": true, "HEAD": true, "POST": true, "OPTIONS": true}
+
+// methodProber tries the methods of Options.Methods on each endpoint once
+type methodProber struct {
+	methods []string
+	seen    sync.Map
+}
+
+func newMethodProber(methods []string) *methodProber {
+	m := &methodProber{}
+	for _, method := range methods {
+		m.methods = append(m.methods, strings.ToUpper(method))
+	}
+	return m
+}
+
+// check tries each method on target. OPTIONS gives the methods listed in the
+// Allow header, any other method counts as accepted when it's answered with
+// another status than the bogus method and one that isn't 405 or 501. The
+// accepted methods come back with their status, e.g. PUT:204
+func (m *methodProber) check(p *prober, target string) (accepted []string, allow string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, ""
+	}
+	endpoint := u.Scheme + "://" + u.Host + u.Path
+	if _, seen := m.seen.LoadOrStore(endpoint, true); seen {
+		return nil, ""
+	}
+
+	baseline := 0
+	for _, method := range m.methods {
+		if method == "OPTIONS" {
+			resp, _, err := p.do("OPTIONS", target, nil, nil)
+			if err == nil {
+				allow = resp.Header.Get("Allow")
+			}
+			continue
+		}
+		if baseline == 0 {
+			resp, _, err := p.do(bogusMethod, target, nil, nil)
+			if err != nil {
+				return nil, allow
+			}
+			baseline = resp.StatusCode
+		}
+		resp, _, err := p.do(method, target, nil, nil)
+		if err != nil {
+			continue
+		}
+		switch resp.StatusCode {
+		case baseline, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+			continue
+		}
+		accepted = append(accepted, method+":"+strconv.Itoa(resp.StatusCode))
+	}
+	return accepted, allow
+}
+
+// methodsResult reports the methods target accepts, if any are worth knowing about
+func methodsResult(target string, accepted []string, allow, tags string) (Result, bool) {
+	var listed []string
+	unusual := false
+	for _, method := range strings.Split(allow, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			listed = append(listed, method)
+			unusual = unusual || !commonMethods[method]
+		}
+	}
+	if len(accepted) == 0 && !unusual {
+		return Result{}, false
+	}
+
+	var names []string
+	for _, method := range accepted {
+		names = append(names, method[:strings.Index(method, ":")])
+	}
+	text := fmt.Sprintf("Endpoint %s accepts %s", target, strings.Join(names, ", "))
+	if len(names) == 0 {
+		text = fmt.Sprintf("Endpoint %s allows %s", target, strings.Join(listed, ", "))
+	}
+	var fields []string
+	if len(accepted) > 0 {
+		fields = append(fields, "methods="+strings.Join(accepted, ","))
+	}
+	if len(listed) > 0 {
+		fields = append(fields, "allow="+strings.Join(listed, ","))
+	}
+	return Result{Source: "methods", URL: target, Text: text, Fields: joinFields(strings.Join(fields, " "), tags)}, true
+}
@@ -0,0 +1,279 @@
+package reflector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Mutation rewrites the second-stage payloads of a reflection, which are
+// then sent again, to find out which variants a filter lets through
+type Mutation struct {
+	// reported in the mutations= and failed-mutations= fields
+	Name string
+	// Rewrite returns a variant of payload, in which canary has to stay as
+	// it is for the variant to be found. nil leaves payloads as they are
+	Rewrite func(payload, canary string) string
+	// POST bodies are sent with chunked transfer encoding, in chunks of this
+	// many bytes. 0 sends them whole
+	Chunk int
+}
+
+// MutationResult is whether a mutated payload came back intact
+type MutationResult struct {
+	Param    string
+	Payload  string
+	Mutation string
+	Status   int
+	Worked   bool
+}
+
+// mutationRule is a mutation as written in a -mutations file
+type mutationRule struct {
+	Name    string            `yaml:"name"`
+	Case    string            `yaml:"case"`
+	Replace map[string]string `yaml:"replace"`
+	Comment string            `yaml:"comment"`
+	Chunk   int               `yaml:"chunk"`
+}
+
+// LoadMutations reads a YAML list of mutations, each rewriting payloads
+// with any of:
+//
+//	# mutations.yaml
+//	- name: shuffled
+//	  case: shuffle        # or upper or lower
+//	- name: slashes
+//	  comment: /           # in place of each space, e.g. <img/src=x/onerror=...>
+//	- name: entities
+//	  replace: {"(": "&#40;"}
+//	- name: chunked
+//	  chunk: 3             # POST bodies in chunks of 3 bytes
+//
+// The rewrites of a mutation apply in that order, never to the canary
+func LoadMutations(path string) ([]Mutation, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []mutationRule
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	var mutations []Mutation
+	seen := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("mutation %d has no name", i+1)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("mutation %s is defined twice", rule.Name)
+		}
+		seen[rule.Name] = true
+		switch rule.Case {
+		case "", "shuffle", "upper", "lower":
+		default:
+			return nil, fmt.Errorf("mutation %s: case is shuffle, upper or lower, not %s", rule.Name, rule.Case)
+		}
+		if rule.Chunk < 0 {
+			return nil, fmt.Errorf("mutation %s: negative chunk size", rule.Name)
+		}
+		m := Mutation{Name: rule.Name, Chunk: rule.Chunk}
+		if rule.Case != "" || len(rule.Replace) > 0 || rule.Comment != "" {
+			m.Rewrite = rule.rewrite
+		} else if rule.Chunk == 0 {
+			return nil, fmt.Errorf("mutation %s changes nothing", rule.Name)
+		}
+		mutations = append(mutations, m)
+	}
+	if len(mutations) == 0 {
+		return nil, errors.New("no mutations")
+	}
+	return mutations, nil
+}
+
+// rewrite applies the rule to the parts of payload around canary
+func (rule mutationRule) rewrite(payload, canary string) string {
+	parts := strings.Split(payload, canary)
+	for i, part := range parts {
+		parts[i] = rule.rewritePart(part)
+	}
+	return strings.Join(parts, canary)
+}
+
+func (rule mutationRule) rewritePart(s string) string {
+	switch rule.Case {
+	case "shuffle":
+		// letters alternate, so the same payload always gets the same variant
+		upper := true
+		s = strings.Map(func(r rune) rune {
+			if !unicode.IsLetter(r) {
+				return r
+			}
+			upper = !upper
+			if upper {
+				return unicode.ToUpper(r)
+			}
+			return unicode.ToLower(r)
+		}, s)
+	case "upper":
+		s = strings.ToUpper(s)
+	case "lower":
+		s = strings.ToLower(s)
+	}
+	// longest first, so a replacement isn't cut short by one of its prefixes
+	from := make([]string, 0, len(rule.Replace))
+	for f := range rule.Replace {
+		if f != "" {
+			from = append(from, f)
+		}
+	}
+	sort.Slice(from, func(i, j int) bool {
+		if len(from[i]) != len(from[j]) {
+			return len(from[i]) > len(from[j])
+		}
+		return from[i] < from[j]
+	})
+	if len(from) > 0 {
+		var pairs []string
+		for _, f := range from {
+			pairs = append(pairs, f, rule.Replace[f])
+		}
+		s = strings.NewReplacer(pairs...).Replace(s)
+	}
+	if rule.Comment != "" {
+		s = strings.ReplaceAll(s, " ", rule.Comment)
+	}
+	return s
+}
+
+// chunkedReader hands out at most n bytes per Read, each of which the
+// transport sends as a chunk of its own
+type chunkedReader struct {
+	r io.Reader
+	n int
+}
+
+func (c chunkedReader) Read(p []byte) (int, error) {
+	if len(p) > c.n {
+		p = p[:c.n]
+	}
+	return c.r.Read(p)
+}
+
+// submitMutated sends f with inj's hashes like submit, a POST body in
+// chunks of the mutation's size if it has one
+func (p *prober) submitMutated(f Form, inj injection, m Mutation) (int, []byte, error) {
+	if m.Chunk == 0 || f.Method != "POST" {
+		resp, body, err := p.submit(f, inj)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode, body, nil
+	}
+	f = p.freshTokens(f)
+	// a reader of unknown length makes the transport chunk the body
+	body := chunkedReader{r: bytes.NewReader(generateFormData(f, inj)), n: m.Chunk}
+	resp, respBody, err := p.do("POST", f.URL, body, f.Headers)
+	if err != nil {
+		return 0, nil, err
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// mutatedPayloads sends the payloads picked for each of params again with
+// every mutation, one round per mutation and payload like workingPayloads.
+// A mutation that leaves a payload as it was, or a GET probe without a
+// body to chunk, isn't sent
+func mutatedPayloads(p *prober, f Form, inj injection, params []string, contexts map[string][]string, chars map[string]string, mutations []Mutation) []MutationResult {
+	picked, rounds := pickPayloads(params, contexts, chars)
+	var results []MutationResult
+	for _, m := range mutations {
+		if m.Rewrite == nil && f.Method != "POST" {
+			continue
+		}
+		for round := 0; round < rounds; round++ {
+			probe := injection{
+				FormLocation: inj.FormLocation,
+				Params:       inj.Params,
+				Hashes:       make([]string, len(inj.Hashes)),
+			}
+			sent := make(map[string]string)
+			for i, name := range inj.Params {
+				if inj.Hashes[i] == "" || round >= len(picked[name]) {
+					continue
+				}
+				canary := newCanary(name)
+				value := fmt.Sprintf(picked[name][round].template, canary)
+				if m.Rewrite != nil {
+					mutated := m.Rewrite(value, canary)
+					if mutated == value && m.Chunk == 0 {
+						continue
+					}
+					value = mutated
+				}
+				probe.Hashes[i] = value
+				sent[name] = value
+			}
+			if len(sent) == 0 {
+				continue
+			}
+			status, body, err := p.submitMutated(f, probe, m)
+			if err != nil {
+				continue
+			}
+			for _, name := range params {
+				if value, ok := sent[name]; ok {
+					results = append(results, MutationResult{
+						Param:    name,
+						Payload:  picked[name][round].name,
+						Mutation: m.Name,
+						Status:   status,
+						Worked:   bytes.Contains(body, []byte(value)),
+					})
+				}
+			}
+		}
+	}
+	return results
+}
+
+// mutationFields formats mutation results for output, e.g.
+// "mutations=q:shuffled/event-handler failed-mutations=q:chunked/tag-injection@403"
+func mutationFields(params []string, results []MutationResult) string {
+	var worked, failed []string
+	for _, param := range params {
+		var ok, not []string
+		for _, r := range results {
+			switch {
+			case r.Param != param:
+			case r.Worked:
+				ok = append(ok, r.Mutation+"/"+r.Payload)
+			default:
+				not = append(not, r.Mutation+"/"+r.Payload+"@"+strconv.Itoa(r.Status))
+			}
+		}
+		if len(ok) > 0 {
+			worked = append(worked, param+":"+strings.Join(ok, "|"))
+		}
+		if len(not) > 0 {
+			failed = append(failed, param+":"+strings.Join(not, "|"))
+		}
+	}
+	var fields []string
+	if len(worked) > 0 {
+		fields = append(fields, "mutations="+strings.Join(worked, ","))
+	}
+	if len(failed) > 0 {
+		fields = append(fields, "failed-mutations="+strings.Join(failed, ","))
+	}
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,383 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// limits on what API specs may add to a crawl
+const (
+	maxSpecBytes      = 10 << 20
+	maxSpecOperations = 2000
+)
+
+// where frameworks serve their OpenAPI and Swagger specs
+var specPaths = []string{
+	"/swagger.json",
+	"/swagger.yaml",
+	"/openapi.json",
+	"/openapi.yaml",
+	"/v2/api-docs",
+	"/v3/api-docs",
+	"/api-docs",
+	"/swagger/v1/swagger.json",
+	"/swagger/doc.json",
+	"/api/swagger.json",
+	"/api/openapi.json",
+	"/api/v1/swagger.json",
+	"/docs/openapi.json",
+}
+
+// path parameters a spec doesn't declare, e.g. {id}
+var specTemplateRegex = regexp.MustCompile(`\{[^/{}]+\}`)
+
+// apiOperation is an endpoint documented in an OpenAPI or Swagger spec,
+// with values synthesized for its parameters
+type apiOperation struct {
+	method string
+	// with its path parameters filled in, without a query
+	url   string
+	query []Input
+	// the fields of a urlencoded or multipart body
+	form []Input
+	// the operation takes a JSON body, which isn't probed
+	json bool
+	spec string
+}
+
+// link is the operation's URL with its query parameters filled in
+func (op apiOperation) link() string {
+	if len(op.query) == 0 {
+		return op.url
+	}
+	values := url.Values{}
+	for _, in := range op.query {
+		values.Add(in.Name, fillerValue(in, ""))
+	}
+	return op.url + "?" + values.Encode()
+}
+
+// probe is the form a probe of the operation submits, false for operations
+// with nothing to put hashes in
+func (op apiOperation) probe() (Form, bool) {
+	switch {
+	case op.method == "GET" && len(op.query) > 0:
+		return Form{URL: op.url, Method: "GET", Inputs: op.query, Page: op.spec}, true
+	case op.method == "POST" && len(op.form) > 0:
+		// the query goes along as is, only the body gets hashes
+		return Form{URL: op.link(), Method: "POST", Inputs: op.form, Page: op.spec}, true
+	}
+	return Form{}, false
+}
+
+func (op apiOperation) fields() string {
+	var names []string
+	for _, in := range append(append([]Input{}, op.query...), op.form...) {
+		names = append(names, in.Name)
+	}
+	fields := []string{"spec=" + op.spec}
+	if len(names) > 0 {
+		fields = append(fields, "params="+strings.Join(names, ","))
+	}
+	if op.json {
+		fields = append(fields, "body=json")
+	}
+	return strings.Join(fields, " ")
+}
+
+// discoverSpecs fetches the common spec paths on the target's host and
+// returns the operations the specs found there document, each once
+func discoverSpecs(client *http.Client, target string) []apiOperation {
+	base, err := url.Parse(target)
+	if err != nil || base.Host == "" {
+		return nil
+	}
+	var ops []apiOperation
+	seen := make(map[string]bool)
+	for _, path := range specPaths {
+		spec := base.Scheme + "://" + base.Host + path
+		data, err := fetchSpec(client, spec)
+		if err != nil {
+			continue
+		}
+		specURL, _ := url.Parse(spec)
+		for _, op := range parseSpec(data, specURL) {
+			key := op.method + " " + op.url
+			if !seen[key] && len(ops) < maxSpecOperations {
+				seen[key] = true
+				ops = append(ops, op)
+			}
+		}
+	}
+	return ops
+}
+
+func fetchSpec(client *http.Client, spec string) ([]byte, error) {
+	resp, err := client.Get(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("spec %s: %s", spec, resp.Status)
+	}
+	// single page apps answer every path with their index
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		return nil, fmt.Errorf("spec %s: not a spec", spec)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxSpecBytes))
+}
+
+// parseSpec returns the operations a Swagger 2 or OpenAPI 3 spec, in JSON
+// or YAML, documents, nothing for anything else
+func parseSpec(data []byte, specURL *url.URL) []apiOperation {
+	var root interface{}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+	doc := specMap(root)
+	paths := specMap(doc["paths"])
+	if doc == nil || paths == nil || (doc["swagger"] == nil && doc["openapi"] == nil) {
+		return nil
+	}
+	base := specBase(doc, specURL)
+
+	// paths are sorted for the crawl to go the same way every time
+	templates := make([]string, 0, len(paths))
+	for template := range paths {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+
+	var ops []apiOperation
+	for _, template := range templates {
+		item := specMap(resolveRef(doc, paths[template]))
+		for _, method := range []string{"get", "post", "put", "patch", "delete"} {
+			operation := specMap(item[method])
+			if operation == nil {
+				continue
+			}
+			op := apiOperation{method: strings.ToUpper(method), spec: specURL.String()}
+			path := template
+			// an operation's parameters override the path's of the same name and location
+			params := make(map[string]map[string]interface{})
+			var order []string
+			for _, list := range []interface{}{item["parameters"], operation["parameters"]} {
+				for _, p := range specList(list) {
+					param := specMap(resolveRef(doc, p))
+					name, _ := param["name"].(string)
+					in, _ := param["in"].(string)
+					if name == "" {
+						continue
+					}
+					if params[in+" "+name] == nil {
+						order = append(order, in+" "+name)
+					}
+					params[in+" "+name] = param
+				}
+			}
+			for _, key := range order {
+				param := params[key]
+				name := param["name"].(string)
+				switch param["in"] {
+				case "path":
+					path = strings.ReplaceAll(path, "{"+name+"}", url.PathEscape(specValue(doc, param)))
+				case "query":
+					op.query = append(op.query, specInput(doc, name, param))
+				case "formData":
+					if param["type"] != "file" {
+						op.form = append(op.form, specInput(doc, name, param))
+					}
+				case "body":
+					op.json = true
+				}
+			}
+			path = specTemplateRegex.ReplaceAllString(path, "1")
+			if body := specMap(resolveRef(doc, operation["requestBody"])); body != nil {
+				content := specMap(body["content"])
+				for _, typ := range []string{"application/x-www-form-urlencoded", "multipart/form-data"} {
+					if media := specMap(content[typ]); media != nil && len(op.form) == 0 {
+						op.form = bodyInputs(doc, media["schema"])
+					}
+				}
+				for typ := range content {
+					if strings.Contains(typ, "json") {
+						op.json = true
+					}
+				}
+			}
+			// relative to the base, "./" keeps a colon in the first segment out of the scheme
+			ref, err := url.Parse("./" + strings.TrimPrefix(path, "/"))
+			if err != nil {
+				continue
+			}
+			op.url = base.ResolveReference(ref).String()
+			ops = append(ops, op)
+		}
+	}
+	return ops
+}
+
+// specBase is the URL a spec's paths are relative to, with a trailing
+// slash: the first server of an OpenAPI 3 spec, the host and base path of
+// a Swagger 2 one, the spec's own host if they don't say
+func specBase(doc map[string]interface{}, specURL *url.URL) *url.URL {
+	base := &url.URL{Scheme: specURL.Scheme, Host: specURL.Host, Path: "/"}
+	if servers := specList(doc["servers"]); len(servers) > 0 {
+		server := specMap(servers[0])
+		link, _ := server["url"].(string)
+		// server variables take their defaults
+		for name, v := range specMap(server["variables"]) {
+			if value, ok := specMap(v)["default"]; ok {
+				link = strings.ReplaceAll(link, "{"+name+"}", fmt.Sprint(value))
+			}
+		}
+		if ref, err := url.Parse(link); err == nil && link != "" {
+			base = specURL.ResolveReference(ref)
+		}
+	} else {
+		if host, ok := doc["host"].(string); ok && host != "" {
+			base.Host = host
+			schemes := specList(doc["schemes"])
+			if len(schemes) > 0 && !containsScheme(schemes, specURL.Scheme) {
+				base.Scheme = fmt.Sprint(schemes[0])
+			}
+		}
+		if path, ok := doc["basePath"].(string); ok && path != "" {
+			base.Path = path
+		}
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	base.RawQuery, base.Fragment = "", ""
+	return base
+}
+
+func containsScheme(schemes []interface{}, scheme string) bool {
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyInputs returns a field for each property of a body's schema
+func bodyInputs(doc map[string]interface{}, schema interface{}) []Input {
+	properties := specMap(specMap(resolveRef(doc, schema))["properties"])
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var inputs []Input
+	for _, name := range names {
+		property := specMap(resolveRef(doc, properties[name]))
+		if property["format"] == "binary" {
+			continue
+		}
+		inputs = append(inputs, specInput(doc, name, property))
+	}
+	return inputs
+}
+
+// specInput is a form field for a parameter or property, an email field
+// when the spec says it takes one
+func specInput(doc map[string]interface{}, name string, param map[string]interface{}) Input {
+	in := Input{Type: "text", Name: name, Value: specValue(doc, param)}
+	if specSchema(doc, param)["format"] == "email" {
+		in.Type = "email"
+	}
+	return in
+}
+
+// specSchema is a parameter's schema, Swagger 2 parameters are their own
+func specSchema(doc map[string]interface{}, param map[string]interface{}) map[string]interface{} {
+	if schema := specMap(resolveRef(doc, param["schema"])); schema != nil {
+		return schema
+	}
+	return param
+}
+
+// specValue is a value for a parameter or property: its example, default
+// or first enum value, or one of its type and format
+func specValue(doc map[string]interface{}, param map[string]interface{}) string {
+	schema := specSchema(doc, param)
+	for _, m := range []map[string]interface{}{param, schema} {
+		for _, key := range []string{"example", "default"} {
+			if value, ok := m[key]; ok && value != nil && specMap(value) == nil && specList(value) == nil {
+				return fmt.Sprint(value)
+			}
+		}
+		if enum := specList(m["enum"]); len(enum) > 0 && enum[0] != nil {
+			return fmt.Sprint(enum[0])
+		}
+	}
+	now := time.Now()
+	switch schema["format"] {
+	case "date":
+		return typedFillerValue("date", now)
+	case "date-time":
+		return now.UTC().Format(time.RFC3339)
+	case "uuid":
+		return "00000000-0000-0000-0000-000000000000"
+	case "email":
+		return "test@example.com"
+	}
+	switch schema["type"] {
+	case "boolean":
+		return "true"
+	case "integer", "number":
+		return "1"
+	}
+	return "test"
+}
+
+// resolveRef follows a node's local $refs, e.g. #/components/parameters/page
+func resolveRef(doc map[string]interface{}, node interface{}) interface{} {
+	for i := 0; i < 10; i++ {
+		ref, ok := specMap(node)["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return node
+		}
+		var target interface{} = doc
+		for _, name := range strings.Split(ref[2:], "/") {
+			name = strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+			target = specMap(target)[name]
+		}
+		node = target
+	}
+	return node
+}
+
+// specMap returns a decoded mapping with its keys as strings, nil for
+// anything else. YAML mappings with non-string keys, like the status codes
+// of responses, decode with interface{} keys
+func specMap(node interface{}) map[string]interface{} {
+	switch m := node.(type) {
+	case map[string]interface{}:
+		return m
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for k, v := range m {
+			converted[fmt.Sprint(k)] = v
+		}
+		return converted
+	}
+	return nil
+}
+
+func specList(node interface{}) []interface{} {
+	list, _ := node.([]interface{})
+	return list
+}
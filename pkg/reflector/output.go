@@ -0,0 +1,119 @@
+package reflector
+
+import (
+	"strings"
+	"time"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+)
+
+// waitForOutput blocks while the results buffer is full, so a slow consumer
+// holds up new requests instead of fetched pages piling up in memory
+// waiting for their turn to be written. Sends on an unbuffered channel
+// already wait for the consumer
+func waitForOutput(results chan<- Result) {
+	for cap(results) > 0 && len(results) == cap(results) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Result is a discovered URL or a finding. Source says which: href, script,
+// form, link, img, srcset, iframe, meta-refresh, object, area, style,
+// data-attr, websocket, robots, sitemap, openapi, route, alternate, feed, reflector,
+// cross-page, stored, js-sink, comment, meta, mixed-content, cookie, csrf-candidate,
+// cors, methods, clickjacking or hidden-param
+type Result struct {
+	Source string
+	URL    string
+	// what was found, plain URLs have no text
+	Text string
+	// the form, for form results
+	Method string
+	Inputs []Input
+	// details of reflector results
+	Reflection *ReflectionResult
+	// space separated key=value annotations, e.g. "confidence=confirmed tag=staging"
+	Fields string
+}
+
+// ReflectionResult is a set of parameters whose hashes came back in a response
+type ReflectionResult struct {
+	// the form or URL the hashes were injected into
+	Form   string
+	Params []string
+	// confirmed, likely, tentative or browser-verified
+	Confidence string
+	// vulnerability classes, e.g. reflected-xss-candidate
+	Classes []string
+	// body, attribute:<name> or header:<name>
+	Locations []string
+	// syntactic contexts per parameter, e.g. attribute-double or script-string-single
+	Contexts map[string][]string
+	// special characters from <>"'&;() that came back unencoded, per parameter
+	Chars map[string]string
+	// second-stage payloads picked for the contexts and characters that came
+	// back intact, per parameter, e.g. attribute-breakout
+	Payloads map[string][]string
+	// the payloads sent again with each of Options.Mutations, and whether they came back
+	Mutations []MutationResult
+}
+
+// Line formats the result as a line of text output
+func (r Result) Line(showSource bool) string {
+	line := r.Text
+	if line == "" {
+		line = r.URL
+	}
+	if showSource {
+		line = "[" + r.Source + "] " + line
+	}
+	if r.Fields != "" {
+		line = line + " " + r.Fields
+	}
+	return line
+}
+
+// Finding reports whether the result is a finding rather than a discovered URL or form
+func (r Result) Finding() bool {
+	switch r.Source {
+	case "href", "script", "form", "link", "img", "srcset", "iframe", "meta-refresh", "object", "area", "style", "data-attr",
+		"websocket", "robots", "sitemap", "openapi", "route", "alternate", "feed", "end":
+		return false
+	}
+	return true
+}
+
+// Schema returns the result as a versioned schema.Result, with the reflection's
+// form and params and the annotations as a fields map
+func (r Result) Schema() schema.Result {
+	res := schema.Result{
+		SchemaVersion: schema.Version,
+		Source:        r.Source,
+		URL:           r.URL,
+		Text:          r.Text,
+		Method:        r.Method,
+	}
+	for _, in := range r.Inputs {
+		res.Inputs = append(res.Inputs, schema.Input{Type: in.Type, Name: in.Name, Value: in.Value})
+	}
+	if r.Reflection != nil {
+		res.Form, res.Params = r.Reflection.Form, r.Reflection.Params
+	}
+	for _, field := range strings.Fields(r.Fields) {
+		if res.Fields == nil {
+			res.Fields = make(map[string]string)
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) == 2 {
+			res.Fields[parts[0]] = parts[1]
+		} else {
+			res.Fields[parts[0]] = ""
+		}
+	}
+	return res
+}
+
+// MarshalJSON writes the result as one line of JSON in the format of schema.Result
+func (r Result) MarshalJSON() ([]byte, error) {
+	return r.Schema().JSON()
+}
@@ -0,0 +1,205 @@
+package reflector
+
+import (
+	"bytes"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// limits on guessing parameters: names per request, names tried and
+// requests sent per endpoint
+const (
+	guessBatch       = 50
+	maxGuessedNames  = 500
+	maxGuessRequests = 100
+)
+
+// names apps commonly take without linking to them, tried on top of the ones mined from the crawl
+var commonParamNames = []string{
+	"id", "q", "query", "search", "s", "keyword", "keywords", "term", "page", "p", "limit", "offset",
+	"sort", "order", "filter", "category", "tag", "type", "lang", "locale", "language", "country",
+	"redirect", "redirect_uri", "redirect_url", "redirectUrl", "return", "returnUrl", "return_to",
+	"returnTo", "next", "continue", "url", "uri", "target", "dest", "destination", "goto", "ref",
+	"referrer", "callback", "jsonp", "cb", "debug", "test", "preview", "mode", "view", "template",
+	"theme", "layout", "format", "output", "action", "cmd", "file", "path", "dir", "name", "email",
+	"user", "username", "token", "key", "source", "error", "message", "msg", "title", "text",
+	"content", "data", "value", "from", "to", "date", "start", "end", "year", "month", "step",
+	"utm_source", "utm_medium", "utm_campaign", "admin", "edit", "show", "hidden", "include",
+}
+
+// guessNames returns the common names followed by the mined ones, each once
+func guessNames(mined []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(append([]string{}, commonParamNames...), mined...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// responseShape is what a guessed parameter must change for it to count:
+// the status, where a redirect goes, and the number of words. Word counts
+// of pages that vary by themselves aren't compared
+type responseShape struct {
+	status   int
+	location string
+	words    int
+}
+
+// paramGuesser looks for the parameters an endpoint takes without linking
+// to them, Arjun-style: it sends batches of guessed names with values of
+// their own and narrows down the batches that change the response, or
+// reflect a value, to the names responsible
+type paramGuesser struct {
+	p        *prober
+	endpoint *url.URL
+	base     responseShape
+	// whether word counts hold still between two identical requests
+	stableWords bool
+	sent        int
+	// the names found, and the ones of them whose values came back in the body
+	found     []string
+	reflected map[string]bool
+}
+
+// guessParams returns the parameters of names that endpoint takes, and the
+// ones of them it reflects. Names already in its query string are skipped
+func guessParams(p *prober, endpoint *url.URL, names []string) ([]string, map[string]bool) {
+	g := &paramGuesser{p: p, endpoint: endpoint, reflected: make(map[string]bool)}
+	first, _, ok := g.send(nil)
+	if !ok {
+		return nil, nil
+	}
+	second, _, ok := g.send(nil)
+	if !ok || first.status != second.status || first.location != second.location {
+		// a page that answers differently every time can't be diffed
+		return nil, nil
+	}
+	g.base, g.stableWords = first, first.words == second.words
+
+	existing := endpoint.Query()
+	var candidates []string
+	for _, name := range names {
+		if _, ok := existing[name]; !ok && len(candidates) < maxGuessedNames {
+			candidates = append(candidates, name)
+		}
+	}
+	for start := 0; start < len(candidates); start += guessBatch {
+		end := start + guessBatch
+		if end > len(candidates) {
+			end = len(candidates)
+		}
+		g.narrow(candidates[start:end])
+	}
+	sort.Strings(g.found)
+	return g.found, g.reflected
+}
+
+// narrow finds the names in batch that change the response, halving the
+// batch until each is down to one name. Reflected names are found as
+// soon as their values come back, whatever the rest of the response does
+func (g *paramGuesser) narrow(batch []string) {
+	if len(batch) == 0 || g.sent >= maxGuessRequests {
+		return
+	}
+	values := make(map[string]string, len(batch))
+	for _, name := range batch {
+		values[name] = strings.ToLower(randomString(8))
+	}
+	shape, body, ok := g.send(values)
+	if !ok {
+		return
+	}
+	var rest []string
+	for _, name := range batch {
+		if bytes.Contains(body, []byte(values[name])) {
+			g.reflected[name] = true
+			g.found = append(g.found, name)
+		} else {
+			rest = append(rest, name)
+		}
+	}
+	if len(rest) == len(batch) && !g.changed(shape) {
+		return
+	}
+	if len(rest) < len(batch) {
+		// the reflected names may be all that changed, try the rest on their own
+		g.narrow(rest)
+		return
+	}
+	if len(rest) == 1 {
+		g.found = append(g.found, rest[0])
+		return
+	}
+	g.narrow(rest[:len(rest)/2])
+	g.narrow(rest[len(rest)/2:])
+}
+
+// changed reports whether a response differs from the endpoint's own
+func (g *paramGuesser) changed(shape responseShape) bool {
+	if shape.status != g.base.status || shape.location != g.base.location {
+		return true
+	}
+	return g.stableWords && shape.words != g.base.words
+}
+
+// send requests the endpoint with values added to its query string
+func (g *paramGuesser) send(values map[string]string) (responseShape, []byte, bool) {
+	g.sent++
+	u := *g.endpoint
+	query := u.Query()
+	for name, value := range values {
+		query.Set(name, value)
+	}
+	u.RawQuery = query.Encode()
+	resp, body, err := g.p.do("GET", u.String(), nil, nil)
+	if err != nil {
+		return responseShape{}, nil, false
+	}
+	// the values themselves mustn't count as words the page gained
+	counted := body
+	for _, value := range values {
+		counted = bytes.ReplaceAll(counted, []byte(value), nil)
+	}
+	shape := responseShape{status: resp.StatusCode, words: len(bytes.Fields(counted))}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		shape.location = resp.Header.Get("Location")
+		for _, value := range values {
+			shape.location = strings.ReplaceAll(shape.location, value, "")
+		}
+	}
+	return shape, body, true
+}
+
+// guessedForm turns the parameters found on endpoint into a GET form,
+// with its own query string kept as hidden inputs, so the found ones are
+// probed like any other
+func guessedForm(endpoint *url.URL, found []string) Form {
+	action := *endpoint
+	action.RawQuery = ""
+	action.Fragment = ""
+	f := Form{URL: action.String(), Method: "GET", Page: endpoint.String()}
+	existing := endpoint.Query()
+	names := make([]string, 0, len(existing))
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f.Inputs = append(f.Inputs, Input{Type: "hidden", Name: name, Value: existing.Get(name)})
+	}
+	for _, name := range found {
+		f.Inputs = append(f.Inputs, Input{Type: "text", Name: name})
+	}
+	return f
+}
+
+// guessable reports whether a crawled response is worth guessing parameters for
+func guessable(status int, contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	return status < 400 && (strings.Contains(contentType, "html") || strings.Contains(contentType, "json"))
+}
@@ -0,0 +1,138 @@
+package reflector
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// limits on what is mined: bodies are read up to maxMinedBody, and a site
+// that makes up names as it goes doesn't grow the wordlist without bound
+const (
+	maxMinedBody  = 2 << 20
+	maxParamNames = 100000
+)
+
+var (
+	// names in query strings anywhere in a page or script, e.g. ?id= and &sort=
+	queryNameRegex = regexp.MustCompile(`[?&](?:amp;)?([A-Za-z0-9_\-.\[\]]+)=`)
+	// names of form fields, e.g. <input type="hidden" name="redirect">
+	fieldNameRegex = regexp.MustCompile(`(?i)<(?:input|select|textarea|button)\b[^>]*?\bname\s*=\s*["']?([^"'\s>]+)`)
+	// JS variable declarations, e.g. var returnUrl = and let debug=
+	jsVariableRegex = regexp.MustCompile(`\b(?:var|let|const)\s+([A-Za-z_$][\w$]*)\s*=`)
+	// what a parameter name may look like, anything else is noise
+	paramNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-.\[\]]{0,39}$`)
+)
+
+// paramMiner collects the parameter names seen anywhere in a crawl's
+// traffic, for Options.MineParams
+type paramMiner struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func newParamMiner() *paramMiner {
+	return &paramMiner{names: make(map[string]bool)}
+}
+
+// add records name unless it doesn't look like a parameter
+func (m *paramMiner) add(name string) {
+	if !paramNameRegex.MatchString(name) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.names) < maxParamNames {
+		m.names[name] = true
+	}
+}
+
+// list returns the names collected so far, sorted
+func (m *paramMiner) list() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.names))
+	for name := range m.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mine records the names in a request's query string and in its response:
+// query strings and form fields in pages, variables and query strings in
+// scripts, and the keys of JSON objects
+func (m *paramMiner) mine(req *http.Request, contentType string, body []byte) {
+	for name := range req.URL.Query() {
+		m.add(name)
+	}
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.Contains(contentType, "json"):
+		var data interface{}
+		if json.Unmarshal(body, &data) == nil {
+			m.jsonKeys(data)
+		}
+	case strings.Contains(contentType, "html"):
+		for _, match := range fieldNameRegex.FindAllSubmatch(body, -1) {
+			m.add(string(match[1]))
+		}
+		fallthrough
+	case strings.Contains(contentType, "javascript"), strings.Contains(contentType, "ecmascript"):
+		for _, match := range queryNameRegex.FindAllSubmatch(body, -1) {
+			m.add(string(match[1]))
+		}
+		for _, match := range jsVariableRegex.FindAllSubmatch(body, -1) {
+			m.add(string(match[1]))
+		}
+	}
+}
+
+// jsonKeys records the keys of every object in a decoded JSON document
+func (m *paramMiner) jsonKeys(data interface{}) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			m.add(key)
+			m.jsonKeys(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			m.jsonKeys(value)
+		}
+	}
+}
+
+// wrap returns a transport that mines every request and response that
+// passes through it, so pages, scripts and build files all count
+func (m *paramMiner) wrap(base http.RoundTripper) http.RoundTripper {
+	return &minerTransport{base: base, miner: m}
+}
+
+type minerTransport struct {
+	base  http.RoundTripper
+	miner *paramMiner
+}
+
+func (t *minerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(body) > maxMinedBody {
+		body = body[:maxMinedBody]
+	}
+	t.miner.mine(req, resp.Header.Get("Content-Type"), body)
+	return resp, nil
+}
@@ -0,0 +1,172 @@
+package reflector
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// payload is a second-stage probe for a reflection context, a breakout with
+// a canary in place of %s that only proves the breakout works: the canary
+// is never a call, so nothing runs even where it lands as code
+type payload struct {
+	name     string
+	template string
+}
+
+// payloadLibrary holds the payloads worth trying per reflection context,
+// see reflectionContexts for the contexts
+var payloadLibrary = map[string][]payload{
+	"html": {
+		{name: "tag-injection", template: "<%s>"},
+		{name: "event-handler", template: "<img src=x onerror=%s>"},
+	},
+	"comment": {
+		{name: "comment-breakout", template: "--><%s>"},
+	},
+	"tag": {
+		{name: "event-handler", template: " autofocus onfocus=%s "},
+	},
+	"attribute-double": {
+		{name: "attribute-breakout", template: `"><%s>`},
+		{name: "event-handler", template: `" autofocus onfocus=%s x="`},
+	},
+	"attribute-single": {
+		{name: "attribute-breakout", template: `'><%s>`},
+		{name: "event-handler", template: `' autofocus onfocus=%s x='`},
+	},
+	"attribute-unquoted": {
+		{name: "attribute-breakout", template: "><%s>"},
+		{name: "event-handler", template: "x autofocus onfocus=%s"},
+	},
+	"url-double": {
+		{name: "javascript-url", template: "javascript:%s"},
+		{name: "attribute-breakout", template: `"><%s>`},
+	},
+	"url-single": {
+		{name: "javascript-url", template: "javascript:%s"},
+		{name: "attribute-breakout", template: `'><%s>`},
+	},
+	"url-unquoted": {
+		{name: "javascript-url", template: "javascript:%s"},
+		{name: "attribute-breakout", template: "><%s>"},
+	},
+	"script": {
+		{name: "script-statement", template: ";%s;//"},
+		{name: "script-breakout", template: "</script><%s>"},
+	},
+	"script-string-double": {
+		{name: "string-breakout", template: `";%s;//`},
+		{name: "script-breakout", template: "</script><%s>"},
+	},
+	"script-string-single": {
+		{name: "string-breakout", template: `';%s;//`},
+		{name: "script-breakout", template: "</script><%s>"},
+	},
+	"script-string-template": {
+		{name: "template-expression", template: "${%s}"},
+		{name: "script-breakout", template: "</script><%s>"},
+	},
+	"script-comment": {
+		{name: "script-breakout", template: "</script><%s>"},
+	},
+}
+
+// needs returns whether every special character p uses survived
+func (p payload) needs(surviving string) bool {
+	for _, c := range unencodedChars([]byte(p.template)) {
+		if !strings.ContainsRune(surviving, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// payloadsFor picks the payloads for the contexts a param reflected in whose
+// special characters all came back unencoded, each payload once
+func payloadsFor(contexts []string, surviving string) []payload {
+	seen := make(map[string]bool)
+	var picked []payload
+	for _, context := range contexts {
+		for _, p := range payloadLibrary[context] {
+			if p.needs(surviving) && !seen[p.template] {
+				seen[p.template] = true
+				picked = append(picked, p)
+			}
+		}
+	}
+	return picked
+}
+
+// pickPayloads returns the payloads for each of params and the number of
+// rounds it takes to send them all
+func pickPayloads(params []string, contexts map[string][]string, chars map[string]string) (map[string][]payload, int) {
+	picked := make(map[string][]payload)
+	rounds := 0
+	for _, param := range params {
+		surviving, ok := chars[param]
+		if !ok {
+			continue
+		}
+		picked[param] = payloadsFor(contexts[param], surviving)
+		if len(picked[param]) > rounds {
+			rounds = len(picked[param])
+		}
+	}
+	return picked, rounds
+}
+
+// workingPayloads sends the payloads picked for each of params, one round
+// per payload with every param that still has one in the same request, and
+// returns per param the names of those that came back intact
+func workingPayloads(p *prober, f Form, inj injection, params []string, contexts map[string][]string, chars map[string]string) map[string][]string {
+	picked, rounds := pickPayloads(params, contexts, chars)
+	working := make(map[string][]string)
+	for round := 0; round < rounds; round++ {
+		probe := injection{
+			FormLocation: inj.FormLocation,
+			Params:       inj.Params,
+			Hashes:       make([]string, len(inj.Hashes)),
+		}
+		sent := make(map[string]string)
+		for i, name := range inj.Params {
+			if inj.Hashes[i] == "" || round >= len(picked[name]) {
+				continue
+			}
+			probe.Hashes[i] = fmt.Sprintf(picked[name][round].template, newCanary(name))
+			sent[name] = probe.Hashes[i]
+		}
+		if len(sent) == 0 {
+			continue
+		}
+
+		_, body, err := p.submit(f, probe)
+		if err != nil {
+			continue
+		}
+		for name, value := range sent {
+			if bytes.Contains(body, []byte(value)) {
+				working[name] = append(working[name], picked[name][round].name)
+			}
+		}
+	}
+	for name := range working {
+		sort.Strings(working[name])
+	}
+	return working
+}
+
+// payloadsField formats working payloads for output, e.g. "payloads=q:attribute-breakout|event-handler"
+func payloadsField(params []string, working map[string][]string) string {
+	var fields []string
+	for _, param := range params {
+		if len(working[param]) > 0 {
+			fields = append(fields, param+":"+strings.Join(working[param], "|"))
+		}
+	}
+	if len(fields) == 0 {
+		return ""
+	}
+	return "payloads=" + strings.Join(fields, ",")
+}
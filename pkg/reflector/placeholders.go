@@ -0,0 +1,179 @@
+package reflector
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// matches {{env:NAME}} and {{cmd:command}} placeholders
+	placeholderRegex = regexp.MustCompile(`\{\{(env|cmd):([^}]+)\}\}`)
+	// matches the placeholders filled in anew for every request
+	requestPlaceholderRegex = regexp.MustCompile(`\{\{(uuid|timestamp|random)\}\}`)
+)
+
+// resolvePlaceholders replaces {{env:NAME}} with the environment variable and
+// {{cmd:command}} with the trimmed output of running command through sh
+func resolvePlaceholders(s string) (string, error) {
+	var firstErr error
+	resolved := placeholderRegex.ReplaceAllStringFunc(s, func(match string) string {
+		parts := placeholderRegex.FindStringSubmatch(match)
+		kind, arg := parts[1], strings.TrimSpace(parts[2])
+		switch kind {
+		case "env":
+			value, ok := os.LookupEnv(arg)
+			if !ok && firstErr == nil {
+				firstErr = fmt.Errorf("environment variable %s is not set", arg)
+			}
+			return value
+		default:
+			out, err := exec.Command("sh", "-c", arg).Output()
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("running %q: %w", arg, err)
+			}
+			return strings.TrimSpace(string(out))
+		}
+	})
+	return resolved, firstErr
+}
+
+// fillRequestPlaceholders replaces {{uuid}} with a random version 4 UUID,
+// {{timestamp}} with the Unix time in milliseconds and {{random}} with 8
+// random hex digits, each time it is called
+func fillRequestPlaceholders(s string) string {
+	return requestPlaceholderRegex.ReplaceAllStringFunc(s, func(match string) string {
+		switch match {
+		case "{{timestamp}}":
+			return strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		case "{{random}}":
+			b := make([]byte, 4)
+			rand.Read(b)
+			return fmt.Sprintf("%x", b)
+		}
+		b := make([]byte, 16)
+		rand.Read(b)
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	})
+}
+
+// headerSet is the custom headers sent with every request
+type headerSet struct {
+	values map[string]string
+	// header values that had placeholders, kept so they can be resolved again
+	templates map[string]string
+	// resolve header placeholders for every request instead of once at startup
+	eachRequest bool
+	// headers with {{uuid}}, {{timestamp}} or {{random}}, filled in for every request
+	perRequest bool
+	// user agents to rotate through, one request each, unless a custom
+	// User-Agent header is set
+	agents []string
+	next   uint64
+}
+
+// newHeaderSet resolves placeholders in the custom headers, remembering
+// the templates when they are to be resolved for every request
+func newHeaderSet(headers map[string]string, eachRequest bool, agents []string) (*headerSet, error) {
+	h := &headerSet{
+		values:      make(map[string]string, len(headers)),
+		templates:   make(map[string]string),
+		eachRequest: eachRequest,
+	}
+	if _, ok := headers["User-Agent"]; !ok {
+		h.agents = agents
+	}
+	for header, value := range headers {
+		h.values[header] = value
+		if requestPlaceholderRegex.MatchString(value) {
+			h.perRequest = true
+		}
+		if !placeholderRegex.MatchString(value) {
+			continue
+		}
+		h.templates[header] = value
+		resolved, err := resolvePlaceholders(value)
+		if err != nil {
+			return nil, fmt.Errorf("header %s: %w", header, err)
+		}
+		h.values[header] = resolved
+	}
+	return h, nil
+}
+
+// filled returns the custom headers as they go out with a request,
+// resolving templated ones again if asked to and filling in per-request
+// placeholders, so no {{uuid}}, {{timestamp}} or {{random}} ever leaves
+func (h *headerSet) filled() map[string]string {
+	resolve := h.eachRequest && len(h.templates) > 0
+	if !resolve && !h.perRequest {
+		return h.values
+	}
+	filled := make(map[string]string, len(h.values))
+	for header, value := range h.values {
+		filled[header] = value
+	}
+	if resolve {
+		for header, template := range h.templates {
+			if resolved, err := resolvePlaceholders(template); err == nil {
+				filled[header] = resolved
+			}
+		}
+	}
+	if h.perRequest {
+		for header, value := range filled {
+			filled[header] = fillRequestPlaceholders(value)
+		}
+	}
+	return filled
+}
+
+// current returns the custom headers to send with a request, filled, with
+// the next user agent
+func (h *headerSet) current() map[string]string {
+	filled := h.filled()
+	if len(h.agents) == 0 {
+		return filled
+	}
+	current := make(map[string]string, len(filled)+1)
+	for header, value := range filled {
+		current[header] = value
+	}
+	i := atomic.AddUint64(&h.next, 1) - 1
+	current["User-Agent"] = h.agents[i%uint64(len(h.agents))]
+	return current
+}
+
+// loadUserAgents reads user agents one per line, skipping blank lines and
+// # comments
+func loadUserAgents(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var agents []string
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			agents = append(agents, line)
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if len(agents) == 0 {
+		return nil, fmt.Errorf("no user agents in %s", path)
+	}
+	return agents, nil
+}
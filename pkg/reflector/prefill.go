@@ -0,0 +1,88 @@
+package reflector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// prefill holds the values a user supplied for fields that have to pass
+// validation, e.g. a real looking email or zip code, so the form goes
+// through to the page that reflects the other fields
+type prefill struct {
+	rules []prefillRule
+}
+
+type prefillRule struct {
+	pattern *regexp.Regexp
+	value   string
+}
+
+// loadPrefill reads a YAML mapping of field name patterns to values:
+//
+//	username: tester@example.com
+//	"zip|postal": "90210"
+//
+// Patterns are case-insensitive regular expressions matched against field
+// names, the first one in the file that matches wins
+func loadPrefill(path string) (*prefill, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	p := &prefill{}
+	if len(doc.Content) == 0 {
+		return p, nil
+	}
+	// a mapping node keeps the file's order, a Go map wouldn't
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, errors.New("expected a mapping of field name patterns to values")
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: value of %q is not a single value", value.Line, key.Value)
+		}
+		pattern, err := regexp.Compile("(?i)" + key.Value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", key.Line, err)
+		}
+		p.rules = append(p.rules, prefillRule{pattern: pattern, value: value.Value})
+	}
+	return p, nil
+}
+
+// value returns the prefilled value for a field name
+func (p *prefill) value(name string) (string, bool) {
+	for _, rule := range p.rules {
+		if rule.pattern.MatchString(name) {
+			return rule.value, true
+		}
+	}
+	return "", false
+}
+
+// apply fills in the prefilled fields of f, which then get their value
+// instead of a hash in inj. Hidden fields and the submitter are left alone
+func (p *prefill) apply(f Form, inj injection) (Form, injection) {
+	f.Inputs = append([]Input(nil), f.Inputs...)
+	inj.Hashes = append([]string(nil), inj.Hashes...)
+	for i, in := range f.Inputs {
+		if in.Type == "hidden" || in.Type == "submit" {
+			continue
+		}
+		if value, ok := p.value(in.Name); ok {
+			f.Inputs[i].Value = value
+			inj.Hashes[i] = ""
+		}
+	}
+	return f, inj
+}
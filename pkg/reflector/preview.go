@@ -0,0 +1,139 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// preview collects what a full scan of a target would cover from the first
+// Options.Preview pages of it, which are crawled without sending any probes
+type preview struct {
+	target string
+	probes probeSet
+	query  bool
+	batch  int
+
+	mu    sync.Mutex
+	pages int
+	// parameter names per endpoint, by scheme, host and path
+	endpoints map[string]map[string]bool
+	forms     map[string]Form
+}
+
+func newPreview(target string, probes probeSet, query bool, batch int) *preview {
+	return &preview{
+		target:    target,
+		probes:    probes,
+		query:     query,
+		batch:     batch,
+		endpoints: make(map[string]map[string]bool),
+		forms:     make(map[string]Form),
+	}
+}
+
+// page counts a crawled page, as a full scan would send it the per-page probes
+func (p *preview) page() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pages++
+}
+
+// link records an endpoint the crawl found, crawled yet or not, and its query parameters
+func (p *preview) link(link string) {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := pageKey(link)
+	params, ok := p.endpoints[key]
+	if !ok {
+		params = make(map[string]bool)
+		p.endpoints[key] = params
+	}
+	for name := range u.Query() {
+		params[name] = true
+	}
+}
+
+// form records a form a full scan would submit
+func (p *preview) form(f Form) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.forms[formKey(f)] = f
+}
+
+// probeCount estimates the probes a full scan would send for what was found
+func (p *preview) probeCount() int {
+	n := 0
+	for _, f := range p.forms {
+		if p.probes.form(f) {
+			n += len(splitInjection(newInjection(f), p.batch))
+		}
+	}
+	if p.query && p.probes[probeQuery] {
+		for _, params := range p.endpoints {
+			n += len(params)
+		}
+	}
+	for _, family := range []string{probePath, probeFragment} {
+		if p.probes[family] {
+			n += p.pages
+		}
+	}
+	if p.probes[probeHeaders] || p.probes[probeCookies] {
+		n += p.pages
+	}
+	return n
+}
+
+// print writes the preview for the run summary: a line of totals, then
+// each endpoint with its parameters and each form with its fields
+func (p *preview) print(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	params := 0
+	for _, names := range p.endpoints {
+		params += len(names)
+	}
+	fmt.Fprintf(w, "[preview] %s pages=%d endpoints=%d params=%d forms=%d probes=%d\n",
+		p.target, p.pages, len(p.endpoints), params, len(p.forms), p.probeCount())
+
+	var endpoints []string
+	for endpoint := range p.endpoints {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		fmt.Fprintln(w, strings.TrimSpace("[preview]   GET "+endpoint+" "+strings.Join(sortedKeys(p.endpoints[endpoint]), ",")))
+	}
+
+	var keys []string
+	for key := range p.forms {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f := p.forms[key]
+		var names []string
+		for _, in := range f.Inputs {
+			names = append(names, in.Name)
+		}
+		fmt.Fprintln(w, strings.TrimSpace(fmt.Sprintf("[preview]   %s %s (form) %s", f.Method, f.URL, strings.Join(names, ","))))
+	}
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,81 @@
+package reflector
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// UserAgent is the default user agent header, shared by the collector and
+// the probe client, custom headers may replace it
+const UserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:78.0) Gecko/20100101 Firefox/78.0"
+
+// prober sends follow-up probes outside of colly, paced by the probe limiter
+// and the rate limits hosts announce
+type prober struct {
+	client  *http.Client
+	limiter *limiter
+	rates   *hostRates
+	headers *headerSet
+	// response bodies are cut off after this many bytes, 0 for no limit
+	maxBody int64
+}
+
+// newProber returns a prober sending through transport, keeping cookies in
+// jar if it isn't nil and reading at most maxBody bytes of each response
+func newProber(transport http.RoundTripper, jar http.CookieJar, limiter *limiter, rates *hostRates, headers *headerSet, maxBody int64) *prober {
+	return &prober{
+		// the transport times each attempt
+		client:  &http.Client{Transport: transport, Jar: jar},
+		limiter: limiter,
+		rates:   rates,
+		headers: headers,
+		maxBody: maxBody,
+	}
+}
+
+// do sends a probe with the custom headers and extra set and returns the response body
+func (p *prober) do(method, target string, body io.Reader, extra http.Header) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	if method == "POST" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for header, value := range p.headers.current() {
+		if header == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(header, value)
+	}
+	for header, values := range extra {
+		req.Header[header] = values
+	}
+	p.limiter.wait()
+	p.rates.wait(req.URL.Host)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.rates.observe(req.URL.Host, resp.StatusCode, resp.Header)
+	defer resp.Body.Close()
+	var r io.Reader = resp.Body
+	if p.maxBody > 0 {
+		r = io.LimitReader(r, p.maxBody)
+	}
+	respBody, err := ioutil.ReadAll(r)
+	return resp, respBody, err
+}
+
+// submit sends f with inj's hashes, with fresh anti-CSRF tokens if it has any
+func (p *prober) submit(f Form, inj injection) (*http.Response, []byte, error) {
+	f = p.freshTokens(f)
+	if f.Method == "POST" {
+		return p.do("POST", f.URL, bytes.NewReader(generateFormData(f, inj)), f.Headers)
+	}
+	return p.do("GET", string(generateFormData(f, inj)), nil, f.Headers)
+}
@@ -0,0 +1,105 @@
+package reflector
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// probe families, each a part of the request hashes are sent in
+const (
+	probeQuery    = "query"
+	probeBody     = "body"
+	probeHeaders  = "headers"
+	probeCookies  = "cookies"
+	probePath     = "path"
+	probeFragment = "fragment"
+	// the query parameters of WebSocket handshakes
+	probeWebSocket = "websocket"
+)
+
+var probeFamilies = []string{probeQuery, probeBody, probeHeaders, probeCookies, probePath, probeFragment, probeWebSocket}
+
+// probeSet is the probe families a crawl runs
+type probeSet map[string]bool
+
+// newProbeSet reads Options.Probes. Families listed as is are the only ones
+// run, families prefixed with - are taken off the default set, which is
+// query and body, plus headers and cookies with testHeaders and websocket
+// with webSockets
+func newProbeSet(families []string, testHeaders, webSockets bool) (probeSet, error) {
+	set := probeSet{}
+	exact := false
+	for _, family := range families {
+		if !strings.HasPrefix(family, "-") {
+			exact = true
+		}
+	}
+	if !exact {
+		set[probeQuery] = true
+		set[probeBody] = true
+		if testHeaders {
+			set[probeHeaders] = true
+			set[probeCookies] = true
+		}
+		set[probeWebSocket] = webSockets
+	}
+	for _, family := range families {
+		name := strings.TrimPrefix(family, "-")
+		if !containsString(probeFamilies, name) {
+			return nil, fmt.Errorf("unknown probe family %q, expected %s", name, strings.Join(probeFamilies, ", "))
+		}
+		set[name] = family == name
+	}
+	return set, nil
+}
+
+// form reports whether f goes out in a family that is run,
+// GET forms send their hashes in the query and POST forms in the body
+func (s probeSet) form(f Form) bool {
+	switch f.Method {
+	case "GET":
+		return s[probeQuery]
+	case "POST":
+		return s[probeBody]
+	}
+	return false
+}
+
+// pathInjection picks a canary to append to the path of page as a segment of its own
+func pathInjection(page *url.URL) injection {
+	return injection{FormLocation: page.String(), Page: page.String(), Params: []string{"path"}, Hashes: []string{newCanary(probePath)}}
+}
+
+// sendPathProbe requests the page with the hash appended to its path.
+// Missing pages are where paths usually come back, so error responses are
+// checked too
+func sendPathProbe(c *colly.Collector, page *url.URL, inj injection) {
+	probe := *page
+	probe.Fragment = ""
+	probe.Path = strings.TrimSuffix(probe.Path, "/") + "/" + inj.Hashes[0]
+	probe.RawPath = ""
+	ctx := colly.NewContext()
+	ctx.Put("probe", page.String())
+	ctx.Put("injection", inj)
+	ctx.Put("path", probe.String())
+	c.Request("GET", probe.String(), nil, ctx, nil)
+}
+
+// fragmentInjection picks a canary to put in the fragment of page
+func fragmentInjection(page *url.URL) injection {
+	return injection{FormLocation: page.String(), Page: page.String(), Params: []string{"fragment"}, Hashes: []string{newCanary(probeFragment)}}
+}
+
+// sendFragmentProbe requests the page again. The fragment never reaches the
+// server, so the response is swapped for the DOM the browser builds with
+// the hash in it, see the fragment hook in Crawl
+func sendFragmentProbe(c *colly.Collector, page string, inj injection) {
+	ctx := colly.NewContext()
+	ctx.Put("probe", page)
+	ctx.Put("injection", inj)
+	ctx.Put("fragment", inj.Hashes[0])
+	c.Request("GET", page, nil, ctx, nil)
+}
@@ -0,0 +1,167 @@
+package reflector
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// limit on the scripts a service worker imports that are read along with it
+const maxImportedScripts = 5
+
+var (
+	// service worker registrations in inline scripts, e.g. navigator.serviceWorker.register("/sw.js")
+	swRegisterRegex = regexp.MustCompile("serviceWorker\\s*\\.\\s*register\\s*\\(\\s*[\"'`]([^\"'`]+)[\"'`]")
+	// precache entries of Workbox and the like, e.g. {url:"/offline.html",revision:"1"}
+	precacheRegex = regexp.MustCompile(`["']?url["']?\s*:\s*["']([^"']+)["']`)
+	// lists handed to cache.addAll
+	addAllRegex = regexp.MustCompile(`addAll\s*\(\s*\[([^\]]*)\]`)
+	// scripts a service worker imports, e.g. importScripts("precache-manifest.js")
+	importScriptsRegex = regexp.MustCompile(`importScripts\s*\(([^)]*)\)`)
+	// any single or double quoted string
+	stringLiteralRegex = regexp.MustCompile(`["']([^"']+)["']`)
+)
+
+// where service workers usually live, tried for PWAs that register theirs from a bundle
+var commonServiceWorkers = []string{"/sw.js", "/service-worker.js"}
+
+// files precached for offline use that are no page worth crawling
+var staticExtensions = map[string]bool{
+	".js": true, ".mjs": true, ".css": true, ".map": true, ".json": true, ".png": true, ".jpg": true, ".jpeg": true,
+	".gif": true, ".svg": true, ".ico": true, ".webp": true, ".woff": true, ".woff2": true, ".ttf": true, ".eot": true,
+	".mp4": true, ".webm": true, ".mp3": true, ".wasm": true,
+}
+
+// webManifest holds the URLs a web app manifest declares
+type webManifest struct {
+	StartURL  string `json:"start_url"`
+	Scope     string `json:"scope"`
+	Shortcuts []struct {
+		URL string `json:"url"`
+	} `json:"shortcuts"`
+	ShareTarget *struct {
+		Action string `json:"action"`
+		Method string `json:"method"`
+		// the names of the title, text and url params, files is a list and left out
+		Params map[string]interface{} `json:"params"`
+	} `json:"share_target"`
+	ProtocolHandlers []struct {
+		URL string `json:"url"`
+	} `json:"protocol_handlers"`
+	FileHandlers []struct {
+		Action string `json:"action"`
+	} `json:"file_handlers"`
+}
+
+// manifestRoutes fetches a web app manifest and returns the URLs it
+// declares, resolved against it as browsers do. A GET share target comes
+// with its params, e.g. /share?title=1&text=1&url=1, ready to be probed
+func manifestRoutes(p *prober, manifest string) []string {
+	base, err := url.Parse(manifest)
+	if err != nil {
+		return nil
+	}
+	data, ok := fetchBuildFile(p, base, base.Path)
+	if !ok {
+		return nil
+	}
+	var m webManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+
+	var links []string
+	add := func(link string) {
+		link = strings.Replace(strings.TrimSpace(link), "%s", "1", 1)
+		if u, err := base.Parse(link); err == nil && link != "" {
+			links = append(links, u.String())
+		}
+	}
+	add(m.StartURL)
+	add(m.Scope)
+	for _, shortcut := range m.Shortcuts {
+		add(shortcut.URL)
+	}
+	for _, handler := range m.ProtocolHandlers {
+		add(handler.URL)
+	}
+	for _, handler := range m.FileHandlers {
+		add(handler.Action)
+	}
+	if share := m.ShareTarget; share != nil && share.Action != "" {
+		action := share.Action
+		if !strings.EqualFold(share.Method, "POST") {
+			query := url.Values{}
+			for _, param := range share.Params {
+				if name, ok := param.(string); ok && name != "" {
+					query.Set(name, "1")
+				}
+			}
+			if len(query) > 0 {
+				action += "?" + query.Encode()
+			}
+		}
+		add(action)
+	}
+	return links
+}
+
+// serviceWorkerRoutes fetches a service worker and the scripts it imports
+// and returns the pages it precaches and the /api/ paths it mentions,
+// static assets left out
+func serviceWorkerRoutes(p *prober, worker string) []string {
+	base, err := url.Parse(worker)
+	if err != nil {
+		return nil
+	}
+	data, ok := fetchBuildFile(p, base, base.Path)
+	if !ok {
+		return nil
+	}
+	scripts := [][]byte{data}
+	for _, m := range importScriptsRegex.FindAllSubmatch(data, -1) {
+		for _, s := range stringLiteralRegex.FindAllSubmatch(m[1], -1) {
+			if len(scripts) > maxImportedScripts {
+				break
+			}
+			imported, err := base.Parse(string(s[1]))
+			if err != nil || imported.Host != base.Host {
+				continue
+			}
+			if data, ok := fetchBuildFile(p, imported, imported.Path); ok {
+				scripts = append(scripts, data)
+			}
+		}
+	}
+
+	var links []string
+	seen := make(map[string]bool)
+	add := func(link string) {
+		u, err := base.Parse(strings.TrimSpace(link))
+		if err != nil || u.Host != base.Host || staticExtensions[strings.ToLower(path.Ext(u.Path))] {
+			return
+		}
+		u.Fragment = ""
+		if !seen[u.String()] {
+			seen[u.String()] = true
+			links = append(links, u.String())
+		}
+	}
+	for _, script := range scripts {
+		script = unescapeSlashes(script)
+		for _, m := range precacheRegex.FindAllSubmatch(script, -1) {
+			add(string(m[1]))
+		}
+		for _, m := range addAllRegex.FindAllSubmatch(script, -1) {
+			for _, s := range stringLiteralRegex.FindAllSubmatch(m[1], -1) {
+				add(string(s[1]))
+			}
+		}
+		for _, m := range apiLiteralRegex.FindAllSubmatch(script, -1) {
+			add(string(m[1]))
+		}
+	}
+	return links
+}
@@ -0,0 +1,43 @@
+package reflector
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// queryTester turns crawled URLs with query parameters into GET forms,
+// so their parameters are probed like form inputs
+type queryTester struct {
+	seen sync.Map
+}
+
+// form returns the URL's parameters as a GET form, false if it has none
+// or a URL with the same path and parameter names was already tested
+func (q *queryTester) form(u *url.URL) (Form, bool) {
+	values := u.Query()
+	if len(values) == 0 {
+		return Form{}, false
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	action := *u
+	action.RawQuery = ""
+	action.Fragment = ""
+	key := action.String() + "?" + strings.Join(names, "&")
+	if _, seen := q.seen.LoadOrStore(key, true); seen {
+		return Form{}, false
+	}
+
+	// parameters not being probed keep their crawled value
+	f := Form{URL: action.String(), Method: "GET", Page: u.String()}
+	for _, name := range names {
+		f.Inputs = append(f.Inputs, Input{Type: "text", Name: name, Value: values.Get(name)})
+	}
+	return f, true
+}
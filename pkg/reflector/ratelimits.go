@@ -0,0 +1,200 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the longest a host's rate limit headers may pause it for, so a bogus
+// Retry-After can't stall the crawl indefinitely
+const maxRateLimitWait = 10 * time.Minute
+
+// hostRate is the rate limit a host has announced and how requests to it are paced
+type hostRate struct {
+	limit  int
+	policy string
+	// spacing between requests, from the remaining quota and when it resets
+	interval time.Duration
+	next     time.Time
+	// no requests before this, after a Retry-After or an exhausted quota
+	until time.Time
+
+	throttled int
+	waited    time.Duration
+}
+
+// hostRates paces requests per host from RateLimit-*, X-RateLimit-* and
+// Retry-After response headers. Hosts that never send them aren't slowed down
+type hostRates struct {
+	mu    sync.Mutex
+	hosts map[string]*hostRate
+}
+
+func newHostRates() *hostRates {
+	return &hostRates{hosts: make(map[string]*hostRate)}
+}
+
+// wait blocks until the host's rate limit allows another request
+func (r *hostRates) wait(host string) {
+	r.mu.Lock()
+	h, ok := r.hosts[host]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	start := h.next
+	if h.until.After(start) {
+		start = h.until
+	}
+	if start.Before(now) {
+		start = now
+	}
+	h.next = start.Add(h.interval)
+	sleep := start.Sub(now)
+	h.waited += sleep
+	r.mu.Unlock()
+	time.Sleep(sleep)
+
+	// a pause announced while we slept applies to us too
+	r.mu.Lock()
+	paused := h.until.After(time.Now())
+	r.mu.Unlock()
+	if paused {
+		r.wait(host)
+	}
+}
+
+// observe updates a host's pacing from a response's status and headers
+func (r *hostRates) observe(host string, status int, header http.Header) {
+	if header == nil {
+		return
+	}
+	limit, hasLimit := headerInt(header, "RateLimit-Limit", "X-RateLimit-Limit")
+	remaining, hasRemaining := headerInt(header, "RateLimit-Remaining", "X-RateLimit-Remaining")
+	reset, hasReset := rateLimitReset(header)
+	retry, hasRetry := retryAfter(header)
+	policy := header.Get("RateLimit-Policy")
+	throttled := status == http.StatusTooManyRequests
+	if !hasLimit && !hasRemaining && !hasRetry && policy == "" && !throttled {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hosts[host]
+	if !ok {
+		h = &hostRate{}
+		r.hosts[host] = h
+	}
+	if hasLimit {
+		h.limit = limit
+	}
+	if policy != "" {
+		h.policy = policy
+	}
+
+	var pause time.Duration
+	switch {
+	case hasRetry:
+		pause = retry
+	case hasRemaining && remaining == 0 && hasReset:
+		pause = reset
+	case throttled && hasReset:
+		pause = reset
+	case throttled:
+		// told to slow down without being told for how long
+		pause = 5 * time.Second
+	}
+	if throttled {
+		h.throttled++
+	}
+	if pause > maxRateLimitWait {
+		pause = maxRateLimitWait
+	}
+	if until := time.Now().Add(pause); until.After(h.until) {
+		h.until = until
+	}
+
+	// spread what is left of the quota over the rest of the window
+	if hasRemaining && remaining > 0 && hasReset {
+		h.interval = reset / time.Duration(remaining)
+	}
+}
+
+// printStats writes the rate limit each host announced for the run summary
+func (r *hostRates) printStats(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var hosts []string
+	for host := range r.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := r.hosts[host]
+		var fields []string
+		if h.limit > 0 {
+			fields = append(fields, "limit="+strconv.Itoa(h.limit))
+		}
+		if h.policy != "" {
+			fields = append(fields, fmt.Sprintf("policy=%q", h.policy))
+		}
+		fields = append(fields, "throttled="+strconv.Itoa(h.throttled), "waited="+h.waited.Round(time.Millisecond).String())
+		fmt.Fprintf(w, "[rate-limit] %s %s\n", host, strings.Join(fields, " "))
+	}
+}
+
+// headerInt returns the first of the named headers holding a whole number
+func headerInt(header http.Header, names ...string) (int, bool) {
+	for _, name := range names {
+		// the draft standard allows a list, the first item is the one in effect
+		value := strings.TrimSpace(strings.Split(header.Get(name), ",")[0])
+		if n, err := strconv.Atoi(value); err == nil && n >= 0 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// rateLimitReset returns how long until the quota resets. The header is
+// seconds from now in the draft standard but a Unix time on many APIs
+func rateLimitReset(header http.Header) (time.Duration, bool) {
+	reset, ok := headerInt(header, "RateLimit-Reset", "X-RateLimit-Reset")
+	if !ok {
+		return 0, false
+	}
+	if reset > 1000000000 {
+		d := time.Until(time.Unix(int64(reset), 0))
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return time.Duration(reset) * time.Second, true
+}
+
+// retryAfter parses a Retry-After header, either seconds or an HTTP date
+func retryAfter(header http.Header) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
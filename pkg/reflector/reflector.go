@@ -0,0 +1,2138 @@
+// Package reflector crawls web applications, submitting every form it finds
+// with a unique hash per parameter and reporting where those hashes are
+// reflected, along with the URLs, forms and other findings along the way.
+//
+// Results are sent on a channel as they are found:
+//
+//	crawler, err := reflector.New(reflector.Options{Threads: 8, Depth: 2})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	results := make(chan reflector.Result, 8)
+//	go func() {
+//		crawler.Crawl("https://example.com", "", results)
+//		close(results)
+//	}()
+//	for res := range results {
+//		fmt.Println(res.Line(true))
+//	}
+package reflector
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// Options configures a Crawler, the zero value of each field is the
+// command line tool's default behaviour with that feature off
+type Options struct {
+	// threads per host, and the starting point with Adaptive
+	Threads int
+	// scale threads per host from observed latency and errors, up to MaxThreads
+	Adaptive   bool
+	MaxThreads int
+	// depth to crawl
+	Depth int
+	// disable TLS verification
+	Insecure bool
+	// do full TLS handshakes every time instead of resuming sessions
+	NoTLSResume bool
+	// include subdomains of the target in the crawl
+	Subdomains bool
+	// file of include and exclude rules every URL is checked against before
+	// it is visited or reported, see loadScope
+	Scope string
+	// custom headers sent with every request, values may use {{env:NAME}}
+	// and {{cmd:command}} placeholders
+	Headers map[string]string
+	// URL patterns by header name that custom headers are only sent to, as
+	// in a scope file, e.g. Authorization to api.example.com. A Cookie rule
+	// holds back the custom cookies only. Headers without rules go everywhere
+	HeaderScope map[string][]string
+	// resolve header placeholders for every request instead of once in New
+	ResolveEachRequest bool
+	// file of user agents, one per line, to rotate through request by
+	// request unless Headers sets one
+	UserAgents string
+	// proxy URL for all requests, http://, https:// or socks5:// with optional user:password@
+	Proxy string
+	// how long each attempt at a request may take, body included, 0 for 10
+	// seconds, and how many times to retry resets, timeouts, 429s and 50xs
+	Timeout time.Duration
+	Retries int
+	// maximum crawl and probe requests per second, 0 for no limit
+	CrawlRate float64
+	ProbeRate float64
+	// file of identities to rotate probes across, Rotate probes each
+	Identities string
+	Rotate     int
+	// only report URLs with query parameters and forms
+	ParamsOnly bool
+	// annotate results disallowed by robots.txt or marked noindex/nofollow
+	Robots bool
+	// don't request what robots.txt disallows, nor crawl its Disallow entries as hints
+	RespectRobots bool
+	// don't add the paths in robots.txt and URLs in sitemaps to the crawl
+	NoDiscover bool
+	// record HTTP version, server banner and TLS details per target
+	Meta bool
+	// break requests down into DNS, connect, TLS and time to first byte per host in the summary
+	Timings bool
+	// summarize each target's reflections by path in PrintSummary, as a
+	// tree of path prefixes or a table of paths, "" for neither
+	HeatMap string
+	// don't switch http targets to https when https is available
+	NoUpgrade bool
+	// maximum parameters to inject per form probe, 0 for all of them
+	Batch int
+	// YAML file of field name patterns and the values to submit for them, see loadPrefill
+	Prefill string
+	// other scanners' results, nuclei JSON or plain URLs, whose endpoints are
+	// crawled and probed first and annotated, see loadSignals
+	Signals string
+	// crawl order: bfs, dfs or priority, "" for colly's own order
+	Strategy string
+	// maximum time to spend crawling each depth level, 0 for no limit
+	DepthTime time.Duration
+	// maximum time for a whole Run, shared out between its targets, 0 for no limit
+	MaxRuntime time.Duration
+	// targets Run crawls at once, 1 or less crawls them one after another.
+	// Requests in flight per host stay within Threads across all of them
+	TargetConcurrency int
+	// Run sends a Result with Source "end" and the target as its URL once
+	// every other result of a target has been sent, whether or not it could
+	// be crawled
+	TargetEnds bool
+	// maximum pages to crawl per target, probes aside, 0 for no limit
+	MaxURLs int
+	// maximum time to spend on each target, 0 for no limit
+	MaxTime time.Duration
+	// crawled responses bigger than this many bytes aren't downloaded, and
+	// probe responses are cut off there, 0 for no limit
+	MaxBodySize int64
+	// media types, e.g. text/html, or words of their subtypes, e.g. json,
+	// crawled responses of other types aren't downloaded. Empty for all types
+	ContentTypes []string
+	// crawl only the first Preview pages of each target, without sending any
+	// probes, and summarize what a full scan would cover. 0 for a full scan
+	Preview int
+	// verify XSS and DOM sink reflections in headless Chrome
+	VerifyBrowser bool
+	// render crawled pages in headless Chrome before extracting links and forms
+	Render bool
+	// with Render, render the responses of probes whose hashes the server
+	// didn't send back, and report the hashes that show up on screen
+	// differently than filler sent in their place does
+	ScreenshotDiff bool
+	// extra selectors of consent banner and age gate buttons to click in
+	// rendered pages, on top of the built-in ones for common platforms
+	Dismiss []string
+	// path to the Chrome or Chromium binary, searched for in $PATH if empty
+	Browser string
+	// also test the query parameters of every crawled URL
+	Query bool
+	// also request every crawled page with canaries in commonly echoed headers and its cookies
+	TestHeaders bool
+	// scan inline scripts and the crawl's own script files for DOM XSS sinks and sources
+	ScanScripts bool
+	// read HTML comments and meta tags for URLs, internal hosts, emails and credentials
+	Dig bool
+	// read the site's own scripts for WebSocket endpoints too, and send every
+	// endpoint found messages with canaries, on top of the websocket probe family
+	WebSockets bool
+	// HTTP methods to try on every crawled endpoint and form action, OPTIONS
+	// reads the Allow header. Empty to try none
+	Methods []string
+	// request every crawled page again once the probes are done, and report
+	// canaries found there as stored
+	SecondPass bool
+	// send per-page probes to only one page of each template cluster, pages are
+	// always clustered and findings carry the cluster of their page
+	Cluster bool
+	// probe families to run out of query, body, headers, cookies, path and
+	// fragment, or with a - prefix, the ones to drop from the default of query
+	// and body, plus headers and cookies with TestHeaders. nil runs the default
+	Probes []string
+	// rewrites of the second-stage payloads of reflections to send as well,
+	// recording which get through, see LoadMutations
+	Mutations []Mutation
+	// file to checkpoint visited URLs, pending links and probed forms to,
+	// and with Resume, the checkpoint an interrupted crawl continues from
+	State  string
+	Resume bool
+	// where the crawl state is checkpointed to and resumed from when there
+	// is no State file, nil for neither
+	Store Store
+	// page to log in at before crawling, and the query string to submit
+	// in its login form, values may use {{env:NAME}} and {{cmd:command}}
+	// placeholders. The crawl logs in again when the session ends
+	LoginURL  string
+	LoginData string
+	// collect the parameter names seen anywhere in the traffic, see ParamNames
+	MineParams bool
+	// guess the parameters every crawled endpoint takes without linking to
+	// them, from common names and the ones mined so far, and probe the ones found
+	DiscoverParams bool
+	// where errors are logged, discarded if nil
+	Log io.Writer
+}
+
+// Crawler crawls targets with one set of Options. Injections are shared
+// across targets, so a hash submitted on one can be found stored on another
+type Crawler struct {
+	opts     Options
+	proxyURL *url.URL
+	headers  *headerSet
+	// where the custom headers may be sent, nil for everywhere
+	headerScope *headerScope
+	pool        *identityPool
+	chrome      *browser
+	prefill     *prefill
+	signals     *signals
+	session     *session
+	params      *paramMiner
+	probes      probeSet
+	scope       *scope
+	log         io.Writer
+
+	// TLS sessions, kept per host across targets so new connections resume them
+	tlsSessions tls.ClientSessionCache
+
+	// crawling and probing are paced separately, probes are the ones WAFs notice
+	crawlLimiter *limiter
+	probeLimiter *limiter
+	// and both slow down for hosts that announce a rate limit
+	rates *hostRates
+	// requests retried and given up on per host
+	retries *retryStats
+	// and with Timings, where the time of each request went
+	timings *requestTimings
+
+	// with Adaptive, Threads is only the starting point
+	parallelism int
+	hosts       *adaptiveHosts
+	// with TargetConcurrency, the requests in flight per host across targets
+	slots *hostSlots
+
+	// record all the form inputs performed se we know where each found hash comes from
+	injectionMu sync.Mutex
+	injections  []injection
+	// the parameter and request behind every canary sent
+	canaries *canaryRegistry
+	// pairs of injection and page already reported as cross-page
+	crossPages sync.Map
+
+	// progress of every target, when checkpointing to Options.State
+	state *crawlState
+
+	// per-target statistics and metadata for the summary
+	mu       sync.Mutex
+	stats    []*targetStats
+	metas    []targetMeta
+	previews []*preview
+}
+
+// TLS sessions kept for resumption, one per host and more than most runs reach
+const tlsSessionCacheSize = 4096
+
+// proxy URL schemes net/http can send requests through
+var proxySchemes = map[string]bool{"http": true, "https": true, "socks5": true}
+
+// New checks the options and sets up what every crawl shares:
+// resolved headers, the identity pool, the browser and rate limits
+func New(opts Options) (*Crawler, error) {
+	if opts.Threads < 1 {
+		opts.Threads = 1
+	}
+	if opts.Log == nil {
+		opts.Log = ioutil.Discard
+	}
+	if err := validStrategy(opts.Strategy); err != nil {
+		return nil, err
+	}
+	if err := validHeatMap(opts.HeatMap); err != nil {
+		return nil, err
+	}
+	cr := &Crawler{
+		opts:         opts,
+		log:          opts.Log,
+		crawlLimiter: newLimiter(opts.CrawlRate),
+		probeLimiter: newLimiter(opts.ProbeRate),
+		rates:        newHostRates(),
+		retries:      newRetryStats(),
+		canaries:     newCanaryRegistry(),
+		parallelism:  opts.Threads,
+	}
+	if opts.Timings {
+		cr.timings = newRequestTimings()
+	}
+	if !opts.NoTLSResume {
+		cr.tlsSessions = tls.NewLRUClientSessionCache(tlsSessionCacheSize)
+	}
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		if !proxySchemes[proxyURL.Scheme] || proxyURL.Host == "" {
+			return nil, fmt.Errorf("proxy: %q is not an http://, https:// or socks5:// URL", opts.Proxy)
+		}
+		cr.proxyURL = proxyURL
+	}
+
+	var agents []string
+	if opts.UserAgents != "" {
+		var err error
+		agents, err = loadUserAgents(opts.UserAgents)
+		if err != nil {
+			return nil, fmt.Errorf("user agents: %w", err)
+		}
+	}
+	headers, err := newHeaderSet(opts.Headers, opts.ResolveEachRequest, agents)
+	if err != nil {
+		return nil, err
+	}
+	cr.headers = headers
+	cr.headerScope, err = newHeaderScope(opts.HeaderScope, opts.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	// load the identity pool for probes
+	if opts.Identities != "" {
+		cr.pool, err = loadIdentities(opts.Identities, opts.Rotate)
+		if err != nil {
+			return nil, fmt.Errorf("identities: %w", err)
+		}
+	}
+
+	if opts.Prefill != "" {
+		cr.prefill, err = loadPrefill(opts.Prefill)
+		if err != nil {
+			return nil, fmt.Errorf("prefill: %w", err)
+		}
+	}
+
+	if opts.Signals != "" {
+		cr.signals, err = loadSignals(opts.Signals)
+		if err != nil {
+			return nil, fmt.Errorf("signals: %w", err)
+		}
+	}
+
+	if opts.Scope != "" {
+		cr.scope, err = loadScope(opts.Scope)
+		if err != nil {
+			return nil, fmt.Errorf("scope: %w", err)
+		}
+	}
+
+	if opts.LoginURL != "" || opts.LoginData != "" {
+		if opts.LoginURL == "" || opts.LoginData == "" {
+			return nil, errors.New("logging in needs both a login URL and login data")
+		}
+		cr.session, err = newSession(opts.LoginURL, opts.LoginData)
+		if err != nil {
+			return nil, fmt.Errorf("login: %w", err)
+		}
+	}
+
+	// guessing draws on the mined names
+	if opts.MineParams || opts.DiscoverParams {
+		cr.params = newParamMiner()
+	}
+
+	cr.probes, err = newProbeSet(opts.Probes, opts.TestHeaders, opts.WebSockets)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ScreenshotDiff && !opts.Render {
+		return nil, errors.New("screenshot diffing needs rendering")
+	}
+	// fragments only ever reach scripts running in a browser
+	if opts.VerifyBrowser || opts.Render || cr.probes[probeFragment] {
+		cr.chrome, err = newBrowser(opts.Browser)
+		if err != nil {
+			return nil, err
+		}
+		if cr.proxyURL != nil {
+			// Chrome can't take proxy credentials on the command line
+			cr.chrome.proxy = cr.proxyURL.Scheme + "://" + cr.proxyURL.Host
+		}
+		cr.chrome.dismiss = append(append([]string{}, consentSelectors...), opts.Dismiss...)
+	}
+
+	if opts.Resume && opts.State == "" && opts.Store == nil {
+		return nil, errors.New("resuming needs a state file or a store")
+	}
+	if opts.Resume {
+		if opts.State != "" {
+			cr.state, cr.injections, err = loadState(opts.State)
+		} else {
+			cr.state, cr.injections, err = loadStoreState(opts.Store)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("state: %w", err)
+		}
+		// already sent, so a collision among them can't be undone
+		for _, inj := range cr.injections {
+			cr.canaries.add(inj)
+		}
+	} else if opts.State != "" {
+		cr.state = &crawlState{path: opts.State, targets: make(map[string]*targetProgress)}
+	} else if opts.Store != nil {
+		cr.state = &crawlState{store: opts.Store, targets: make(map[string]*targetProgress)}
+	}
+
+	if opts.Adaptive {
+		cr.hosts = newAdaptiveHosts(opts.Threads, opts.MaxThreads)
+		if opts.MaxThreads > cr.parallelism {
+			cr.parallelism = opts.MaxThreads
+		}
+	} else if opts.TargetConcurrency > 1 {
+		// adaptive windows are per host already
+		cr.slots = newHostSlots(opts.Threads)
+	}
+	return cr, nil
+}
+
+// Headers returns the custom headers as resolved in New, per-request
+// placeholders filled in
+func (cr *Crawler) Headers() map[string]string {
+	return cr.headers.filled()
+}
+
+// Signals returns the labels other scanners flagged link's endpoint with,
+// comma separated, "" for endpoints Options.Signals doesn't list
+func (cr *Crawler) Signals(link string) string {
+	return strings.Join(cr.signals.labels(link), ",")
+}
+
+// HeadersFor returns the custom headers Options.HeaderScope lets through to
+// link, as a request to it would send them
+func (cr *Crawler) HeadersFor(link string) map[string]string {
+	return cr.headerScope.filter(cr.headers.current(), link)
+}
+
+// IdentityCookies returns the cookies of the identities probes rotate across
+func (cr *Crawler) IdentityCookies() []string {
+	if cr.pool == nil {
+		return nil
+	}
+	var cookies []string
+	for _, id := range cr.pool.identities {
+		cookies = append(cookies, id.Cookie)
+	}
+	return cookies
+}
+
+// LoginSecrets returns the passwords and tokens in the login data
+func (cr *Crawler) LoginSecrets() []string {
+	if cr.session == nil {
+		return nil
+	}
+	return cr.session.secrets()
+}
+
+// ParamNames returns the parameter names seen in query strings, form
+// fields, JS variables and JSON keys so far, sorted. Nil without MineParams
+func (cr *Crawler) ParamNames() []string {
+	if cr.params == nil {
+		return nil
+	}
+	return cr.params.list()
+}
+
+// SetLog changes where errors are logged, for callers that can only set it
+// up once the crawler exists. It must be called before crawling starts
+func (cr *Crawler) SetLog(w io.Writer) {
+	cr.log = w
+}
+
+// Targets returns the targets crawled so far, after any https upgrade
+func (cr *Crawler) Targets() []string {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	var targets []string
+	for _, stat := range cr.stats {
+		targets = append(targets, stat.Target)
+	}
+	return targets
+}
+
+// Run crawls each line from targets as it arrives, a target URL optionally
+// followed by key=value tags, and closes results once targets is closed
+// and every crawl is done. Lines that can't be crawled are logged and skipped.
+// With TargetConcurrency, that many targets are crawled at once, each
+// worker taking the next line as soon as its crawl is done. With
+// MaxRuntime, targets is read to the end first so the time can be shared
+// out, see runFair
+func (cr *Crawler) Run(targets <-chan string, results chan<- Result) {
+	defer close(results)
+	defer cr.Close()
+	if cr.opts.MaxRuntime > 0 {
+		cr.runFair(targets, results)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < cr.targetWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for line := range targets {
+				target, tags := ParseTarget(line)
+				if target == "" {
+					continue
+				}
+				// one bad line shouldn't end a long running pipeline
+				if err := cr.Crawl(target, tags, results); err != nil {
+					fmt.Fprintln(cr.log, "Error parsing URL:", err)
+				}
+				cr.end(target, results)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// targetWorkers returns how many targets Run crawls at once
+func (cr *Crawler) targetWorkers() int {
+	if cr.opts.TargetConcurrency < 1 {
+		return 1
+	}
+	return cr.opts.TargetConcurrency
+}
+
+// runFair crawls every target within MaxRuntime, each one getting an equal
+// share of the time left when it starts, so targets that finish early leave
+// more for the rest and none can use up the time of those after it. With
+// several workers, each share is as long as the workers that can run
+// alongside it
+func (cr *Crawler) runFair(targets <-chan string, results chan<- Result) {
+	var lines []string
+	for line := range targets {
+		if target, _ := ParseTarget(line); target != "" {
+			lines = append(lines, line)
+		}
+	}
+	end := time.Now().Add(cr.opts.MaxRuntime)
+	next := make(chan int)
+	go func() {
+		for i := range lines {
+			next <- i
+		}
+		close(next)
+	}()
+	var wg sync.WaitGroup
+	for w := 0; w < cr.targetWorkers(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				target, tags := ParseTarget(lines[i])
+				left := time.Until(end)
+				if left <= 0 {
+					fmt.Fprintln(cr.log, "Skipping", target, "with no time left of", cr.opts.MaxRuntime)
+					cr.end(target, results)
+					continue
+				}
+				waiting := len(lines) - i
+				running := cr.targetWorkers()
+				if running > waiting {
+					running = waiting
+				}
+				deadline := time.Now().Add(left * time.Duration(running) / time.Duration(waiting))
+				if err := cr.crawl(target, tags, results, deadline); err != nil {
+					fmt.Fprintln(cr.log, "Error parsing URL:", err)
+				}
+				cr.end(target, results)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// end tells the reader of results that target is done, with TargetEnds
+func (cr *Crawler) end(target string, results chan<- Result) {
+	if cr.opts.TargetEnds {
+		results <- Result{Source: "end", URL: target}
+	}
+}
+
+// Close stops the headless browser crawls may have started, which Run does
+// once every target is done. A later crawl starts it again
+func (cr *Crawler) Close() {
+	if cr.chrome != nil {
+		cr.chrome.close()
+	}
+}
+
+// Crawl crawls one target, sending results as they are found, and returns
+// once the crawl is done. tags are appended to every result from it
+func (cr *Crawler) Crawl(target string, tags string, results chan<- Result) error {
+	return cr.crawl(target, tags, results, time.Time{})
+}
+
+// crawl is Crawl, stopping at deadline unless it is zero: no more pages
+// are queued and no more probes sent, and requests in flight finish
+func (cr *Crawler) crawl(target string, tags string, results chan<- Result, deadline time.Time) error {
+	// Skip TLS verification if -insecure flag is present
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: cr.opts.Insecure, ClientSessionCache: cr.tlsSessions},
+	}
+	if cr.proxyURL != nil {
+		transport.Proxy = http.ProxyURL(cr.proxyURL)
+	}
+
+	// with a deadline, links stop being queued and requests stop being sent once it passes
+	if cr.opts.MaxTime > 0 {
+		if own := time.Now().Add(cr.opts.MaxTime); deadline.IsZero() || own.Before(deadline) {
+			deadline = own
+		}
+	}
+	budget := newDepthBudget(cr.opts.DepthTime)
+	budget.deadline = deadline
+	budget.maxPages = cr.opts.MaxURLs
+
+	// every request goes out through the retries, whichever client sends it
+	retrying := func(base http.RoundTripper) http.RoundTripper {
+		timeout := cr.opts.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+		// every attempt is timed on its own
+		if cr.timings != nil {
+			base = cr.timings.wrap(base)
+		}
+		// scoped headers are held back at the last moment, redirects included
+		if cr.headerScope != nil {
+			base = cr.headerScope.wrap(base)
+		}
+		// waiting for a slot isn't part of an attempt's time
+		if cr.slots != nil {
+			base = cr.slots.wrap(base)
+		}
+		return &retryTransport{base: base, timeout: timeout, retries: cr.opts.Retries, rates: cr.rates, stats: cr.retries, budget: budget}
+	}
+
+	// the collector and every probe client share cookies, so follow-up
+	// probes carry the session anti-CSRF tokens are bound to
+	var jar http.CookieJar
+	// with -login-url, that's the login session's, and every client logs
+	// in again when it ends, the login itself going out unwrapped
+	authed := retrying
+	var login *prober
+	if cr.session == nil {
+		jar, _ = cookiejar.New(nil)
+	} else {
+		jar = cr.session.jar
+		login = newProber(retrying(transport), jar, cr.crawlLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize)
+		authed = func(base http.RoundTripper) http.RoundTripper {
+			return cr.session.wrap(retrying(base), login, cr.log)
+		}
+	}
+
+	pr := newProber(authed(transport), jar, cr.probeLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize)
+
+	// with MineParams, the crawl's own traffic goes past the miner, probes
+	// would only add the names they inject
+	mined := func(base http.RoundTripper) http.RoundTripper {
+		if cr.params == nil {
+			return base
+		}
+		return cr.params.wrap(base)
+	}
+
+	// progress is kept under the target as given, before any upgrade
+	var progress *targetProgress
+	if cr.state != nil {
+		progress = cr.state.target(target)
+		if cr.state.finished(progress) {
+			fmt.Fprintln(cr.log, "Skipping", target, "already crawled in", cr.opts.State)
+			return nil
+		}
+	}
+
+	// prefer https when an http target also serves it
+	if !cr.opts.NoUpgrade {
+		target = upgradeTarget(transport, target)
+	}
+	if !cr.scope.allows(target) {
+		fmt.Fprintln(cr.log, "Skipping", target, "out of scope in", cr.opts.Scope)
+		return nil
+	}
+
+	hostname, err := extractHostname(target)
+	if err != nil {
+		return err
+	}
+
+	// crawling logged out would only find the login page
+	if cr.session != nil {
+		if err := cr.session.start(login); err != nil {
+			fmt.Fprintln(cr.log, "Skipping", target, "after failing to log in:", err)
+			return nil
+		}
+	}
+
+	stat := newTargetStats(target)
+	cr.mu.Lock()
+	cr.stats = append(cr.stats, stat)
+	cr.mu.Unlock()
+
+	// session cookies from -h never come back in Set-Cookie, see csrfCandidate
+	_, sessionCookie := cr.headers.values["Cookie"]
+
+	allowed_domains := []string{hostname}
+	// if "Host" header is set, append it to allowed domains
+	if cr.headers.values != nil {
+		if val, ok := cr.headers.values["Host"]; ok {
+			allowed_domains = append(allowed_domains, val)
+		}
+	}
+
+	// Instantiate default collector
+	c := colly.NewCollector(
+		// default user agent header
+		colly.UserAgent(UserAgent),
+		// set custom headers, filled in again for every request below
+		colly.Headers(cr.headers.filled()),
+		// limit crawling to the domain of the specified URL
+		colly.AllowedDomains(allowed_domains...),
+		// allow revisiting to find stored hashes
+		colly.AllowURLRevisit(),
+		// set MaxDepth to the specified depth
+		colly.MaxDepth(cr.opts.Depth),
+		// specify Async for threading
+		colly.Async(true),
+	)
+
+	// if -subs is present, use regex to filter out subdomains in scope.
+	if cr.opts.Subdomains {
+		c.AllowedDomains = nil
+		c.URLFilters = []*regexp.Regexp{regexp.MustCompile(".*(\\.|\\/\\/)" + strings.ReplaceAll(hostname, ".", "\\.") + "((#|\\/|\\?).*)?")}
+	}
+	// a scope file's includes replace both
+	cr.scope.apply(c)
+
+	// colly checks robots.txt itself before every request
+	c.IgnoreRobotsTxt = !cr.opts.RespectRobots
+
+	// with -preview, nothing is probed and no more pages are taken from the
+	// budget than the preview covers, what a full scan would cover is
+	// collected instead
+	probes := cr.probes
+	var pv *preview
+	if cr.opts.Preview > 0 {
+		pv = newPreview(target, cr.probes, cr.opts.Query, cr.opts.Batch)
+		cr.mu.Lock()
+		cr.previews = append(cr.previews, pv)
+		cr.mu.Unlock()
+		probes = probeSet{}
+		if budget.maxPages <= 0 || cr.opts.Preview < budget.maxPages {
+			budget.maxPages = cr.opts.Preview
+		}
+	}
+
+	// Set parallelism
+	c.Limit(&colly.LimitRule{DomainGlob: "*", Parallelism: cr.parallelism})
+
+	// first, so nothing else is started or timed while output is backed up
+	c.OnRequest(func(r *colly.Request) {
+		waitForOutput(results)
+	})
+
+	// requests are timed from after the pacing below up to the response,
+	// time spent blocked on a slow consumer says nothing about the host
+	if cr.hosts != nil {
+		c.OnResponse(func(r *colly.Response) {
+			cr.hosts.end(requestKey{c.ID, r.Request.ID}, r.StatusCode, nil)
+		})
+		c.OnError(func(r *colly.Response, err error) {
+			// a response dropped by -max-body-size or -content-types came back fine
+			if errors.Is(err, colly.ErrAbortedAfterHeaders) {
+				err = nil
+			}
+			cr.hosts.end(requestKey{c.ID, r.Request.ID}, r.StatusCode, err)
+		})
+	}
+
+	// the browser loads pages with the headers and cookies the crawl sent,
+	// so an authenticated crawl isn't rendered logged out
+	session := func(r *colly.Request) browserSession {
+		return browserSession{headers: r.Headers.Clone(), cookies: jar.Cookies(r.URL)}
+	}
+
+	// with -render, pages are extracted from the DOM the browser built
+	// instead of the HTML the server sent
+	if cr.opts.Render {
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+				return
+			}
+			dom, err := cr.chrome.renderDOM(r.Request.URL.String(), session(r.Request))
+			if err != nil {
+				fmt.Fprintln(cr.log, "Error rendering", r.Request.URL, err)
+				return
+			}
+			r.Body = dom
+		})
+	}
+
+	// fragment probes are checked against the DOM built with the hash in the fragment
+	if probes[probeFragment] {
+		c.OnResponse(func(r *colly.Response) {
+			hash := r.Ctx.Get("fragment")
+			if hash == "" {
+				return
+			}
+			dom, err := cr.chrome.renderDOM(r.Request.URL.String()+"#"+hash, session(r.Request))
+			if err != nil {
+				fmt.Fprintln(cr.log, "Error rendering", r.Request.URL, err)
+				r.Body = nil
+				return
+			}
+			r.Body = dom
+		})
+	}
+
+	// with -screenshot-diff, probes whose hashes aren't in the HTML the server
+	// sent are rendered, and hashes client-side code visibly puts on the
+	// page are found in the DOM instead
+	if cr.opts.ScreenshotDiff {
+		c.OnResponse(func(r *colly.Response) {
+			f, isForm := r.Ctx.GetAny("form").(Form)
+			inj, ok := r.Ctx.GetAny("injection").(injection)
+			if !isForm || !ok || !strings.Contains(r.Headers.Get("Content-Type"), "html") || len(inj.reflectedIn(r.Body, r.Headers)) > 0 {
+				return
+			}
+			region, dom, ok := visualReflection(cr.chrome, f, inj, session(r.Request))
+			if !ok {
+				return
+			}
+			r.Body = dom
+			r.Ctx.Put("visual", "visual="+region.String())
+		})
+	}
+
+	c.OnRequest(func(r *colly.Request) {
+		// the transport fails requests past the deadline, no point pacing them
+		if budget.expired() {
+			return
+		}
+		if isProbe(r) {
+			cr.probeLimiter.wait()
+		} else {
+			cr.crawlLimiter.wait()
+		}
+		cr.rates.wait(r.URL.Host)
+	})
+
+	// after the pacing, so deliberate waits don't read as a slow host
+	if cr.hosts != nil {
+		c.OnRequest(func(r *colly.Request) {
+			cr.hosts.begin(requestKey{c.ID, r.ID}, r.URL.Host)
+		})
+	}
+	c.OnResponse(func(r *colly.Response) {
+		cr.rates.observe(r.Request.URL.Host, r.StatusCode, *r.Headers)
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if r.Headers != nil {
+			cr.rates.observe(r.Request.URL.Host, r.StatusCode, *r.Headers)
+		}
+	})
+
+	// every crawl link goes through the frontier, which orders them by
+	// -strategy, by priority when other scanners flagged endpoints
+	strategy := cr.opts.Strategy
+	if strategy == "" && cr.signals != nil {
+		strategy = "priority"
+	}
+	queue := newFrontier(c, strategy, cr.parallelism, budget)
+	queue.signals = cr.signals
+	c.OnScraped(func(r *colly.Response) {
+		if !isProbe(r.Request) {
+			queue.done()
+		}
+	})
+	c.OnError(func(r *colly.Response, err error) {
+		if !isProbe(r.Request) {
+			queue.done()
+		}
+	})
+
+	// with -second-pass, every page crawled is requested again once the probes are done
+	revisit := newRevisits()
+	c.OnResponse(func(r *colly.Response) {
+		if !isProbe(r.Request) {
+			stat.page()
+			if cr.opts.SecondPass {
+				revisit.add(r.Request.URL.String())
+			}
+			if pv != nil {
+				pv.page()
+				pv.link(r.Request.URL.String())
+			}
+		}
+	})
+
+	// with -state, crawl progress is recorded, and a resumed crawl picks
+	// its pending links back up once the target's root is requested
+	if progress != nil {
+		pending := cr.state.pendingLinks(progress)
+		var seed sync.Once
+		c.OnRequest(func(r *colly.Request) {
+			if isProbe(r) {
+				return
+			}
+			cr.state.requested(progress, r.URL.String())
+			seed.Do(func() {
+				for link, depth := range pending {
+					parent, err := r.New("GET", link, nil)
+					if err != nil {
+						continue
+					}
+					parent.Depth = depth - 1
+					queue.push(parent, link)
+				}
+			})
+		})
+		// what ran out of time is left for -resume
+		c.OnError(func(r *colly.Response, err error) {
+			if !errors.Is(err, errOutOfTime) {
+				return
+			}
+			if f, ok := r.Ctx.GetAny("form").(Form); ok {
+				cr.state.unsubmitted(progress, f)
+			} else if !isProbe(r.Request) {
+				cr.state.dropped(progress, r.Request.URL.String(), r.Request.Depth)
+			}
+		})
+	}
+	c.OnError(func(r *colly.Response, err error) {
+		if !errors.Is(err, errOutOfTime) && !errors.Is(err, colly.ErrAbortedAfterHeaders) {
+			stat.fail()
+		}
+	})
+
+	// with -max-body-size and -content-types, crawled responses too big or
+	// of other types are dropped once their headers are in, before their
+	// bodies are downloaded. Their URLs were reported when they were found
+	if filter := newBodyFilter(cr.opts.MaxBodySize, cr.opts.ContentTypes); filter != nil {
+		if cr.opts.MaxBodySize > 0 {
+			c.MaxBodySize = int(cr.opts.MaxBodySize)
+		}
+		c.OnResponseHeaders(func(r *colly.Response) {
+			if !isProbe(r.Request) && filter.skip(r.Headers.Get("Content-Length"), r.Headers.Get("Content-Type")) {
+				stat.skip()
+				r.Request.Abort()
+			}
+		})
+	}
+
+	// cookies the target sets are audited, and used to judge which forms could be forged cross-site
+	cookies := newCookieWatch()
+	c.OnResponse(func(r *colly.Response) {
+		for _, cookie := range cookies.observe(r.Request.URL.Host, r.Headers) {
+			results <- cookieAudit(cookie, r.Request.URL.String(), tags)
+		}
+	})
+
+	// API endpoints get Origin probes for permissive CORS
+	cors := &corsChecker{}
+	c.OnResponse(func(r *colly.Response) {
+		if isProbe(r.Request) || !isAPIEndpoint(r) || pv != nil {
+			return
+		}
+		for _, finding := range cors.check(pr, r.Request.URL.String()) {
+			results <- Result{
+				Source: "cors",
+				URL:    r.Request.URL.String(),
+				Text:   fmt.Sprintf("Permissive CORS at %s", r.Request.URL),
+				Fields: joinFields(finding, tags),
+			}
+		}
+	})
+
+	// with -methods, endpoints are tried with methods the crawl never sends
+	if len(cr.opts.Methods) > 0 && pv == nil {
+		verbs := newMethodProber(cr.opts.Methods)
+		tryMethods := func(target string) {
+			accepted, allow := verbs.check(pr, target)
+			if res, ok := methodsResult(target, accepted, allow, tags); ok {
+				results <- res
+			}
+		}
+		c.OnResponse(func(r *colly.Response) {
+			if !isProbe(r.Request) {
+				tryMethods(r.Request.URL.String())
+			}
+		})
+		c.OnHTML("form", func(e *colly.HTMLElement) {
+			if isProbe(e.Request) {
+				return
+			}
+			for _, f := range parseForm(e) {
+				if cr.scope.allows(f.URL) && crawlable(c, f.URL) {
+					tryMethods(f.URL)
+				}
+			}
+		})
+	}
+
+	// pages other sites can frame
+	var framed sync.Map
+	c.OnResponse(func(r *colly.Response) {
+		if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+			return
+		}
+		page := r.Request.URL.String()
+		if _, seen := framed.LoadOrStore(page, true); seen {
+			return
+		}
+		if protection, ok := framingProtection(r.Headers); !ok {
+			results <- Result{
+				Source: "clickjacking",
+				URL:    page,
+				Text:   fmt.Sprintf("Page %s can be framed", page),
+				Fields: joinFields(protection, tags),
+			}
+		}
+	})
+
+	// pages are grouped by template and language, before anything probes them
+	clusters := newTemplateClusters(cr.opts.Cluster)
+	c.OnResponse(func(r *colly.Response) {
+		if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+			return
+		}
+		clusters.assign(r.Request.URL.String(), r.Headers, r.Body)
+	})
+
+	// set once the transport is ready, if -robots is present
+	var robots *robotsChecker
+
+	checkReflections := func(r *colly.Response) {
+		annotation := ""
+		if robots != nil {
+			annotation = robotsAnnotation(robots.disallowed(r.Request.URL.String()), pageRobots(r.Headers, nil, r.Body))
+		}
+		injections := cr.snapshotInjections()
+		for i := 0; i < len(injections); i++ {
+			// parameters reflecting in the same response are one finding,
+			// e.g. when the whole query string is echoed
+			if params := injections[i].reflectedIn(r.Body, r.Headers); len(params) > 0 {
+				via := paramList(params)
+				// anything on a page requested again after the probes was stored
+				if isRevisit(r.Request) {
+					page := pageKey(r.Request.URL.String())
+					if _, seen := cr.crossPages.LoadOrStore(injections[i].key()+" "+page, true); seen {
+						continue
+					}
+					from := injections[i].Page
+					if from == "" {
+						from = injections[i].FormLocation
+					}
+					class := ""
+					classes := reflectionClasses(r, injections[i], params)
+					if len(classes) > 0 {
+						class = "class=" + strings.Join(classes, ",")
+					}
+					locations := reflectionLocations(r, injections[i], params)
+					contexts := reflectionContexts(r, injections[i], params)
+					results <- Result{
+						Source: "stored",
+						URL:    r.Request.URL.String(),
+						Text:   fmt.Sprintf("Injection from %s (form on %s) stored and shown on %s via %s", injections[i].FormLocation, from, r.Request.URL, via),
+						Reflection: &ReflectionResult{
+							Form:       injections[i].FormLocation,
+							Params:     params,
+							Confidence: tentative,
+							Classes:    classes,
+							Locations:  locations,
+							Contexts:   contexts,
+						},
+						Fields: joinFields("page="+from, class, "in="+strings.Join(locations, ","), contextField(params, contexts), cr.canaries.fields(injections[i], params), clusters.field(injections[i].Page), tags, annotation),
+					}
+					continue
+				}
+				// a GET probe's own response may just be echoing its URL,
+				// the parts of it the page echoes are reported either way
+				echoed, echo := "", false
+				if r.Request.Method == "GET" && injections[i].sentIn(r.Request.URL.RawQuery) {
+					var parts []string
+					parts, echo = urlEcho(pr, r.Request.URL.String(), params)
+					if len(parts) > 0 {
+						echoed = "echo=" + strings.Join(parts, ",")
+					}
+				}
+				if echo {
+					via = "unknown-parameter echo"
+				}
+				contexts := reflectionContexts(r, injections[i], params)
+				confidence := reflectionConfidence(pr, cr.addInjection, r, injections[i], params, contexts, echo)
+				class := ""
+				classes := reflectionClasses(r, injections[i], params)
+				if len(classes) > 0 {
+					class = "class=" + strings.Join(classes, ",")
+				}
+				// only reflections that could execute are worth a browser
+				if cr.opts.VerifyBrowser && confidence != tentative && (containsString(classes, classXSS) || containsString(classes, classDOMSink)) {
+					if f, ok := r.Ctx.GetAny("form").(Form); ok && verifyInBrowser(cr.chrome, f, injections[i], params, session(r.Request)) {
+						confidence = browserVerified
+					}
+				}
+				stat.reflection(confidence, r.Request.URL.String(), params)
+				locations := reflectionLocations(r, injections[i], params)
+				where := "in=" + strings.Join(locations, ",")
+				// which characters get through decides whether a reflection is exploitable
+				var chars map[string]string
+				// and the payloads for its contexts those characters allow, whether they work
+				var payloads map[string][]string
+				// and with -mutations, which rewrites of them get through
+				var mutations []MutationResult
+				if confidence != tentative {
+					if f, ok := r.Ctx.GetAny("form").(Form); ok {
+						chars = survivingChars(pr, f, injections[i], params)
+						payloads = workingPayloads(pr, f, injections[i], params, contexts, chars)
+						if len(cr.opts.Mutations) > 0 {
+							mutations = mutatedPayloads(pr, f, injections[i], params, contexts, chars, cr.opts.Mutations)
+						}
+					}
+				}
+				// build response
+				response := fmt.Sprintf("Injection from %s found at %s via %s", injections[i].FormLocation, r.Request.URL, via)
+				results <- Result{
+					Source: "reflector",
+					URL:    r.Request.URL.String(),
+					Text:   response,
+					Reflection: &ReflectionResult{
+						Form:       injections[i].FormLocation,
+						Params:     params,
+						Confidence: confidence,
+						Classes:    classes,
+						Locations:  locations,
+						Contexts:   contexts,
+						Chars:      chars,
+						Payloads:   payloads,
+						Mutations:  mutations,
+					},
+					Fields: joinFields("confidence="+confidence, class, where, echoed, r.Ctx.Get("visual"), contextField(params, contexts), charsField(params, chars), payloadsField(params, payloads), mutationFields(params, mutations), stepField(r.Request), cr.canaries.fields(injections[i], params), clusters.field(injections[i].Page), tags, annotation),
+				}
+				// a hash sent on one page showing up on another is its own finding
+				if crossPage(r, injections[i]) {
+					page := pageKey(r.Request.URL.String())
+					if _, seen := cr.crossPages.LoadOrStore(injections[i].key()+" "+page, true); !seen {
+						from := injections[i].Page
+						if from == "" {
+							from = injections[i].FormLocation
+						}
+						results <- Result{
+							Source: "cross-page",
+							URL:    r.Request.URL.String(),
+							Text:   fmt.Sprintf("Injection from %s (form on %s) found on %s via %s", injections[i].FormLocation, from, r.Request.URL, via),
+							Reflection: &ReflectionResult{
+								Form:       injections[i].FormLocation,
+								Params:     params,
+								Confidence: confidence,
+								Classes:    classes,
+								Locations:  locations,
+								Contexts:   contexts,
+							},
+							Fields: joinFields("page="+from, class, where, contextField(params, contexts), cr.canaries.fields(injections[i], params), clusters.field(injections[i].Page), tags, annotation),
+						}
+					}
+				}
+			}
+		}
+	}
+	c.OnResponse(checkReflections)
+	// error pages are checked too, missing pages are where paths usually come back
+	// and a canary stored earlier can show up in any of them
+	c.OnError(func(r *colly.Response, err error) {
+		if r.Headers != nil {
+			checkReflections(r)
+		}
+	})
+
+	// the values parameters come with in links and crawled URLs, for the
+	// inputs a probe leaves alone
+	observed := newObservedValues()
+	c.OnRequest(func(r *colly.Request) {
+		if !isProbe(r) {
+			observed.observe(r.URL)
+		}
+	})
+
+	// follow queues a link found on parent's page for crawling
+	follow := func(parent *colly.Request, link string) {
+		absolute := parent.AbsoluteURL(link)
+		if u, err := url.Parse(absolute); err == nil && absolute != "" {
+			observed.observe(u)
+		}
+		if pv != nil && crawlable(c, absolute) {
+			pv.link(absolute)
+		}
+		// logging in again would only undo it
+		if cr.session.avoids(absolute) {
+			return
+		}
+		if progress != nil {
+			if cr.state.seen(progress, absolute) {
+				return
+			}
+			if crawlable(c, absolute) && (cr.opts.Depth == 0 || parent.Depth < cr.opts.Depth) {
+				cr.state.queued(progress, absolute, parent.Depth+1)
+			}
+		}
+		queue.push(parent, link)
+	}
+
+	// Print every href found, and visit it
+	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		link := e.Attr("href")
+		/*
+			if strings.Contains(link, "?") {
+				for _, s := range fuzzParameter(link, *payloads) {
+					e.Request.Visit(s)
+				}
+			}
+		*/
+		if (!cr.opts.ParamsOnly || hasParams(e.Request.AbsoluteURL(link))) && cr.scope.allows(e.Request.AbsoluteURL(link)) {
+			annotation := ""
+			if robots != nil {
+				annotation = robots.linkAnnotation(e, link)
+			}
+			printResult(link, "href", joinFields(tags, annotation), results, e)
+		}
+		follow(e.Request, link)
+	})
+
+	// alternate representations of a page often expose what it hides:
+	// AMP versions, other languages and feeds
+	c.OnHTML(alternateSelector, func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		link := e.Request.AbsoluteURL(e.Attr("href"))
+		if link == "" {
+			return
+		}
+		if (!cr.opts.ParamsOnly || hasParams(link)) && cr.scope.allows(link) {
+			results <- Result{Source: "alternate", URL: link, Fields: joinFields(alternateKind(e), tags)}
+		}
+		follow(e.Request, link)
+	})
+	// and feeds list their entries
+	c.OnResponse(func(r *colly.Response) {
+		if isProbe(r.Request) {
+			return
+		}
+		for _, link := range feedLinks(r.Headers.Get("Content-Type"), r.Body) {
+			link = r.Request.AbsoluteURL(link)
+			if link == "" {
+				continue
+			}
+			if (!cr.opts.ParamsOnly || hasParams(link)) && cr.scope.allows(link) {
+				results <- Result{Source: "feed", URL: link, Fields: joinFields("feed="+r.Request.URL.String(), tags)}
+			}
+			follow(r.Request, link)
+		}
+	})
+
+	// find and print all the JavaScript files
+	c.OnHTML("script[src]", func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		if (!cr.opts.ParamsOnly || hasParams(e.Request.AbsoluteURL(e.Attr("src")))) && cr.scope.allows(e.Request.AbsoluteURL(e.Attr("src"))) {
+			annotation := ""
+			if robots != nil {
+				annotation = robotsAnnotation(robots.disallowed(e.Request.AbsoluteURL(e.Attr("src"))), nil)
+			}
+			printResult(e.Attr("src"), "script", joinFields(tags, annotation), results, e)
+		}
+	})
+
+	// with -js-sinks, scripts are read for client-side XSS leads, only the
+	// site's own files are fetched since libraries would bury them
+	if cr.opts.ScanScripts {
+		scripts := &scriptScanner{}
+		fetcher := newProber(mined(authed(transport)), jar, cr.crawlLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize)
+		c.OnHTML("script", func(e *colly.HTMLElement) {
+			if isProbe(e.Request) || !isJavaScript(e.Attr("type")) {
+				return
+			}
+			page := e.Request.URL.String()
+			src := e.Attr("src")
+			if src == "" {
+				if res, ok := scripts.scan([]byte(e.Text), page, page, true, tags); ok {
+					results <- res
+				}
+				return
+			}
+			link := e.Request.AbsoluteURL(src)
+			if link == "" || !crawlable(c, link) || !scripts.fetch(link) {
+				return
+			}
+			resp, body, err := fetcher.do("GET", link, nil, nil)
+			if err != nil {
+				fmt.Fprintln(cr.log, "Error fetching script", link, err)
+				return
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			if res, ok := scripts.scan(body, link, page, false, tags); ok {
+				results <- res
+			}
+		})
+	}
+
+	// with -dig, comments and meta tags are read for what developers left
+	// in them, and the URLs they mention are crawled
+	if cr.opts.Dig {
+		digs := &digger{}
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+				return
+			}
+			found, links := digs.dig(r.Body, r.Request.URL.String(), tags)
+			for _, res := range found {
+				results <- res
+			}
+			for _, link := range links {
+				if httpURL(r.Request.AbsoluteURL(link)) {
+					follow(r.Request, link)
+				}
+			}
+		})
+	}
+
+	// Next.js and Nuxt sites list their routes in build files, and PWAs
+	// theirs in web app manifests and service workers, richer sources than
+	// the links they render. Each is read once
+	if !cr.opts.NoDiscover {
+		builds := newProber(mined(authed(transport)), jar, cr.crawlLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize)
+		route := func(link, field string) {
+			if !crawlable(c, link) || (progress != nil && cr.state.seen(progress, link)) {
+				return
+			}
+			if !cr.opts.ParamsOnly || hasParams(link) {
+				results <- Result{Source: "route", URL: link, Fields: joinFields(field, tags)}
+			}
+			if pv != nil {
+				pv.link(link)
+			}
+			queue.push(nil, link)
+		}
+
+		var fingerprinted sync.Map
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+				return
+			}
+			framework := detectFramework(r.Body)
+			if framework == "" {
+				return
+			}
+			if _, seen := fingerprinted.LoadOrStore(r.Request.URL.Host, true); seen {
+				return
+			}
+			for _, link := range frameworkRoutes(builds, framework, r.Request.URL, r.Body) {
+				route(link, "framework="+framework)
+			}
+		})
+
+		var fetched sync.Map
+		serviceWorker := func(worker string) {
+			if !crawlable(c, worker) {
+				return
+			}
+			if _, seen := fetched.LoadOrStore(worker, true); seen {
+				return
+			}
+			for _, link := range serviceWorkerRoutes(builds, worker) {
+				route(link, "from=service-worker")
+			}
+		}
+		c.OnHTML("link[rel=manifest]", func(e *colly.HTMLElement) {
+			if isProbe(e.Request) {
+				return
+			}
+			manifest := e.Request.AbsoluteURL(e.Attr("href"))
+			if manifest == "" || !crawlable(c, manifest) {
+				return
+			}
+			if _, seen := fetched.LoadOrStore(manifest, true); seen {
+				return
+			}
+			for _, link := range manifestRoutes(builds, manifest) {
+				route(link, "from=manifest")
+			}
+			// PWAs mostly register their service worker from a bundle, where it isn't seen
+			for _, worker := range commonServiceWorkers {
+				serviceWorker(e.Request.AbsoluteURL(worker))
+			}
+		})
+		c.OnHTML("script:not([src])", func(e *colly.HTMLElement) {
+			if isProbe(e.Request) {
+				return
+			}
+			for _, m := range swRegisterRegex.FindAllStringSubmatch(e.Text, -1) {
+				serviceWorker(e.Request.AbsoluteURL(m[1]))
+			}
+		})
+	}
+
+	// links in images, frames, stylesheets, meta refreshes, image maps and
+	// data attributes, each reported as its own source
+	c.OnHTML("html", func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		for _, l := range elementLinks(e.DOM) {
+			link := e.Request.AbsoluteURL(l.url)
+			if !httpURL(link) {
+				continue
+			}
+			if (!cr.opts.ParamsOnly || hasParams(link)) && cr.scope.allows(link) {
+				annotation := ""
+				if robots != nil {
+					annotation = robotsAnnotation(robots.disallowed(link), nil)
+				}
+				results <- Result{Source: l.source, URL: link, Fields: joinFields(tags, annotation)}
+			}
+			if l.follow {
+				follow(e.Request, link)
+			}
+		}
+	})
+
+	// the scripts, styles and frames of other sites make up the target's third-party inventory
+	c.OnHTML(dependencySelector, func(e *colly.HTMLElement) {
+		if !isProbe(e.Request) {
+			stat.deps.add(e)
+		}
+	})
+
+	// report http subresources on https pages
+	c.OnHTML(subresourceSelector, func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		if resource := mixedContent(e); resource != "" && cr.scope.allows(resource) {
+			response := fmt.Sprintf("Mixed content %s loaded by %s", resource, e.Request.URL)
+			results <- Result{Source: "mixed-content", URL: resource, Text: response, Fields: tags}
+		}
+	})
+
+	// find and print all the form action URLs
+	c.OnHTML("form[action]", func(e *colly.HTMLElement) {
+		if isProbe(e.Request) {
+			return
+		}
+		res := Result{Source: "form", URL: e.Request.AbsoluteURL(e.Attr("action")), Fields: tags}
+		if forms := parseForm(e); len(forms) > 0 {
+			res.Method = forms[0].Method
+			res.Inputs = forms[0].Inputs
+		}
+		if res.URL != "" && cr.scope.allows(res.URL) {
+			results <- res
+		}
+	})
+
+	c.OnHTML("form", func(e *colly.HTMLElement) {
+		// probe responses are only checked for reflections
+		if isProbe(e.Request) {
+			return
+		}
+		stat.form()
+		skip := clusters.skip(e.Request.URL.String())
+		// each submit button gets its own hashes so reflections can be told apart
+		for _, f := range parseForm(e) {
+			if pv != nil && cr.scope.allows(f.URL) {
+				pv.form(f)
+			}
+			if skip || !probes.form(f) || (progress != nil && cr.state.submitted(progress, f)) {
+				continue
+			}
+			if candidate := cookies.csrfCandidate(f, e.Request.URL.String(), e.Request.URL.Host, sessionCookie); candidate != "" && cr.scope.allows(f.URL) {
+				results <- Result{Source: "csrf-candidate", URL: f.URL, Method: f.Method, Text: candidate, Fields: tags}
+			}
+			f = observed.fill(f)
+			inj := newInjection(f)
+			if cr.prefill != nil {
+				f, inj = cr.prefill.apply(f, inj)
+			}
+			batches := splitInjection(inj, cr.opts.Batch)
+			for i, inj := range batches {
+				// append to injectionMap
+				batches[i] = cr.addInjection(inj)
+			}
+			// send the form requests
+			submitBatches(c, f, batches)
+		}
+	})
+
+	// the later steps of a multi-step form are only reached by submitting
+	// the one before, so a probe landing on one goes on with fresh hashes.
+	// Hashes from earlier steps reflected there are still reported against
+	// their own form
+	wizard := &wizardSteps{}
+	c.OnHTML("form", func(e *colly.HTMLElement) {
+		if !isProbe(e.Request) || !isWizardStep(e) {
+			return
+		}
+		previous, ok := e.Request.Ctx.GetAny("form").(Form)
+		if !ok {
+			return
+		}
+		step := probeStep(e.Request) + 1
+		for _, f := range wizard.next(parseForm(e), previous, step) {
+			if !probes.form(f) {
+				continue
+			}
+			f = observed.fill(f)
+			inj := newInjection(f)
+			if cr.prefill != nil {
+				f, inj = cr.prefill.apply(f, inj)
+			}
+			inj = cr.addInjection(inj)
+			submitStep(c, f, inj, step)
+		}
+	})
+
+	// with -query, parameters in crawled URLs are probed one at a time
+	if cr.opts.Query && probes[probeQuery] {
+		queries := &queryTester{}
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || clusters.skip(r.Request.URL.String()) {
+				return
+			}
+			if f, ok := queries.form(r.Request.URL); ok {
+				if progress != nil && cr.state.submitted(progress, f) {
+					return
+				}
+				inj := newInjection(f)
+				if cr.prefill != nil {
+					f, inj = cr.prefill.apply(f, inj)
+				}
+				for _, inj := range splitInjection(inj, 1) {
+					inj = cr.addInjection(inj)
+					submitForm(c, f, inj)
+				}
+			}
+		})
+	}
+
+	// with -discover-params, every endpoint crawled is tried with guessed
+	// parameter names, and the ones it takes are probed one at a time
+	if cr.opts.DiscoverParams && probes[probeQuery] {
+		var guessed sync.Map
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || r.Request.Method != "GET" || !guessable(r.StatusCode, r.Headers.Get("Content-Type")) || clusters.skip(r.Request.URL.String()) {
+				return
+			}
+			endpoint := *r.Request.URL
+			endpoint.RawQuery, endpoint.Fragment = "", ""
+			if _, seen := guessed.LoadOrStore(endpoint.String(), true); seen {
+				return
+			}
+			page := r.Request.URL.String()
+			found, reflected := guessParams(pr, r.Request.URL, guessNames(cr.params.list()))
+			if len(found) == 0 || !cr.scope.allows(page) {
+				return
+			}
+			var echoed []string
+			for _, name := range found {
+				if reflected[name] {
+					echoed = append(echoed, name)
+				}
+			}
+			field := ""
+			if len(echoed) > 0 {
+				field = "reflected=" + strings.Join(echoed, ",")
+			}
+			results <- Result{
+				Source: "hidden-param",
+				URL:    page,
+				Text:   fmt.Sprintf("Hidden parameters %s on %s", strings.Join(found, ", "), page),
+				Fields: joinFields("params="+strings.Join(found, ","), field, tags),
+			}
+			f := guessedForm(r.Request.URL, found)
+			if progress != nil && cr.state.submitted(progress, f) {
+				return
+			}
+			f = observed.fill(f)
+			inj := newInjection(f)
+			if cr.prefill != nil {
+				f, inj = cr.prefill.apply(f, inj)
+			}
+			for _, inj := range splitInjection(inj, 1) {
+				inj = cr.addInjection(inj)
+				submitForm(c, f, inj)
+			}
+		})
+	}
+
+	// with -test-headers, every crawled page is requested once more with
+	// canaries in the headers and cookies apps tend to echo
+	if probes[probeHeaders] || probes[probeCookies] {
+		var tested sync.Map
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || clusters.skip(r.Request.URL.String()) {
+				return
+			}
+			page := r.Request.URL.String()
+			if _, seen := tested.LoadOrStore(page, true); seen {
+				return
+			}
+			inj := headerInjection(page, c.Cookies(page), cr.headers.filled()["Cookie"], probes[probeHeaders], probes[probeCookies])
+			if inj.injected() == 0 {
+				return
+			}
+			sendHeaderProbe(c, page, cr.addInjection(inj))
+		})
+	}
+
+	// and with the path and fragment probe families, once with a hash
+	// appended to its path and once with a hash in its fragment
+	if probes[probePath] || probes[probeFragment] {
+		var tested sync.Map
+		c.OnResponse(func(r *colly.Response) {
+			if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") || clusters.skip(r.Request.URL.String()) {
+				return
+			}
+			page := r.Request.URL.String()
+			if _, seen := tested.LoadOrStore(page, true); seen {
+				return
+			}
+			if probes[probePath] {
+				inj := cr.addInjection(pathInjection(r.Request.URL))
+				sendPathProbe(c, r.Request.URL, inj)
+			}
+			if probes[probeFragment] {
+				inj := cr.addInjection(fragmentInjection(r.Request.URL))
+				sendFragmentProbe(c, page, inj)
+			}
+		})
+	}
+
+	// WebSocket endpoints in pages, and with -ws in the site's own scripts,
+	// are reported. With the websocket probe family their handshakes are
+	// sent with a hash in each query parameter, and with -ws they are sent
+	// messages with hashes, checked against the handshake response and the
+	// first messages the server sends
+	sockets := &wsTester{}
+	socketScripts := newProber(mined(authed(transport)), jar, cr.crawlLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize)
+	socket := func(link string, page *url.URL) {
+		if !crawlable(c, wsHandshakeURL(link)) || !cr.scope.allows(link) || !sockets.endpoint(link) {
+			return
+		}
+		results <- Result{Source: "websocket", URL: link, Fields: joinFields("page="+page.String(), tags)}
+		origin := page.Scheme + "://" + page.Host
+		report := func(inj injection, messages bool) {
+			inj = cr.addInjection(inj)
+			params, locations, confidence, ok := testWebSocket(pr, link, origin, inj, messages)
+			if !ok {
+				return
+			}
+			stat.reflection(confidence, link, params)
+			results <- Result{
+				Source: "reflector",
+				URL:    link,
+				Text:   fmt.Sprintf("Injection from %s found in its WebSocket connection via %s", link, paramList(params)),
+				Reflection: &ReflectionResult{
+					Form:       link,
+					Params:     params,
+					Confidence: confidence,
+					Locations:  locations,
+				},
+				Fields: joinFields("confidence="+confidence, "in="+strings.Join(locations, ","), "page="+page.String(), cr.canaries.fields(inj, params), tags),
+			}
+		}
+		if inj, ok := queryInjection(link, page.String()); ok && probes[probeWebSocket] {
+			report(inj, false)
+		}
+		if cr.opts.WebSockets {
+			report(messageInjection(link, page.String()), true)
+		}
+	}
+	c.OnResponse(func(r *colly.Response) {
+		if isProbe(r.Request) || !strings.Contains(r.Headers.Get("Content-Type"), "html") {
+			return
+		}
+		for _, link := range wsURLs(r.Body, r.Request.URL) {
+			socket(link, r.Request.URL)
+		}
+	})
+	if cr.opts.WebSockets {
+		c.OnHTML("script[src]", func(e *colly.HTMLElement) {
+			if isProbe(e.Request) {
+				return
+			}
+			script := e.Request.AbsoluteURL(e.Attr("src"))
+			if script == "" || !crawlable(c, script) || !sockets.fetch(script) {
+				return
+			}
+			resp, body, err := socketScripts.do("GET", script, nil, nil)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				return
+			}
+			for _, link := range wsURLs(body, e.Request.URL) {
+				socket(link, e.Request.URL)
+			}
+		})
+	}
+
+	// a batch the app rejected outright may just dislike one of its values,
+	// so retry it one parameter at a time
+	c.OnError(func(r *colly.Response, err error) {
+		f, ok := r.Ctx.GetAny("form").(Form)
+		inj, _ := r.Ctx.GetAny("injection").(injection)
+		if !ok || r.StatusCode < 400 || inj.injected() < 2 {
+			return
+		}
+		singles := splitInjection(inj, 1)
+		for i, single := range singles {
+			singles[i] = cr.addInjection(single)
+		}
+		// batches still waiting their turn go after the singles, in the same turn
+		if rest, ok := r.Ctx.GetAny("batches").([]injection); ok {
+			singles = append(singles, rest...)
+			r.Ctx.Put("batches", []injection(nil))
+		}
+		submitBatches(c, pr.freshTokens(f), singles)
+	})
+
+	// the batches of a form with anti-CSRF tokens go out in turn, see submitBatches
+	nextBatch := func(r *colly.Response) {
+		rest, ok := r.Ctx.GetAny("batches").([]injection)
+		f, _ := r.Ctx.GetAny("form").(Form)
+		if !ok || len(rest) == 0 {
+			return
+		}
+		r.Ctx.Put("batches", []injection(nil))
+		submitBatches(c, pr.freshTokens(f), rest)
+	}
+	c.OnScraped(nextBatch)
+	c.OnError(func(r *colly.Response, err error) {
+		nextBatch(r)
+	})
+
+	// add the custom headers and the next user agent
+	if len(cr.headers.values) > 0 || len(cr.headers.agents) > 0 {
+		c.OnRequest(func(r *colly.Request) {
+			for header, value := range cr.headers.current() {
+				r.Headers.Set(header, value)
+			}
+		})
+	}
+
+	// send probes as a rotating identity, after the custom headers so it wins
+	if cr.pool != nil {
+		c.OnRequest(func(r *colly.Request) {
+			if isProbe(r) {
+				i := cr.pool.next()
+				r.Ctx.Put("identity", i)
+				cr.pool.apply(i, r.Headers)
+			}
+		})
+		c.OnResponse(func(r *colly.Response) {
+			if i, ok := r.Ctx.GetAny("identity").(int); ok {
+				cr.pool.report(i, r.StatusCode, nil)
+			}
+		})
+		c.OnError(func(r *colly.Response, err error) {
+			if errors.Is(err, colly.ErrAbortedAfterHeaders) {
+				err = nil
+			}
+			if i, ok := r.Ctx.GetAny("identity").(int); ok {
+				cr.pool.report(i, r.StatusCode, err)
+			}
+		})
+	}
+
+	// header probe canaries go on last, over custom headers and identities
+	c.OnRequest(func(r *colly.Request) {
+		if canaries, ok := r.Ctx.GetAny("canaries").(http.Header); ok {
+			for name, values := range canaries {
+				(*r.Headers)[name] = values
+			}
+		}
+		if isProbe(r) {
+			cr.canaries.sent(r)
+		}
+	})
+
+	if cr.pool != nil {
+		c.WithTransport(mined(authed(cr.pool.wrap(transport))))
+	} else {
+		c.WithTransport(mined(authed(transport)))
+	}
+	c.SetCookieJar(jar)
+	// the transport times each attempt, a timeout over all of them would cut retries short
+	c.SetRequestTimeout(0)
+	if cr.opts.Robots {
+		robots = newRobotsChecker(newProber(authed(transport), jar, cr.crawlLimiter, cr.rates, cr.headers, cr.opts.MaxBodySize))
+	}
+	if cr.opts.Meta {
+		meta, err := fetchTargetMeta(transport, target, cr.HeadersFor(target))
+		if err != nil {
+			fmt.Fprintln(cr.log, "Error recording metadata:", err)
+		} else {
+			cr.mu.Lock()
+			cr.metas = append(cr.metas, meta)
+			cr.mu.Unlock()
+		}
+	}
+
+	// checkpoint while crawling, so an interruption loses little
+	if progress != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			ticker := time.NewTicker(checkpointInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := cr.state.save(cr.snapshotInjections()); err != nil {
+						fmt.Fprintln(cr.log, "Error saving state:", err)
+					}
+				case <-stop:
+					return
+				}
+			}
+		}()
+	}
+
+	// Start scraping
+	queue.push(nil, target)
+	// what other scanners flagged on the target's host is crawled first
+	for _, link := range cr.signals.seeds(target) {
+		if crawlable(c, link) {
+			queue.push(nil, link)
+		}
+	}
+	// robots.txt and sitemaps list paths that no page may link to,
+	// they are crawled as if they were targets of their own
+	if !cr.opts.NoDiscover {
+		client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+		for _, link := range discoverLinks(client, target, cr.opts.RespectRobots) {
+			if !crawlable(c, link.url) || (progress != nil && cr.state.seen(progress, link.url)) {
+				continue
+			}
+			if !cr.opts.ParamsOnly || hasParams(link.url) {
+				annotation := ""
+				if robots != nil {
+					annotation = robotsAnnotation(robots.disallowed(link.url), nil)
+				}
+				results <- Result{Source: link.source, URL: link.url, Fields: joinFields(tags, annotation)}
+			}
+			if pv != nil {
+				pv.link(link.url)
+			}
+			queue.push(nil, link.url)
+		}
+		// API specs document endpoints and parameters no page links to,
+		// their GET endpoints are crawled and their parameters probed
+		for _, op := range discoverSpecs(client, target) {
+			link := op.link()
+			if !crawlable(c, link) || !cr.scope.allows(link) {
+				continue
+			}
+			if !cr.opts.ParamsOnly || len(op.query)+len(op.form) > 0 {
+				results <- Result{Source: "openapi", URL: link, Method: op.method, Fields: joinFields(op.fields(), tags)}
+			}
+			if op.method == "GET" && (progress == nil || !cr.state.seen(progress, link)) {
+				if pv != nil {
+					pv.link(link)
+				}
+				queue.push(nil, link)
+			}
+			f, ok := op.probe()
+			if !ok {
+				continue
+			}
+			if pv != nil {
+				pv.form(f)
+			}
+			if !probes.form(f) || (progress != nil && cr.state.submitted(progress, f)) {
+				continue
+			}
+			f = observed.fill(f)
+			inj := newInjection(f)
+			if cr.prefill != nil {
+				f, inj = cr.prefill.apply(f, inj)
+			}
+			batches := splitInjection(inj, cr.opts.Batch)
+			for i, inj := range batches {
+				batches[i] = cr.addInjection(inj)
+			}
+			submitBatches(c, f, batches)
+		}
+	}
+	queue.run()
+	// Wait until threads are finished
+	c.Wait()
+	// values stored by a probe may only show up on pages crawled before it was sent
+	if cr.opts.SecondPass && !budget.cutShort() && len(cr.snapshotInjections()) > 0 {
+		pages := revisit.list()
+		fmt.Fprintln(cr.log, "Second pass over", len(pages), "pages of", target)
+		for _, page := range pages {
+			sendRevisit(c, page)
+		}
+		c.Wait()
+	}
+	stat.finish(budget.cutShort(), budget.exhausted())
+	if budget.cutShort() {
+		fmt.Fprintln(cr.log, "Out of time for", target, "after", time.Since(stat.start).Round(time.Second))
+	} else if budget.exhausted() {
+		fmt.Fprintln(cr.log, "Reached", budget.maxPages, "URLs for", target, "after", time.Since(stat.start).Round(time.Second))
+	}
+	if cr.opts.Cluster {
+		pages, templates, skipped := clusters.counts()
+		fmt.Fprintf(cr.log, "Clustered %d pages of %s into %d templates, %d left unprobed\n", pages, target, templates, skipped)
+	}
+	// a target cut short is picked back up by -resume
+	if progress != nil {
+		if !budget.cutShort() && !budget.exhausted() {
+			cr.state.finish(progress)
+		}
+		if err := cr.state.save(cr.snapshotInjections()); err != nil {
+			fmt.Fprintln(cr.log, "Error saving state:", err)
+		}
+	}
+	return nil
+}
+
+// PrintSummary writes the per-target table, third-party inventory, heat
+// maps, metadata, identity, adaptive thread and rate limit statistics of everything crawled so far
+func (cr *Crawler) PrintSummary(w io.Writer) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for _, pv := range cr.previews {
+		pv.print(w)
+	}
+	if len(cr.stats) > 1 {
+		printSummaryTable(w, cr.stats)
+	}
+	for _, stat := range cr.stats {
+		stat.deps.print(w, stat.Target)
+	}
+	if cr.opts.HeatMap != "" {
+		for _, stat := range cr.stats {
+			stat.heat.print(w, stat.Target, cr.opts.HeatMap)
+		}
+	}
+	for _, meta := range cr.metas {
+		meta.print(w)
+	}
+	if cr.pool != nil {
+		cr.pool.printStats(w)
+	}
+	if cr.hosts != nil {
+		cr.hosts.printStats(w)
+	}
+	cr.rates.printStats(w)
+	cr.retries.printStats(w)
+	if cr.timings != nil {
+		cr.timings.printStats(w)
+	}
+}
+
+// injection records one form submission, with a separate hash per parameter
+// so we know which ones came back
+type injection struct {
+	FormLocation string `json:"form"`
+	// the page the form was found on
+	Page   string   `json:"page"`
+	Params []string `json:"params"`
+	Hashes []string `json:"hashes"`
+}
+
+// reflectedIn returns the parameters whose hash appears in the body or a header
+func (inj injection) reflectedIn(body []byte, h *http.Header) []string {
+	headers := inj.reflectedHeaders(h)
+	var params []string
+	for i, hash := range inj.Hashes {
+		if hash == "" {
+			continue
+		}
+		if _, ok := headers[inj.Params[i]]; ok || bytes.Contains(body, []byte(canaryID(hash))) {
+			params = append(params, inj.Params[i])
+		}
+	}
+	return params
+}
+
+// addInjection records an injection about to be submitted and returns it
+// with any canary that collides with an earlier one replaced
+func (cr *Crawler) addInjection(inj injection) injection {
+	cr.injectionMu.Lock()
+	defer cr.injectionMu.Unlock()
+	inj = cr.canaries.add(inj)
+	cr.injections = append(cr.injections, inj)
+	return inj
+}
+
+// snapshotInjections returns the injections recorded so far
+func (cr *Crawler) snapshotInjections() []injection {
+	cr.injectionMu.Lock()
+	defer cr.injectionMu.Unlock()
+	return cr.injections[:len(cr.injections):len(cr.injections)]
+}
+
+// injected counts the parameters carrying a hash
+func (inj injection) injected() int {
+	n := 0
+	for _, hash := range inj.Hashes {
+		if hash != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// sentIn reports whether any of the injection's hashes are in s
+func (inj injection) sentIn(s string) bool {
+	for _, hash := range inj.Hashes {
+		if hash != "" && strings.Contains(s, canaryID(hash)) {
+			return true
+		}
+	}
+	return false
+}
+
+// paramList formats reflected parameter names for output
+func paramList(params []string) string {
+	if len(params) == 1 {
+		return "param " + params[0]
+	}
+	return "params " + strings.Join(params, ", ")
+}
+
+// ParseTarget splits an input line into the target url and its tags,
+// e.g. "https://example.com tag=staging team=payments"
+func ParseTarget(line string) (string, string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	var tags []string
+	for _, field := range fields[1:] {
+		if strings.Contains(field, "=") {
+			tags = append(tags, field)
+		}
+	}
+	return fields[0], strings.Join(tags, " ")
+}
+
+// joinFields joins the non-empty space separated output fields
+func joinFields(fields ...string) string {
+	var nonEmpty []string
+	for _, field := range fields {
+		if field != "" {
+			nonEmpty = append(nonEmpty, field)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
+
+// print result sends a found URL to the results chan
+func printResult(link string, sourceName string, tags string, results chan<- Result, e *colly.HTMLElement) {
+	url := e.Request.AbsoluteURL(link)
+	if url != "" {
+		results <- Result{Source: sourceName, URL: url, Fields: tags}
+	}
+}
+
+// ParseHeaders does validation of headers input and returns it as a formatted map,
+// e.g. "Cookie: foo=bar;;Authorization: Bearer token"
+func ParseHeaders(rawHeaders string) (map[string]string, error) {
+	var headers map[string]string
+	if rawHeaders != "" {
+		if !strings.Contains(rawHeaders, ":") {
+			return nil, errors.New("headers flag not formatted properly (no colon to separate header and value)")
+		}
+
+		headers = make(map[string]string)
+		rawHeaders := strings.Split(rawHeaders, ";;")
+		for _, header := range rawHeaders {
+			var parts []string
+			if strings.Contains(header, ": ") {
+				parts = strings.SplitN(header, ": ", 2)
+			} else if strings.Contains(header, ":") {
+				parts = strings.SplitN(header, ":", 2)
+			} else {
+				continue
+			}
+			headers[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return headers, nil
+}
+
+// extractHostname() extracts the hostname from a URL and returns it
+func extractHostname(urlString string) (string, error) {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return "", err
+	}
+	return u.Hostname(), nil
+}
+
+// hasParams reports whether a URL carries query parameters
+func hasParams(urlString string) bool {
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return false
+	}
+	return u.RawQuery != ""
+}
+
+// returns a random alphabetical string of provided length
+func randomString(length int) string {
+	charset := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = charset[randomIndex(len(charset))]
+	}
+	return string(b)
+}
+
+// seed rand for randomString(), a rand.Rand isn't safe for concurrent use
+var (
+	seededRand *rand.Rand = rand.New(
+		rand.NewSource(time.Now().UnixNano()))
+	seededRandMu sync.Mutex
+)
+
+// randomIndex returns a random index below n, from any goroutine
+func randomIndex(n int) int {
+	seededRandMu.Lock()
+	defer seededRandMu.Unlock()
+	return seededRand.Intn(n)
+}
@@ -0,0 +1,195 @@
+package reflector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// how long a request may take when Options.Timeout isn't set, colly's own default
+const defaultTimeout = 10 * time.Second
+
+// backoff between attempts doubles from retryBackoff up to maxRetryBackoff
+const (
+	retryBackoff    = 500 * time.Millisecond
+	maxRetryBackoff = 30 * time.Second
+)
+
+// errOutOfTime fails requests once a crawl's deadline has passed
+var errOutOfTime = errors.New("out of time")
+
+// statuses that say try again later rather than no
+var retryStatuses = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// retryTransport gives every attempt at a request its own timeout, body
+// included, and retries the ones that failed transiently with exponential
+// backoff, after any pause the host asked for. Nothing is sent once the
+// budget's deadline has passed
+type retryTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+	retries int
+	rates   *hostRates
+	stats   *retryStats
+	budget  *depthBudget
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if t.budget.expired() {
+			return nil, errOutOfTime
+		}
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+		resp, err := t.try(req)
+		// a body that can't be sent again can't be retried either
+		last := attempt == t.retries || (req.Body != nil && req.GetBody == nil) || req.Context().Err() != nil
+		switch {
+		case err != nil && transientError(err):
+		case err == nil && retryStatuses[resp.StatusCode]:
+		default:
+			return resp, err
+		}
+		if last {
+			if t.retries > 0 {
+				t.stats.failed(req.URL.Host)
+			}
+			return resp, err
+		}
+		t.stats.retried(req.URL.Host)
+		if resp != nil {
+			t.rates.observe(req.URL.Host, resp.StatusCode, resp.Header)
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(backoff(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		t.rates.wait(req.URL.Host)
+	}
+}
+
+// try sends one attempt, which is cancelled once the timeout passes
+// or the response body is closed
+func (t *retryTransport) try(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases an attempt's timeout when its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// Write passes through to a switched protocol's connection, see prober.upgrade
+func (b *cancelBody) Write(p []byte) (int, error) {
+	return writeThrough(b.ReadCloser, p)
+}
+
+// transientError reports whether a request failed in a way worth retrying:
+// a reset or dropped connection or a timeout
+func transientError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff is how long to wait before retrying after attempt, with jitter so
+// requests failing together don't all come back at once
+func backoff(attempt int) time.Duration {
+	wait := maxRetryBackoff
+	if attempt < 16 {
+		if d := retryBackoff << uint(attempt); d < maxRetryBackoff {
+			wait = d
+		}
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// retryStats counts retries and the requests given up on per host
+type retryStats struct {
+	mu    sync.Mutex
+	hosts map[string]*hostRetries
+}
+
+type hostRetries struct {
+	retried int
+	failed  int
+}
+
+func newRetryStats() *retryStats {
+	return &retryStats{hosts: make(map[string]*hostRetries)}
+}
+
+func (s *retryStats) host(host string) *hostRetries {
+	h, ok := s.hosts[host]
+	if !ok {
+		h = &hostRetries{}
+		s.hosts[host] = h
+	}
+	return h
+}
+
+func (s *retryStats) retried(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(host).retried++
+}
+
+func (s *retryStats) failed(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.host(host).failed++
+}
+
+// printStats writes the hosts that needed retries for the run summary
+func (s *retryStats) printStats(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var hosts []string
+	for host := range s.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := s.hosts[host]
+		fmt.Fprintf(w, "[retries] %s retried=%d gave-up=%d\n", host, h.retried, h.failed)
+	}
+}
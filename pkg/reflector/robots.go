@@ -0,0 +1,128 @@
+package reflector
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+	"github.com/temoto/robotstxt"
+)
+
+// robotsChecker fetches robots.txt once per host and answers whether URLs are disallowed
+type robotsChecker struct {
+	prober *prober
+	mu     sync.Mutex
+	hosts  map[string]*robotsHost
+}
+
+// robotsHost is the robots.txt of one host, fetched by whoever asks first
+// while the others asking wait for it
+type robotsHost struct {
+	once   sync.Once
+	robots *robotstxt.RobotsData
+}
+
+// newRobotsChecker returns a checker fetching through p, so robots.txt
+// requests are paced, retried and carry the custom headers like the crawl's
+func newRobotsChecker(p *prober) *robotsChecker {
+	return &robotsChecker{
+		prober: p,
+		hosts:  make(map[string]*robotsHost),
+	}
+}
+
+// disallowed reports whether robots.txt on the URL's host disallows it for all agents
+func (rc *robotsChecker) disallowed(urlString string) bool {
+	u, err := url.Parse(urlString)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	robots := rc.fetch(u)
+	if robots == nil {
+		return false
+	}
+	return !robots.TestAgent(u.RequestURI(), "*")
+}
+
+// fetch returns the cached robots.txt of a host, nil if there is none. Only
+// the map is locked, other hosts aren't held up by a slow one
+func (rc *robotsChecker) fetch(u *url.URL) *robotstxt.RobotsData {
+	key := u.Scheme + "://" + u.Host
+	rc.mu.Lock()
+	host, ok := rc.hosts[key]
+	if !ok {
+		host = &robotsHost{}
+		rc.hosts[key] = host
+	}
+	rc.mu.Unlock()
+
+	host.once.Do(func() {
+		resp, body, err := rc.prober.do("GET", key+"/robots.txt", nil, nil)
+		if err != nil {
+			return
+		}
+		if robots, err := robotstxt.FromStatusAndBytes(resp.StatusCode, body); err == nil {
+			host.robots = robots
+		}
+	})
+	return host.robots
+}
+
+// linkAnnotation annotates a link found on a page, it is nofollow
+// through its own rel attribute or through the page it was found on
+func (rc *robotsChecker) linkAnnotation(e *colly.HTMLElement, link string) string {
+	var markers []string
+	nofollow := strings.Contains(strings.ToLower(e.Attr("rel")), "nofollow")
+	for _, marker := range pageRobots(e.Response.Headers, e.DOM.Parents().Last(), nil) {
+		nofollow = nofollow || marker == "nofollow"
+	}
+	if nofollow {
+		markers = append(markers, "nofollow")
+	}
+	return robotsAnnotation(rc.disallowed(e.Request.AbsoluteURL(link)), markers)
+}
+
+var metaRobotsRegex = regexp.MustCompile(`(?is)<meta[^>]+name=["']?robots["']?[^>]*>`)
+
+// pageRobots returns the noindex/nofollow markers of a page from its
+// X-Robots-Tag header and robots meta tag, doc may be nil to scan the raw body
+func pageRobots(header *http.Header, doc *goquery.Selection, body []byte) []string {
+	var directives string
+	if header != nil {
+		directives = strings.Join(header.Values("X-Robots-Tag"), ",")
+	}
+	if doc != nil {
+		doc.Find("meta[name=robots], meta[name=ROBOTS], meta[name=Robots]").Each(func(_ int, s *goquery.Selection) {
+			directives += "," + s.AttrOr("content", "")
+		})
+	} else {
+		for _, tag := range metaRobotsRegex.FindAll(body, -1) {
+			directives += "," + string(tag)
+		}
+	}
+	directives = strings.ToLower(directives)
+
+	var markers []string
+	if strings.Contains(directives, "noindex") || strings.Contains(directives, "none") {
+		markers = append(markers, "noindex")
+	}
+	if strings.Contains(directives, "nofollow") || strings.Contains(directives, "none") {
+		markers = append(markers, "nofollow")
+	}
+	return markers
+}
+
+// robotsAnnotation builds the robots=... field appended to output lines, empty if nothing applies
+func robotsAnnotation(disallowed bool, markers []string) string {
+	if disallowed {
+		markers = append([]string{"disallowed"}, markers...)
+	}
+	if len(markers) == 0 {
+		return ""
+	}
+	return "robots=" + strings.Join(markers, ",")
+}
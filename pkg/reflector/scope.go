@@ -0,0 +1,127 @@
+package reflector
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// scope decides which URLs are crawled, probed and reported. With include
+// rules a URL has to match one of them, replacing the target's own host
+// and -subs, and it must never match an exclude rule
+type scope struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// loadScope reads a scope file, one rule per line as include or exclude
+// followed by a pattern, the shape of which says what it is matched against:
+//
+//	include *.example.com          host glob
+//	exclude sso.example.com
+//	exclude /logout*               path glob
+//	exclude https://*/static/*     URL glob
+//	exclude re:\.(png|css|woff2?)$ regular expression anywhere in the URL
+//
+// A * in a glob matches any run of characters, within the host for host globs
+func loadScope(path string) (*scope, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &scope{}
+	lines := bufio.NewScanner(file)
+	for n := 1; lines.Scan(); n++ {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected include or exclude and a pattern", n)
+		}
+		rule, err := scopeRule(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "include":
+			s.include = append(s.include, rule)
+		case "exclude":
+			s.exclude = append(s.exclude, rule)
+		default:
+			return nil, fmt.Errorf("line %d: unknown rule %q, expected include or exclude", n, fields[0])
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.include) == 0 && len(s.exclude) == 0 {
+		return nil, fmt.Errorf("no rules found in %s", path)
+	}
+	return s, nil
+}
+
+// scopeRule compiles a pattern into a regular expression over the whole URL
+func scopeRule(pattern string) (*regexp.Regexp, error) {
+	switch {
+	case strings.HasPrefix(pattern, "re:"):
+		return regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+	case strings.Contains(pattern, "://"):
+		return regexp.Compile("^" + globRegexp(pattern, ".*") + "$")
+	case strings.HasPrefix(pattern, "/"):
+		return regexp.Compile(`^[a-zA-Z]+://[^/?#]*` + globRegexp(pattern, ".*") + `([?#]|$)`)
+	default:
+		// host names are case-insensitive, userinfo and port are skipped
+		return regexp.Compile(`^[a-zA-Z]+://([^/?#@]*@)?(?i:` + globRegexp(pattern, `[^/?#:@]*`) + `)(:[0-9]+)?([/?#]|$)`)
+	}
+}
+
+// globRegexp quotes glob for a regular expression with each * replaced by star
+func globRegexp(glob, star string) string {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return strings.Join(parts, star)
+}
+
+// allows reports whether link is in scope, everything is without a scope file
+func (s *scope) allows(link string) bool {
+	if s == nil {
+		return true
+	}
+	for _, rule := range s.exclude {
+		if rule.MatchString(link) {
+			return false
+		}
+	}
+	if len(s.include) == 0 {
+		return true
+	}
+	for _, rule := range s.include {
+		if rule.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply hands the rules to c, so colly refuses every request out of scope,
+// probes and redirects included
+func (s *scope) apply(c *colly.Collector) {
+	if s == nil {
+		return
+	}
+	if len(s.include) > 0 {
+		c.AllowedDomains = nil
+		c.URLFilters = s.include
+	}
+	c.DisallowedURLFilters = s.exclude
+}
@@ -0,0 +1,201 @@
+package reflector
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// the viewport probed pages are shot in, the same for both shots so they line up
+const (
+	shotWidth  = 1280
+	shotHeight = 900
+	// pixels around a canary's box that still count as its region, for
+	// antialiasing and underlines
+	shotMargin = 2
+	// how far apart two pixels' channels may be and still count as the same
+	shotTolerance = 24 << 8
+	// the share of a region's pixels that must differ for it to count as changed
+	shotChanged = 0.02
+)
+
+// findCanaryScript scrolls the first of the hashes it is given that shows
+// on the page into view, in text or in a form field, and returns it with
+// its box in viewport pixels. Hashes in hidden elements have no box
+const findCanaryScript = `(function(hashes) {
+	function shown(el, range, hash) {
+		el.scrollIntoView({block: "center"});
+		var r = (range || el).getBoundingClientRect();
+		if (r.width > 0 && r.height > 0) {
+			return {hash: hash, x: r.left, y: r.top, width: r.width, height: r.height, scroll: window.scrollY};
+		}
+		return null;
+	}
+	for (var h = 0; h < hashes.length; h++) {
+		var hash = hashes[h];
+		var walker = document.createTreeWalker(document.body, NodeFilter.SHOW_TEXT);
+		for (var node = walker.nextNode(); node; node = walker.nextNode()) {
+			var i = node.data.indexOf(hash);
+			if (i < 0 || !node.parentElement) {
+				continue;
+			}
+			var range = document.createRange();
+			range.setStart(node, i);
+			range.setEnd(node, i + hash.length);
+			var found = shown(node.parentElement, range, hash);
+			if (found) {
+				return found;
+			}
+		}
+		var fields = document.querySelectorAll("input, textarea");
+		for (var j = 0; j < fields.length; j++) {
+			if (fields[j].type !== "hidden" && String(fields[j].value).indexOf(hash) >= 0) {
+				var found = shown(fields[j], null, hash);
+				if (found) {
+					return found;
+				}
+			}
+		}
+	}
+	return {hash: ""};
+})(%s)`
+
+// shotRegion is a box on a screenshot, in pixels
+type shotRegion struct {
+	Hash   string  `json:"hash"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Scroll float64 `json:"scroll"`
+}
+
+func (r shotRegion) String() string {
+	return fmt.Sprintf("%.0f,%.0f,%.0fx%.0f", r.X, r.Y+r.Scroll, r.Width, r.Height)
+}
+
+// shootPage sends a probe of f in a fixed size viewport, in the crawl's
+// session, and screenshots the page it leads to. With hashes, the first
+// one that shows is scrolled into view and its region returned, along with
+// the DOM. Without, the page is scrolled to scroll
+func (b *browser) shootPage(f Form, inj injection, session browserSession, hashes []string, scroll float64) (image.Image, shotRegion, []byte, error) {
+	var region shotRegion
+	d, err := b.openDevtools()
+	if err != nil {
+		return nil, region, nil, err
+	}
+	defer d.close()
+	metrics := map[string]interface{}{"width": shotWidth, "height": shotHeight, "deviceScaleFactor": 1, "mobile": false}
+	if err := d.call("Emulation.setDeviceMetricsOverride", metrics, nil); err != nil {
+		return nil, region, nil, err
+	}
+	if err := d.useSession(f.URL, session); err != nil {
+		return nil, region, nil, err
+	}
+	if err := d.load(f, inj, renderSettle); err != nil {
+		return nil, region, nil, err
+	}
+
+	var dom string
+	if len(hashes) > 0 {
+		list, err := json.Marshal(hashes)
+		if err != nil {
+			return nil, region, nil, err
+		}
+		if err := d.evaluate(fmt.Sprintf(findCanaryScript, list), &region); err != nil {
+			return nil, region, nil, err
+		}
+		if err := d.evaluate("document.documentElement.outerHTML", &dom); err != nil {
+			return nil, region, nil, err
+		}
+	} else {
+		var ignored interface{}
+		if err := d.evaluate(fmt.Sprintf("window.scrollTo(0, %f)", scroll), &ignored); err != nil {
+			return nil, region, nil, err
+		}
+	}
+
+	var shot struct {
+		Data string `json:"data"`
+	}
+	if err := d.call("Page.captureScreenshot", map[string]string{"format": "png"}, &shot); err != nil {
+		return nil, region, nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(shot.Data)
+	if err != nil {
+		return nil, region, nil, err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, region, nil, err
+	}
+	return img, region, []byte(dom), nil
+}
+
+// visualReflection shoots the page a probe leads to twice, once as sent
+// and once with its hashes swapped for filler of the same length, and
+// reports the region of a hash that shows on the page and looks different
+// between the two, with the rendered DOM. It catches values that only
+// client-side rendering puts on the page
+func visualReflection(b *browser, f Form, inj injection, session browserSession) (shotRegion, []byte, bool) {
+	var hashes []string
+	before := injection{FormLocation: inj.FormLocation, Params: inj.Params, Hashes: make([]string, len(inj.Hashes))}
+	for i, hash := range inj.Hashes {
+		if hash == "" {
+			continue
+		}
+		hashes = append(hashes, canaryID(hash))
+		before.Hashes[i] = strings.Repeat("x", len(hash))
+	}
+	if len(hashes) == 0 {
+		return shotRegion{}, nil, false
+	}
+
+	after, region, dom, err := b.shootPage(f, inj, session, hashes, 0)
+	if err != nil || region.Hash == "" {
+		return region, nil, false
+	}
+	beforeShot, _, _, err := b.shootPage(f, before, session, nil, region.Scroll)
+	if err != nil {
+		return region, nil, false
+	}
+	return region, dom, regionChanged(beforeShot, after, region)
+}
+
+// regionChanged reports whether enough pixels in region differ between two screenshots
+func regionChanged(before, after image.Image, region shotRegion) bool {
+	box := image.Rect(int(region.X)-shotMargin, int(region.Y)-shotMargin,
+		int(region.X+region.Width)+shotMargin, int(region.Y+region.Height)+shotMargin)
+	box = box.Intersect(before.Bounds()).Intersect(after.Bounds())
+	if box.Empty() {
+		return false
+	}
+	changed := 0
+	for y := box.Min.Y; y < box.Max.Y; y++ {
+		for x := box.Min.X; x < box.Max.X; x++ {
+			if !samePixel(before.At(x, y), after.At(x, y)) {
+				changed++
+			}
+		}
+	}
+	return float64(changed) >= shotChanged*float64(box.Dx()*box.Dy())
+}
+
+// samePixel reports whether two colors are within shotTolerance in every channel
+func samePixel(a, b color.Color) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	return within(ar, br) && within(ag, bg) && within(ab, bb) && within(aa, ba)
+}
+
+func within(a, b uint32) bool {
+	if a > b {
+		return a-b <= shotTolerance
+	}
+	return b-a <= shotTolerance
+}
@@ -0,0 +1,48 @@
+package reflector
+
+import (
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// revisits lists the pages a crawl saw in the order it saw them, to be
+// requested again once every probe has been sent
+type revisits struct {
+	mu    sync.Mutex
+	seen  map[string]bool
+	pages []string
+}
+
+func newRevisits() *revisits {
+	return &revisits{seen: make(map[string]bool)}
+}
+
+func (v *revisits) add(page string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if !v.seen[page] {
+		v.seen[page] = true
+		v.pages = append(v.pages, page)
+	}
+}
+
+func (v *revisits) list() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]string(nil), v.pages...)
+}
+
+// sendRevisit requests page again for the second pass. It goes out as a
+// probe of its own, so it is paced like one and not crawled any further
+func sendRevisit(c *colly.Collector, page string) {
+	ctx := colly.NewContext()
+	ctx.Put("probe", page)
+	ctx.Put("revisit", page)
+	c.Request("GET", page, nil, ctx, nil)
+}
+
+// isRevisit reports whether a request was sent by sendRevisit
+func isRevisit(r *colly.Request) bool {
+	return r.Ctx.Get("revisit") != ""
+}
@@ -0,0 +1,261 @@
+package reflector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// links that would end the session if the crawl followed them
+var logoutRegex = regexp.MustCompile(`(?i)(log|sign)[-_]?(out|off)`)
+
+// login data fields whose values are secrets
+var loginSecretRegex = regexp.MustCompile(`(?i)(pass|secret|token|pin|otp)`)
+
+// session logs in with Options.LoginURL and LoginData before crawling and
+// again whenever a response shows the session ended. The cookies it gets
+// go in a jar shared by the collector and every probe client
+type session struct {
+	loginURL *url.URL
+	data     url.Values
+	jar      http.CookieJar
+
+	mu sync.Mutex
+	// logins so far, requests sent before the latest one are replayed as they are
+	generation int
+	// pages still logged out right after logging in, which answer 401
+	// whoever asks and mustn't have the crawl log in over and over
+	denied map[string]bool
+}
+
+// newSession parses the login data, a query string whose values may use
+// {{env:NAME}} and {{cmd:command}} placeholders
+func newSession(loginURL, loginData string) (*session, error) {
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%q is not an http:// or https:// URL", loginURL)
+	}
+	data, err := url.ParseQuery(loginData)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range data {
+		for i := range values {
+			if values[i], err = resolvePlaceholders(values[i]); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &session{loginURL: u, data: data, jar: jar, denied: make(map[string]bool)}, nil
+}
+
+// secrets returns the values of login data fields that look like passwords or tokens
+func (s *session) secrets() []string {
+	var secrets []string
+	for name, values := range s.data {
+		if loginSecretRegex.MatchString(name) {
+			secrets = append(secrets, values...)
+		}
+	}
+	return secrets
+}
+
+// start logs in unless an earlier target already did
+func (s *session) start(p *prober) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation > 0 {
+		return nil
+	}
+	return s.login(p)
+}
+
+// login fetches the login page and submits its login form, hidden inputs
+// such as CSRF tokens included, with the login data filled in. A login page
+// without a form gets the login data posted to it as is
+func (s *session) login(p *prober) error {
+	method, action, values := "POST", s.loginURL.String(), url.Values{}
+	resp, body, err := p.do("GET", s.loginURL.String(), nil, nil)
+	if err != nil {
+		return err
+	}
+	if doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body)); err == nil {
+		if form := loginForm(doc); form != nil {
+			method, action, values = formDefaults(form, resp.Request.URL)
+		}
+	}
+	for name, value := range s.data {
+		values[name] = value
+	}
+
+	if method == "GET" {
+		u, err := url.Parse(action)
+		if err != nil {
+			return err
+		}
+		u.RawQuery = values.Encode()
+		resp, _, err = p.do("GET", u.String(), nil, nil)
+	} else {
+		resp, _, err = p.do("POST", action, strings.NewReader(values.Encode()), nil)
+	}
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s answered %s", action, resp.Status)
+	}
+	if len(s.jar.Cookies(resp.Request.URL)) == 0 {
+		return errors.New("no session cookie was set")
+	}
+	s.generation++
+	return nil
+}
+
+// loginForm picks the form with a password input, or the only form on the page
+func loginForm(doc *goquery.Document) *goquery.Selection {
+	forms := doc.Find("form")
+	if form := forms.Has("input[type=password], input[type=PASSWORD]").First(); form.Length() > 0 {
+		return form
+	}
+	if forms.Length() == 1 {
+		return forms
+	}
+	return nil
+}
+
+// current returns the number of logins so far
+func (s *session) current() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.generation
+}
+
+// refresh logs in again after a request sent with the session of generation
+// found it ended, unless another request already did. It reports whether
+// there is a newer session to replay the request with
+func (s *session) refresh(p *prober, generation int, page string, log io.Writer) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.denied[page] {
+		return false
+	}
+	if s.generation > generation {
+		return true
+	}
+	if err := s.login(p); err != nil {
+		fmt.Fprintln(log, "Error logging in again:", err)
+		return false
+	}
+	fmt.Fprintln(log, "Logged in again at", s.loginURL, "after the session ended on", page)
+	return true
+}
+
+// deny records a page that a fresh session didn't get into
+func (s *session) deny(page string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.denied[page] = true
+}
+
+// loggedOut reports whether resp shows the session has ended: a 401, or a
+// redirect to the login page from anywhere else
+func (s *session) loggedOut(req *http.Request, resp *http.Response) bool {
+	if req.URL.Host == s.loginURL.Host && req.URL.Path == s.loginURL.Path {
+		return false
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return false
+	}
+	location, err := req.URL.Parse(resp.Header.Get("Location"))
+	return err == nil && location.Host == s.loginURL.Host && location.Path == s.loginURL.Path
+}
+
+// avoids reports whether link is one the crawl shouldn't follow while logged in
+func (s *session) avoids(link string) bool {
+	if s == nil {
+		return false
+	}
+	u, err := url.Parse(link)
+	return err == nil && logoutRegex.MatchString(u.Path+"?"+u.RawQuery)
+}
+
+// wrap returns a transport that logs in again with p when a response shows
+// the session ended, and replays the request once with the new cookies
+func (s *session) wrap(base http.RoundTripper, p *prober, log io.Writer) http.RoundTripper {
+	return &sessionTransport{base: base, session: s, login: p, log: log}
+}
+
+type sessionTransport struct {
+	base    http.RoundTripper
+	session *session
+	login   *prober
+	log     io.Writer
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	generation := t.session.current()
+	resp, err := t.base.RoundTrip(req)
+	// a body that can't be read again can't be replayed
+	if err != nil || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) || !t.session.loggedOut(req, resp) {
+		return resp, err
+	}
+	if !t.session.refresh(t.login, generation, req.URL.String(), t.log) {
+		return resp, nil
+	}
+
+	replay := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		replay.Body = body
+	}
+	withJarCookies(replay, t.session.jar)
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	resp, err = t.base.RoundTrip(replay)
+	if err == nil && t.session.loggedOut(replay, resp) {
+		t.session.deny(req.URL.String())
+	}
+	return resp, err
+}
+
+// withJarCookies replaces the cookies req was sent with by the ones the jar now holds
+func withJarCookies(req *http.Request, jar http.CookieJar) {
+	fresh := jar.Cookies(req.URL)
+	names := make(map[string]bool)
+	for _, cookie := range fresh {
+		names[cookie.Name] = true
+	}
+	sent := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, cookie := range sent {
+		if !names[cookie.Name] {
+			req.AddCookie(cookie)
+		}
+	}
+	for _, cookie := range fresh {
+		req.AddCookie(cookie)
+	}
+}
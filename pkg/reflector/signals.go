@@ -0,0 +1,152 @@
+package reflector
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// how far a flagged link jumps ahead of the others in the priority frontier
+const signalBoost = 100
+
+// signals are the endpoints other scanners already flagged, imported from
+// their output so the crawl and its probes go there first
+type signals struct {
+	// labels by endpoint, e.g. www.example.com/search: xss-reflected, imported
+	endpoints map[string]map[string]bool
+	// the flagged URLs, crawled as seeds of the targets on their host
+	urls []string
+}
+
+// scannerFinding is what is read of a line of nuclei's JSON output
+type scannerFinding struct {
+	TemplateID string `json:"template-id"`
+	MatchedAt  string `json:"matched-at"`
+	URL        string `json:"url"`
+	Host       string `json:"host"`
+}
+
+// loadSignals reads other scanners' results: nuclei's -jsonl output, its
+// -json-export array, or plain URLs, one per line. Nuclei findings are
+// labeled with their template, plain URLs as imported
+func loadSignals(path string) (*signals, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &signals{endpoints: make(map[string]map[string]bool)}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		var findings []scannerFinding
+		if err := json.Unmarshal(data, &findings); err != nil {
+			return nil, err
+		}
+		for _, finding := range findings {
+			s.addFinding(finding)
+		}
+		return s, nil
+	}
+	lines := bufio.NewScanner(bytes.NewReader(data))
+	lines.Buffer(make([]byte, 64<<10), 4<<20)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "{"):
+			var finding scannerFinding
+			if err := json.Unmarshal([]byte(line), &finding); err != nil {
+				return nil, err
+			}
+			s.addFinding(finding)
+		default:
+			s.add(line, "imported")
+		}
+	}
+	return s, lines.Err()
+}
+
+func (s *signals) addFinding(finding scannerFinding) {
+	link := finding.MatchedAt
+	if link == "" {
+		link = finding.URL
+	}
+	if link == "" {
+		link = finding.Host
+	}
+	label := finding.TemplateID
+	if label == "" {
+		label = "imported"
+	}
+	s.add(link, label)
+}
+
+// add flags an http or https URL, others, like the host:port of network
+// templates, say nothing about an endpoint
+func (s *signals) add(link, label string) {
+	key := signalKey(link)
+	if key == "" {
+		return
+	}
+	if s.endpoints[key] == nil {
+		s.endpoints[key] = make(map[string]bool)
+		s.urls = append(s.urls, link)
+	}
+	s.endpoints[key][label] = true
+}
+
+// signalKey is the endpoint of a URL: its host and path, whatever the
+// scheme, query or trailing slash
+func signalKey(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.EscapedPath(), "/")
+}
+
+// labels returns the labels link's endpoint was flagged with, sorted
+func (s *signals) labels(link string) []string {
+	if s == nil {
+		return nil
+	}
+	flagged := s.endpoints[signalKey(link)]
+	if len(flagged) == 0 {
+		return nil
+	}
+	labels := make([]string, 0, len(flagged))
+	for label := range flagged {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// boost is how much ahead of the others link goes in the frontier
+func (s *signals) boost(link string) int {
+	if len(s.labels(link)) > 0 {
+		return signalBoost
+	}
+	return 0
+}
+
+// seeds returns the flagged URLs on target's host
+func (s *signals) seeds(target string) []string {
+	if s == nil {
+		return nil
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil
+	}
+	var seeds []string
+	for _, link := range s.urls {
+		if flagged, err := url.Parse(link); err == nil && strings.EqualFold(flagged.Host, u.Host) {
+			seeds = append(seeds, link)
+		}
+	}
+	return seeds
+}
@@ -0,0 +1,166 @@
+package reflector
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// limits on what robots.txt and sitemaps may add to a crawl, sitemap
+// indexes of big sites list hundreds of files of 50,000 URLs each
+const (
+	maxSitemaps     = 20
+	maxSitemapURLs  = 5000
+	maxSitemapBytes = 50 << 20
+	defaultSitemap  = "/sitemap.xml"
+	robotsTxtPath   = "/robots.txt"
+)
+
+// discoveredLink is a URL found in robots.txt or a sitemap rather than on a page
+type discoveredLink struct {
+	url    string
+	source string
+}
+
+// sitemapDoc is a sitemap or a sitemap index, both list their entries in <loc>
+type sitemapDoc struct {
+	XMLName  xml.Name
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// discoverLinks returns the paths robots.txt mentions and the URLs listed in
+// the target's sitemaps, found through robots.txt or at /sitemap.xml.
+// Disallowed paths are only included as hints when respectRobots is off
+func discoverLinks(client *http.Client, target string, respectRobots bool) []discoveredLink {
+	base, err := url.Parse(target)
+	if err != nil || base.Host == "" {
+		return nil
+	}
+	root := base.Scheme + "://" + base.Host
+
+	var links []discoveredLink
+	seen := make(map[string]bool)
+	add := func(link, source string) {
+		if !seen[link] && len(links) < maxSitemapURLs {
+			seen[link] = true
+			links = append(links, discoveredLink{url: link, source: source})
+		}
+	}
+
+	paths, sitemaps := fetchRobotsTxt(client, root, respectRobots)
+	for _, p := range paths {
+		if ref, err := url.Parse(p); err == nil {
+			add(base.ResolveReference(ref).String(), "robots")
+		}
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{root + defaultSitemap}
+	}
+
+	// sitemap indexes are followed breadth first, up to maxSitemaps files
+	fetched := make(map[string]bool)
+	for len(sitemaps) > 0 && len(fetched) < maxSitemaps {
+		next := sitemaps[0]
+		sitemaps = sitemaps[1:]
+		if fetched[next] {
+			continue
+		}
+		fetched[next] = true
+		doc, err := fetchSitemap(client, next)
+		if err != nil {
+			continue
+		}
+		for _, loc := range doc.URLs {
+			add(strings.TrimSpace(loc), "sitemap")
+		}
+		for _, loc := range doc.Sitemaps {
+			sitemaps = append(sitemaps, strings.TrimSpace(loc))
+		}
+	}
+	return links
+}
+
+// fetchRobotsTxt returns the Allow and Disallow paths of a host's robots.txt
+// usable as links, and the sitemaps it lists
+func fetchRobotsTxt(client *http.Client, root string, respectRobots bool) ([]string, []string) {
+	resp, err := client.Get(root + robotsTxtPath)
+	if err != nil {
+		return nil, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+
+	var paths, sitemaps []string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxSitemapBytes))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.ToLower(strings.TrimSpace(parts[0])) {
+		case "sitemap":
+			sitemaps = append(sitemaps, value)
+		case "disallow":
+			if respectRobots {
+				continue
+			}
+			fallthrough
+		case "allow":
+			// wildcards only match, the path up to the first one is still a real path
+			if i := strings.IndexAny(value, "*$"); i >= 0 {
+				value = value[:i]
+			}
+			if strings.HasPrefix(value, "/") && value != "/" {
+				paths = append(paths, value)
+			}
+		}
+	}
+	return paths, sitemaps
+}
+
+// fetchSitemap fetches and parses a sitemap or sitemap index, gzipped or not
+func fetchSitemap(client *http.Client, sitemap string) (*sitemapDoc, error) {
+	resp, err := client.Get(sitemap)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap %s: %s", sitemap, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSitemapBytes))
+	if err != nil {
+		return nil, err
+	}
+	// sitemap.xml.gz is often served without a gzip Content-Encoding
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		body, err = ioutil.ReadAll(io.LimitReader(gz, maxSitemapBytes))
+		if err != nil {
+			return nil, err
+		}
+	}
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
@@ -0,0 +1,129 @@
+package reflector
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// elementLink is a URL found in an element other than a[href], script[src]
+// and form[action], with the source it is reported as
+type elementLink struct {
+	source string
+	url    string
+	// pages, frames and redirects are crawled, images and styles only reported
+	follow bool
+}
+
+var (
+	cssURLRegex = regexp.MustCompile(`url\(\s*['"]?([^'")\s]+)['"]?\s*\)`)
+	// absolute, protocol relative or root relative, a data-* value like "/api/items" or "https://cdn.example.com/x"
+	dataURLRegex = regexp.MustCompile(`^((https?:)?//[^\s/]+|/[^\s/])[^\s<>"']*$`)
+)
+
+// elementLinks returns the links in a page's link, img, srcset, iframe,
+// frame, meta refresh, object, embed, area and style elements, inline
+// style url()s, and data-* attributes that look like URLs, each once per
+// source, as written in the page
+func elementLinks(doc *goquery.Selection) []elementLink {
+	var links []elementLink
+	seen := make(map[elementLink]bool)
+	add := func(source, link string, follow bool) {
+		link = strings.TrimSpace(link)
+		if link == "" || strings.HasPrefix(link, "#") || strings.HasPrefix(strings.ToLower(link), "data:") {
+			return
+		}
+		l := elementLink{source: source, url: link, follow: follow}
+		if !seen[l] {
+			seen[l] = true
+			links = append(links, l)
+		}
+	}
+
+	doc.Find("*").Each(func(_ int, s *goquery.Selection) {
+		node := s.Get(0)
+		attr := func(name string) string {
+			value, _ := s.Attr(name)
+			return value
+		}
+		switch node.Data {
+		case "link":
+			// alternates are reported as their own source
+			rel := " " + strings.ToLower(attr("rel")) + " "
+			if !strings.Contains(rel, " alternate ") && !strings.Contains(rel, " amphtml ") {
+				add("link", attr("href"), false)
+			}
+		case "img":
+			add("img", attr("src"), false)
+		case "iframe", "frame":
+			add("iframe", attr("src"), true)
+		case "meta":
+			if strings.EqualFold(attr("http-equiv"), "refresh") {
+				add("meta-refresh", refreshURL(attr("content")), true)
+			}
+		case "object":
+			add("object", attr("data"), false)
+		case "embed":
+			add("object", attr("src"), false)
+		case "area":
+			add("area", attr("href"), true)
+		case "style":
+			for _, m := range cssURLRegex.FindAllStringSubmatch(s.Text(), -1) {
+				add("style", m[1], false)
+			}
+		}
+		for _, a := range node.Attr {
+			switch {
+			case a.Key == "srcset":
+				for _, candidate := range srcsetURLs(a.Val) {
+					add("srcset", candidate, false)
+				}
+			case a.Key == "style":
+				for _, m := range cssURLRegex.FindAllStringSubmatch(a.Val, -1) {
+					add("style", m[1], false)
+				}
+			case strings.HasPrefix(a.Key, "data-") && dataURLRegex.MatchString(a.Val):
+				add("data-attr", a.Val, true)
+			}
+		}
+	})
+	return links
+}
+
+// refreshURL returns the URL of a meta refresh's content, e.g. "5; url=/next"
+func refreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		i = strings.Index(content, ",")
+	}
+	if i < 0 {
+		return ""
+	}
+	link := strings.TrimSpace(content[i+1:])
+	if len(link) >= 4 && strings.EqualFold(link[:3], "url") {
+		if rest := strings.TrimSpace(link[3:]); strings.HasPrefix(rest, "=") {
+			link = strings.TrimSpace(rest[1:])
+		}
+	}
+	return strings.Trim(link, `'"`)
+}
+
+// srcsetURLs returns the URLs of a srcset's candidates, e.g.
+// "a.png 1x, b.png 2x" gives a.png and b.png
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// httpURL reports whether link is an absolute http or https URL
+func httpURL(link string) bool {
+	u, err := url.Parse(link)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
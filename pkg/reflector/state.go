@@ -0,0 +1,284 @@
+package reflector
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// how often an in-progress crawl is checkpointed to the state file
+const checkpointInterval = 30 * time.Second
+
+// stateFile is the JSON written to the state file
+type stateFile struct {
+	Targets map[string]*targetFile `json:"targets"`
+	// every hash sent so far, so stored reflections of them are still found after a resume
+	Injections []injection `json:"injections"`
+}
+
+type targetFile struct {
+	Done    bool          `json:"done"`
+	Visited []string      `json:"visited"`
+	Pending []pendingFile `json:"pending"`
+	Forms   []Form        `json:"forms"`
+}
+
+type pendingFile struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+// crawlState tracks the progress of every target for the state file,
+// or for the store when there is no state file
+type crawlState struct {
+	path  string
+	store Store
+
+	mu      sync.Mutex
+	targets map[string]*targetProgress
+}
+
+// targetProgress is how far one target's crawl has got
+type targetProgress struct {
+	done    bool
+	visited map[string]bool
+	pending map[string]int
+	forms   map[string]Form
+	// pages fetched and forms probed by the interrupted run, not done again
+	previous      map[string]bool
+	previousForms map[string]bool
+}
+
+func newTargetProgress() *targetProgress {
+	return &targetProgress{
+		visited:       make(map[string]bool),
+		pending:       make(map[string]int),
+		forms:         make(map[string]Form),
+		previous:      make(map[string]bool),
+		previousForms: make(map[string]bool),
+	}
+}
+
+// loadState reads a state file to resume from, returning the injections it recorded
+func loadState(path string) (*crawlState, []injection, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return parseState(&crawlState{path: path}, data)
+}
+
+// loadStoreState reads the crawl state kept in a store to resume from,
+// a store without one starts afresh
+func loadStoreState(store Store) (*crawlState, []injection, error) {
+	data, err := store.LoadFrontier()
+	if err != nil {
+		return nil, nil, err
+	}
+	if data == nil {
+		return &crawlState{store: store, targets: make(map[string]*targetProgress)}, nil, nil
+	}
+	return parseState(&crawlState{store: store}, data)
+}
+
+// parseState fills s from the JSON of a state file
+func parseState(s *crawlState, data []byte) (*crawlState, []injection, error) {
+	var file stateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, nil, err
+	}
+	s.targets = make(map[string]*targetProgress)
+	for target, t := range file.Targets {
+		p := newTargetProgress()
+		p.done = t.Done
+		for _, u := range t.Visited {
+			p.visited[u] = true
+			p.previous[u] = true
+		}
+		for _, link := range t.Pending {
+			p.pending[link.URL] = link.Depth
+		}
+		for _, f := range t.Forms {
+			p.forms[formKey(f)] = f
+			p.previousForms[formKey(f)] = true
+		}
+		s.targets[target] = p
+	}
+	return s, file.Injections, nil
+}
+
+// target returns the progress of a target, starting it if it is new
+func (s *crawlState) target(target string) *targetProgress {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.targets[target]
+	if !ok {
+		p = newTargetProgress()
+		s.targets[target] = p
+	}
+	return p
+}
+
+// pendingLinks returns the links a target's crawl hadn't fetched yet, with their depth
+func (s *crawlState) pendingLinks(p *targetProgress) map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := make(map[string]int, len(p.pending))
+	for link, depth := range p.pending {
+		pending[link] = depth
+	}
+	return pending
+}
+
+// finished reports whether a target's crawl already completed
+func (s *crawlState) finished(p *targetProgress) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return p.done
+}
+
+// queued records a link waiting to be crawled
+func (s *crawlState) queued(p *targetProgress, link string, depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d, ok := p.pending[link]; !ok || depth < d {
+		p.pending[link] = depth
+	}
+}
+
+// requested records a page the crawl has started fetching
+func (s *crawlState) requested(p *targetProgress, link string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(p.pending, link)
+	p.visited[link] = true
+}
+
+// dropped puts a page the crawl never got to send back in the pending
+// links, so a resumed crawl still fetches it
+func (s *crawlState) dropped(p *targetProgress, link string, depth int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(p.visited, link)
+	p.pending[link] = depth
+}
+
+// seen reports whether the interrupted run already fetched a page
+func (s *crawlState) seen(p *targetProgress, link string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return p.previous[link]
+}
+
+// submitted records a form as probed, reporting whether the interrupted run already probed it
+func (s *crawlState) submitted(p *targetProgress, f Form) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := formKey(f)
+	p.forms[key] = f
+	return p.previousForms[key]
+}
+
+// unsubmitted forgets a form whose probe was never sent, so a resumed crawl probes it
+func (s *crawlState) unsubmitted(p *targetProgress, f Form) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(p.forms, formKey(f))
+}
+
+// finish marks a target's crawl as complete
+func (s *crawlState) finish(p *targetProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p.done = true
+	p.pending = make(map[string]int)
+}
+
+// save writes the state file, through a temporary file so an interruption
+// mid-write never leaves it truncated, or hands the state to the store
+func (s *crawlState) save(injections []injection) error {
+	s.mu.Lock()
+	file := stateFile{Targets: make(map[string]*targetFile), Injections: injections}
+	for target, p := range s.targets {
+		t := &targetFile{Done: p.done}
+		for u := range p.visited {
+			t.Visited = append(t.Visited, u)
+		}
+		sort.Strings(t.Visited)
+		for link, depth := range p.pending {
+			t.Pending = append(t.Pending, pendingFile{URL: link, Depth: depth})
+		}
+		sort.Slice(t.Pending, func(i, j int) bool { return t.Pending[i].URL < t.Pending[j].URL })
+		for _, f := range p.forms {
+			t.Forms = append(t.Forms, f)
+		}
+		sort.Slice(t.Forms, func(i, j int) bool { return formKey(t.Forms[i]) < formKey(t.Forms[j]) })
+		file.Targets[target] = t
+	}
+	data, err := json.Marshal(file)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if s.store != nil {
+		return s.store.SaveFrontier(data)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// crawlable reports whether colly would fetch link, so links it filters
+// out don't sit in the pending queue forever
+func crawlable(c *colly.Collector, link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	for _, filter := range c.DisallowedURLFilters {
+		if filter.MatchString(link) {
+			return false
+		}
+	}
+	if len(c.URLFilters) > 0 {
+		for _, filter := range c.URLFilters {
+			if filter.MatchString(link) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(c.AllowedDomains) == 0 {
+		return true
+	}
+	return containsString(c.AllowedDomains, u.Hostname())
+}
+
+// formKey identifies a form by where and how it submits and its field names
+func formKey(f Form) string {
+	names := make([]string, len(f.Inputs))
+	for i, in := range f.Inputs {
+		names[i] = in.Name
+	}
+	return f.Method + " " + f.URL + " " + strings.Join(names, "&")
+}
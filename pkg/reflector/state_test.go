@@ -0,0 +1,131 @@
+package reflector
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStateSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	search := Form{
+		URL:     "https://example.com/search",
+		Method:  "GET",
+		Inputs:  []Input{{Type: "text", Name: "q"}, {Type: "hidden", Name: "csrf", Value: "t0k3n"}},
+		Headers: http.Header{"Referer": {"https://example.com/"}},
+		Page:    "https://example.com/",
+	}
+	tests := []struct {
+		name string
+		// fills in the state before it is saved
+		crawl      func(s *crawlState)
+		injections []injection
+		target     string
+		done       bool
+		pending    map[string]int
+		visited    []string
+		forms      []Form
+	}{
+		{
+			name:    "nothing crawled",
+			crawl:   func(s *crawlState) { s.target("https://example.com") },
+			target:  "https://example.com",
+			pending: map[string]int{},
+		},
+		{
+			name: "mid crawl",
+			crawl: func(s *crawlState) {
+				p := s.target("https://example.com")
+				s.queued(p, "https://example.com/", 0)
+				s.queued(p, "https://example.com/a", 2)
+				s.queued(p, "https://example.com/a", 1)
+				s.queued(p, "https://example.com/b", 1)
+				s.requested(p, "https://example.com/")
+				s.requested(p, "https://example.com/b")
+				s.dropped(p, "https://example.com/b", 1)
+				s.submitted(p, search)
+			},
+			injections: []injection{{FormLocation: "https://example.com/search", Page: "https://example.com/", Params: []string{"q", "csrf"}, Hashes: []string{"rflk8f2a9x0m3p_q", ""}}},
+			target:     "https://example.com",
+			pending:    map[string]int{"https://example.com/a": 1, "https://example.com/b": 1},
+			visited:    []string{"https://example.com/"},
+			forms:      []Form{search},
+		},
+		{
+			name: "finished",
+			crawl: func(s *crawlState) {
+				p := s.target("https://example.com")
+				s.queued(p, "https://example.com/a", 1)
+				s.requested(p, "https://example.com/")
+				s.finish(p)
+			},
+			target:  "https://example.com",
+			done:    true,
+			pending: map[string]int{},
+			visited: []string{"https://example.com/"},
+		},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, "state.json")
+		s := &crawlState{path: path, targets: make(map[string]*targetProgress)}
+		test.crawl(s)
+		if err := s.save(test.injections); err != nil {
+			t.Fatalf("%s: save: %v", test.name, err)
+		}
+
+		loaded, injections, err := loadState(path)
+		if err != nil {
+			t.Fatalf("%s: load: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(injections, test.injections) {
+			t.Errorf("%s: injections %v, want %v", test.name, injections, test.injections)
+		}
+		p := loaded.target(test.target)
+		if loaded.finished(p) != test.done {
+			t.Errorf("%s: done is %v, want %v", test.name, loaded.finished(p), test.done)
+		}
+		if pending := loaded.pendingLinks(p); !reflect.DeepEqual(pending, test.pending) {
+			t.Errorf("%s: pending %v, want %v", test.name, pending, test.pending)
+		}
+		if len(p.visited) != len(test.visited) {
+			t.Errorf("%s: %d pages visited, want %d", test.name, len(p.visited), len(test.visited))
+		}
+		for _, link := range test.visited {
+			if !loaded.seen(p, link) {
+				t.Errorf("%s: %s not seen after the resume", test.name, link)
+			}
+		}
+		for _, f := range test.forms {
+			if !loaded.submitted(p, f) {
+				t.Errorf("%s: form %s not probed after the resume", test.name, formKey(f))
+			}
+			if got := p.forms[formKey(f)]; !reflect.DeepEqual(got, f) {
+				t.Errorf("%s: form %+v, want %+v", test.name, got, f)
+			}
+		}
+	}
+}
+
+func TestParseStateErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{name: "empty", data: ""},
+		{name: "truncated", data: `{"targets":{"https://example.com":{"done":fal`},
+		{name: "wrong type", data: `{"targets":[]}`},
+	}
+	for _, test := range tests {
+		if _, _, err := parseState(&crawlState{}, []byte(test.data)); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package reflector
+
+import (
+	"crypto/sha256"
+	"sync"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+)
+
+// Store keeps what outlives a run: the findings written, the keys seen by
+// deduplication and the crawl state resumed from, so resuming, -u and
+// -diff all work the same whichever backend holds them. Implementations
+// must be safe for concurrent use
+type Store interface {
+	// SaveFindings adds findings to the ones kept
+	SaveFindings(findings []schema.Result) error
+	// LoadFindings returns every finding kept, oldest first
+	LoadFindings() ([]schema.Result, error)
+	// Seen marks key as seen and reports whether it already was
+	Seen(key string) (bool, error)
+	// SaveFrontier replaces the crawl state kept, in the format of a state file
+	SaveFrontier(state []byte) error
+	// LoadFrontier returns the crawl state kept, nil if there is none
+	LoadFrontier() ([]byte, error)
+	Close() error
+}
+
+// DefaultSeenKeys is how many keys a memory store remembers as seen
+const DefaultSeenKeys = 2000000
+
+// memoryStore is a Store that keeps everything for the run only
+type memoryStore struct {
+	mu       sync.Mutex
+	findings []schema.Result
+	seen     *seenKeys
+	frontier []byte
+}
+
+// NewMemoryStore returns a Store that forgets everything when the run
+// ends, remembering up to DefaultSeenKeys keys as seen
+func NewMemoryStore() Store {
+	return NewBoundedMemoryStore(DefaultSeenKeys)
+}
+
+// NewBoundedMemoryStore returns a memory Store that remembers about keys
+// keys as seen, forgetting the ones seen least recently first, so -u on a
+// crawl of millions of URLs doesn't grow without bound
+func NewBoundedMemoryStore(keys int) Store {
+	return &memoryStore{seen: newSeenKeys(keys)}
+}
+
+// seenKeys remembers keys in two generations of up to size/2 each, by a
+// hash of 16 bytes rather than the key itself. A key seen again moves to
+// the current generation, and once that is full the older one is dropped,
+// so memory stays bounded and the keys seen least recently go first, like
+// an LRU without its per-key bookkeeping
+type seenKeys struct {
+	size     int
+	current  map[[16]byte]struct{}
+	previous map[[16]byte]struct{}
+}
+
+func newSeenKeys(size int) *seenKeys {
+	if size < 2 {
+		size = 2
+	}
+	return &seenKeys{size: size, current: make(map[[16]byte]struct{}), previous: make(map[[16]byte]struct{})}
+}
+
+// seen marks key as seen and reports whether it already was
+func (s *seenKeys) seen(key string) bool {
+	sum := sha256.Sum256([]byte(key))
+	var h [16]byte
+	copy(h[:], sum[:16])
+	if _, ok := s.current[h]; ok {
+		return true
+	}
+	_, ok := s.previous[h]
+	if len(s.current) >= s.size/2 {
+		s.previous, s.current = s.current, make(map[[16]byte]struct{})
+	}
+	s.current[h] = struct{}{}
+	return ok
+}
+
+func (s *memoryStore) SaveFindings(findings []schema.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.findings = append(s.findings, findings...)
+	return nil
+}
+
+func (s *memoryStore) LoadFindings() ([]schema.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]schema.Result(nil), s.findings...), nil
+}
+
+func (s *memoryStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seen.seen(key), nil
+}
+
+func (s *memoryStore) SaveFrontier(state []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.frontier = append([]byte(nil), state...)
+	return nil
+}
+
+func (s *memoryStore) LoadFrontier() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.frontier, nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+)
+
+// targetStats counts what one target's crawl found, for the end of run table
+type targetStats struct {
+	Target   string
+	start    time.Time
+	duration time.Duration
+	// the crawl ran out of its share of Options.MaxRuntime or of Options.MaxTime
+	cut bool
+	// the crawl reached Options.MaxURLs pages
+	full bool
+
+	urls  int64
+	forms int64
+	// responses -max-body-size or -content-types left undownloaded
+	skipped int64
+	errors  int64
+
+	mu          sync.Mutex
+	reflections map[string]int
+	// the other sites its pages load scripts, styles and frames from
+	deps *thirdParty
+	// its reflections by path
+	heat *heatMap
+}
+
+func newTargetStats(target string) *targetStats {
+	return &targetStats{
+		Target:      target,
+		start:       time.Now(),
+		reflections: make(map[string]int),
+		deps:        newThirdParty(target),
+		heat:        newHeatMap(),
+	}
+}
+
+func (t *targetStats) page() { atomic.AddInt64(&t.urls, 1) }
+func (t *targetStats) form() { atomic.AddInt64(&t.forms, 1) }
+func (t *targetStats) skip() { atomic.AddInt64(&t.skipped, 1) }
+func (t *targetStats) fail() { atomic.AddInt64(&t.errors, 1) }
+
+// reflection counts a finding of params on link by its confidence and path
+func (t *targetStats) reflection(confidence, link string, params []string) {
+	t.mu.Lock()
+	t.reflections[confidence]++
+	t.mu.Unlock()
+	t.heat.record(link, params)
+}
+
+// finish stops the clock once the target's crawl is done, cut says
+// whether it ran out of time and full whether it ran out of pages
+func (t *targetStats) finish(cut, full bool) {
+	t.duration = time.Since(t.start)
+	t.cut = cut
+	t.full = full
+}
+
+// printSummaryTable writes an aligned overview of every target crawled
+func printSummaryTable(w io.Writer, stats []*targetStats) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TARGET\tURLS\tSKIPPED\tFORMS\tVERIFIED\tCONFIRMED\tLIKELY\tTENTATIVE\tERRORS\tDURATION")
+	for _, t := range stats {
+		t.mu.Lock()
+		duration := t.duration.Round(time.Millisecond).String()
+		if t.cut {
+			duration += " (out of time)"
+		} else if t.full {
+			duration += " (URL limit)"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n", t.Target,
+			atomic.LoadInt64(&t.urls), atomic.LoadInt64(&t.skipped), atomic.LoadInt64(&t.forms),
+			t.reflections[browserVerified], t.reflections[confirmed], t.reflections[likely], t.reflections[tentative],
+			atomic.LoadInt64(&t.errors), duration)
+		t.mu.Unlock()
+	}
+	tw.Flush()
+}
@@ -0,0 +1,112 @@
+package reflector
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/publicsuffix"
+)
+
+// elements that pull scripts, styles and frames into a page
+const dependencySelector = "script[src], link[href], iframe[src], frame[src]"
+
+// thirdParty is the supply-chain surface of one target: the hosts of other
+// sites its pages load scripts, styles and frames from, and what from each
+type thirdParty struct {
+	site string
+	mu   sync.Mutex
+	// kinds by host, e.g. cdn.jsdelivr.net: script, style
+	hosts map[string]map[string]bool
+}
+
+func newThirdParty(target string) *thirdParty {
+	return &thirdParty{site: siteOf(target), hosts: make(map[string]map[string]bool)}
+}
+
+// siteOf returns the registrable domain of a URL's host, so
+// cdn.example.com and www.example.com count as one site
+func siteOf(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return site
+	}
+	// IPs, localhost and the like are a site of their own
+	return host
+}
+
+// dependencyKind says what an element loads: script, style or frame,
+// "" for links that don't load anything
+func dependencyKind(e *colly.HTMLElement) string {
+	switch e.Name {
+	case "script":
+		return "script"
+	case "iframe", "frame":
+		return "frame"
+	}
+	rel := " " + strings.ToLower(e.Attr("rel")) + " "
+	switch {
+	case strings.Contains(rel, " stylesheet "):
+		return "style"
+	case strings.Contains(rel, " modulepreload "):
+		return "script"
+	case strings.Contains(rel, " preload "):
+		switch strings.ToLower(e.Attr("as")) {
+		case "script":
+			return "script"
+		case "style":
+			return "style"
+		}
+	}
+	return ""
+}
+
+// add records what e loads if it comes from another site
+func (t *thirdParty) add(e *colly.HTMLElement) {
+	kind := dependencyKind(e)
+	if kind == "" {
+		return
+	}
+	attr := "src"
+	if e.Name == "link" {
+		attr = "href"
+	}
+	u, err := url.Parse(e.Request.AbsoluteURL(e.Attr(attr)))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return
+	}
+	if site := siteOf(u.String()); site == "" || site == t.site {
+		return
+	}
+	host := strings.ToLower(u.Hostname())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hosts[host] == nil {
+		t.hosts[host] = make(map[string]bool)
+	}
+	t.hosts[host][kind] = true
+}
+
+// print writes the hosts target depends on for the run summary, e.g.
+// [third-party] https://www.example.com/ cdn.jsdelivr.net=script,style www.youtube.com=frame
+func (t *thirdParty) print(w io.Writer, target string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.hosts) == 0 {
+		return
+	}
+	hosts := make([]string, 0, len(t.hosts))
+	for host, kinds := range t.hosts {
+		hosts = append(hosts, host+"="+strings.Join(sortedKeys(kinds), ","))
+	}
+	sort.Strings(hosts)
+	fmt.Fprintf(w, "[third-party] %s %s\n", target, strings.Join(hosts, " "))
+}
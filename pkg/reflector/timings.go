@@ -0,0 +1,224 @@
+package reflector
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"sync"
+	"time"
+)
+
+// requestTimings breaks every request down into DNS, connect, TLS, time to
+// first byte and the whole exchange, per host, for Options.Timings. Slow
+// DNS, connects and handshakes point at the network, a slow first byte at
+// the target, and hosts that are seldom busy at the crawler itself
+type requestTimings struct {
+	mu    sync.Mutex
+	hosts map[string]*hostTimings
+}
+
+type hostTimings struct {
+	requests int
+	// requests that had to open a connection, and the time spent doing so
+	dials, handshakes int
+	dns, connect, tls time.Duration
+	ttfb, total       []time.Duration
+	// requests in flight, since when, and the time there was at least one
+	active    int
+	busySince time.Time
+	busy      time.Duration
+	first     time.Time
+	last      time.Time
+}
+
+func newRequestTimings() *requestTimings {
+	return &requestTimings{hosts: make(map[string]*hostTimings)}
+}
+
+func (t *requestTimings) host(host string) *hostTimings {
+	h, ok := t.hosts[host]
+	if !ok {
+		h = &hostTimings{}
+		t.hosts[host] = h
+	}
+	return h
+}
+
+// start marks a request to host as in flight
+func (t *requestTimings) start(host string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.host(host)
+	if h.first.IsZero() {
+		h.first = now
+	}
+	if h.active == 0 {
+		h.busySince = now
+	}
+	h.active++
+}
+
+// done records a finished request and the phases trace saw
+func (t *requestTimings) done(host string, trace *requestTrace, now time.Time) {
+	trace.mu.Lock()
+	defer trace.mu.Unlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	h := t.host(host)
+	h.active--
+	if h.active == 0 {
+		h.busy += now.Sub(h.busySince)
+	}
+	h.last = now
+	h.requests++
+	if !trace.connectStart.IsZero() && !trace.connectDone.IsZero() {
+		h.dials++
+		h.connect += trace.connectDone.Sub(trace.connectStart)
+		if !trace.dnsStart.IsZero() && !trace.dnsDone.IsZero() {
+			h.dns += trace.dnsDone.Sub(trace.dnsStart)
+		}
+	}
+	if !trace.tlsStart.IsZero() && !trace.tlsDone.IsZero() {
+		h.handshakes++
+		h.tls += trace.tlsDone.Sub(trace.tlsStart)
+	}
+	if !trace.wrote.IsZero() && !trace.firstByte.IsZero() {
+		h.ttfb = append(h.ttfb, trace.firstByte.Sub(trace.wrote))
+	}
+	h.total = append(h.total, now.Sub(trace.start))
+}
+
+// requestTrace holds when each phase of one request happened, hooks may
+// fire from other goroutines
+type requestTrace struct {
+	mu                        sync.Mutex
+	start                     time.Time
+	dnsStart, dnsDone         time.Time
+	connectStart, connectDone time.Time
+	tlsStart, tlsDone         time.Time
+	wrote, firstByte          time.Time
+}
+
+func (r *requestTrace) mark(at *time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// dual-stack dialing connects more than once, the first attempt counts
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+func (r *requestTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { r.mark(&r.dnsStart) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { r.mark(&r.dnsDone) },
+		ConnectStart:         func(string, string) { r.mark(&r.connectStart) },
+		ConnectDone:          func(string, string, error) { r.mark(&r.connectDone) },
+		TLSHandshakeStart:    func() { r.mark(&r.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { r.mark(&r.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { r.mark(&r.wrote) },
+		GotFirstResponseByte: func() { r.mark(&r.firstByte) },
+	}
+}
+
+// wrap returns a transport that times every attempt at a request, the
+// body included: a request is done when its body is closed
+func (t *requestTimings) wrap(base http.RoundTripper) http.RoundTripper {
+	return &timingTransport{base: base, timings: t}
+}
+
+type timingTransport struct {
+	base    http.RoundTripper
+	timings *requestTimings
+}
+
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &requestTrace{start: time.Now()}
+	host := req.URL.Host
+	t.timings.start(host, trace.start)
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace())))
+	if err != nil {
+		t.timings.done(host, trace, time.Now())
+		return nil, err
+	}
+	resp.Body = &timedBody{ReadCloser: resp.Body, done: func() { t.timings.done(host, trace, time.Now()) }}
+	return resp, nil
+}
+
+// timedBody records its request as done when it is first closed
+type timedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+// Write passes through to a switched protocol's connection, see prober.upgrade
+func (b *timedBody) Write(p []byte) (int, error) {
+	return writeThrough(b.ReadCloser, p)
+}
+
+// printStats writes the timing breakdown of every host for the run summary:
+// averages of the connection phases over the requests that went through
+// them, median and 95th percentile of the time to first byte and of whole
+// requests, and the share of the host's time with a request in flight
+func (t *requestTimings) printStats(w io.Writer) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var hosts []string
+	for host := range t.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		h := t.hosts[host]
+		if h.requests == 0 {
+			continue
+		}
+		busy := h.busy
+		if h.active > 0 {
+			busy += h.last.Sub(h.busySince)
+		}
+		share := 100.0
+		if span := h.last.Sub(h.first); span > 0 {
+			share = 100 * float64(busy) / float64(span)
+		}
+		fmt.Fprintf(w, "[timings] %s requests=%d new-connections=%d dns=%s connect=%s tls=%s ttfb=%s/%s total=%s/%s busy=%.0f%%\n",
+			host, h.requests, h.dials, average(h.dns, h.dials), average(h.connect, h.dials), average(h.tls, h.handshakes),
+			percentile(h.ttfb, 50), percentile(h.ttfb, 95), percentile(h.total, 50), percentile(h.total, 95), share)
+	}
+}
+
+// average divides a total over n, rounded for printing
+func average(total time.Duration, n int) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return rounded(total / time.Duration(n))
+}
+
+// percentile returns the p-th percentile of durations, rounded for printing
+func percentile(durations []time.Duration, p int) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return rounded(sorted[(len(sorted)-1)*p/100])
+}
+
+// rounded rounds to the millisecond, or the microsecond below one
+func rounded(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(time.Millisecond)
+}
@@ -0,0 +1,107 @@
+package reflector
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// tokenExtractor describes the hidden state a framework expects back with every form
+type tokenExtractor struct {
+	Name string
+	// inputs that carry state and must be sent back untouched
+	Fields []string
+	// meta tag holding the token for forms rendered without the field
+	Meta string
+	// meta tag naming the field the token goes in, Field is used if it's missing
+	MetaParam string
+	Field     string
+	// header the framework also accepts the token in
+	Header string
+}
+
+// built-in extractors for common frameworks
+var tokenExtractors = []tokenExtractor{
+	{
+		Name:   "aspnet",
+		Fields: []string{"__VIEWSTATE", "__VIEWSTATEGENERATOR", "__VIEWSTATEENCRYPTED", "__EVENTVALIDATION", "__EVENTTARGET", "__EVENTARGUMENT", "__PREVIOUSPAGE", "__LASTFOCUS", "__RequestVerificationToken"},
+	},
+	{
+		Name:      "rails",
+		Fields:    []string{"authenticity_token", "utf8"},
+		Meta:      "csrf-token",
+		MetaParam: "csrf-param",
+		Field:     "authenticity_token",
+		Header:    "X-CSRF-Token",
+	},
+	{
+		Name:   "laravel",
+		Fields: []string{"_token", "_method"},
+		Meta:   "csrf-token",
+		Field:  "_token",
+		Header: "X-CSRF-TOKEN",
+	},
+	{
+		Name:   "django",
+		Fields: []string{"csrfmiddlewaretoken"},
+	},
+}
+
+// isStateField reports whether an input carries framework state
+func isStateField(name string) bool {
+	for _, extractor := range tokenExtractors {
+		for _, field := range extractor.Fields {
+			if name == field {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// applyTokenExtractors keeps framework state inputs at their page value and,
+// for frameworks that render the token in a meta tag, adds it to the form
+// and to the headers sent with it
+func applyTokenExtractors(f *Form, doc *goquery.Selection) {
+	for i := range f.Inputs {
+		if isStateField(f.Inputs[i].Name) {
+			f.Inputs[i].Type = "hidden"
+		}
+	}
+
+	for _, extractor := range tokenExtractors {
+		if extractor.Meta == "" {
+			continue
+		}
+		token, ok := doc.Find("meta[name='" + extractor.Meta + "']").Attr("content")
+		if !ok || token == "" {
+			continue
+		}
+		field := extractor.Field
+		if extractor.MetaParam != "" {
+			if param, ok := doc.Find("meta[name='" + extractor.MetaParam + "']").Attr("content"); ok && param != "" {
+				field = param
+			}
+		}
+		if !f.hasInput(field) {
+			f.Inputs = append(f.Inputs, Input{Type: "hidden", Name: field, Value: token})
+		}
+		if extractor.Header != "" {
+			if f.Headers == nil {
+				f.Headers = http.Header{}
+			}
+			f.Headers.Set(extractor.Header, token)
+		}
+	}
+}
+
+// hasInput reports whether the form has an input called name
+func (f Form) hasInput(name string) bool {
+	for _, in := range f.Inputs {
+		if strings.EqualFold(in.Name, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,407 @@
+package reflector
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// how long a handshake probe waits for the messages a server sends first
+	wsEarlyWait = 3 * time.Second
+	// and how much of them it reads
+	wsEarlyBytes = 64 << 10
+)
+
+var (
+	// ws:// and wss:// URLs in a page or script
+	wsURLRegex = regexp.MustCompile(`wss?://[^\s"'<>\\` + "`" + `]+`)
+	// new WebSocket("/socket") and the like, relative to the page
+	wsConstructorRegex = regexp.MustCompile("new\\s+WebSocket\\s*\\(\\s*[\"'`]([^\"'`]+)[\"'`]")
+	// "wss://" + location.host + "/socket" and the like
+	wsLocationRegex = regexp.MustCompile("[\"'`](wss?:)?//[\"'`]\\s*\\)?\\s*\\+\\s*(?:window\\.|document\\.)?location\\.host\\s*\\+\\s*[\"'`](/[^\"'`]*)[\"'`]")
+)
+
+// wsURLs returns the WebSocket endpoints in a page or script loaded by page:
+// ws:// and wss:// URLs written out, and the ones built from a path or the
+// page's own host
+func wsURLs(body []byte, page *url.URL) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	add := func(link string) {
+		link = strings.TrimRight(link, ".,;:)")
+		if u, err := url.Parse(link); err == nil && u.Host != "" && (u.Scheme == "ws" || u.Scheme == "wss") && !seen[link] {
+			seen[link] = true
+			urls = append(urls, link)
+		}
+	}
+	// a relative URL is resolved against the page, with the WebSocket scheme
+	// of the page's own
+	resolve := func(ref, scheme string) string {
+		u, err := page.Parse(ref)
+		if err != nil {
+			return ""
+		}
+		switch {
+		case scheme != "":
+			u.Scheme = scheme
+		case u.Scheme == "https":
+			u.Scheme = "wss"
+		case u.Scheme == "http":
+			u.Scheme = "ws"
+		}
+		return u.String()
+	}
+	for _, match := range wsURLRegex.FindAll(body, -1) {
+		add(string(match))
+	}
+	for _, m := range wsConstructorRegex.FindAllSubmatch(body, -1) {
+		add(resolve(string(m[1]), ""))
+	}
+	for _, m := range wsLocationRegex.FindAllSubmatch(body, -1) {
+		add(resolve(string(m[2]), strings.TrimSuffix(string(m[1]), ":")))
+	}
+	return urls
+}
+
+// wsHandshakeURL returns the http:// or https:// URL a ws:// or wss:// URL's
+// handshake is sent to, "" for other URLs
+func wsHandshakeURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return ""
+	}
+	return u.String()
+}
+
+// wsTester reports each WebSocket endpoint once and tests it once,
+// endpoints are told apart by their path and query parameter names
+type wsTester struct {
+	seen sync.Map
+	// scripts already read for endpoints
+	scripts sync.Map
+}
+
+// endpoint reports whether a WebSocket URL's endpoint is new
+func (t *wsTester) endpoint(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	names := make([]string, 0)
+	for name := range u.Query() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	endpoint := *u
+	endpoint.RawQuery = strings.Join(names, "&")
+	endpoint.Fragment = ""
+	_, seen := t.seen.LoadOrStore(endpoint.String(), true)
+	return !seen
+}
+
+// fetch reports whether a script is new and needs reading
+func (t *wsTester) fetch(link string) bool {
+	_, seen := t.scripts.LoadOrStore(link, true)
+	return !seen
+}
+
+// queryInjection returns the injection with a hash in each query
+// parameter of a WebSocket URL, false for URLs without any
+func queryInjection(link, page string) (injection, bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return injection{}, false
+	}
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	inj := injection{FormLocation: link, Page: page}
+	for _, name := range names {
+		inj.Params = append(inj.Params, name)
+		inj.Hashes = append(inj.Hashes, newCanary(name))
+	}
+	return inj, true
+}
+
+// messageInjection returns the injection sent as messages over a WebSocket,
+// a hash on its own and one in a JSON object, the shapes apps commonly read
+func messageInjection(link, page string) injection {
+	return injection{
+		FormLocation: link,
+		Page:         page,
+		Params:       []string{"message[text]", "message[json]"},
+		Hashes:       []string{newCanary("message"), newCanary("message")},
+	}
+}
+
+// wsMessages returns the messages that carry a message injection's hashes
+func wsMessages(inj injection) [][]byte {
+	var messages [][]byte
+	for i, hash := range inj.Hashes {
+		switch {
+		case hash == "":
+		case inj.Params[i] == "message[json]":
+			messages = append(messages, []byte(`{"message":"`+hash+`"}`))
+		default:
+			messages = append(messages, []byte(hash))
+		}
+	}
+	return messages
+}
+
+// wsProbeURL returns link with inj's hashes in its query parameters
+func wsProbeURL(link string, inj injection) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	query := u.Query()
+	for i, name := range inj.Params {
+		if inj.Hashes[i] != "" {
+			query.Set(name, inj.Hashes[i])
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// upgrade sends a WebSocket handshake to a ws:// or wss:// URL, from a page
+// of origin, sends the messages in send once it is accepted, and returns
+// the handshake response and the messages the server sent within wait, one
+// per line. Servers that refuse the upgrade give their response and its body
+func (p *prober) upgrade(target, origin string, send [][]byte, wait time.Duration) (*http.Response, []byte, error) {
+	handshake := wsHandshakeURL(target)
+	if handshake == "" {
+		return nil, nil, errors.New("not a WebSocket URL: " + target)
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	extra := http.Header{
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {base64.StdEncoding.EncodeToString(key)},
+	}
+	if origin != "" {
+		extra.Set("Origin", origin)
+	}
+	req, err := http.NewRequest("GET", handshake, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for header, value := range p.headers.current() {
+		if header == "Host" {
+			req.Host = value
+			continue
+		}
+		req.Header.Set(header, value)
+	}
+	for header, values := range extra {
+		req.Header[header] = values
+	}
+	p.limiter.wait()
+	p.rates.wait(req.URL.Host)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.rates.observe(req.URL.Host, resp.StatusCode, resp.Header)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, wsEarlyBytes))
+		return resp, body, err
+	}
+
+	// the connection stays open, so whatever came by the deadline is it
+	var messages []byte
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		messages = readWSMessages(resp.Body, wsEarlyBytes)
+	}()
+	// a switched protocol's body is the connection, writable through the
+	// transport's wrappers
+	if w, ok := resp.Body.(io.Writer); ok {
+		for _, message := range send {
+			if err := writeWSMessage(w, message); err != nil {
+				break
+			}
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(wait):
+	}
+	resp.Body.Close()
+	<-done
+	return resp, messages, nil
+}
+
+// writeWSMessage writes a text message in one frame, masked as clients must
+func writeWSMessage(w io.Writer, message []byte) error {
+	frame := []byte{0x81}
+	switch size := len(message); {
+	case size < 126:
+		frame = append(frame, 0x80|byte(size))
+	case size <= 0xffff:
+		frame = append(frame, 0x80|126, byte(size>>8), byte(size))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(size))
+		frame = append(append(frame, 0x80|127), ext[:]...)
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	for i, b := range message {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := w.Write(frame)
+	return err
+}
+
+// writeThrough writes to the connection under a wrapped 101 response body
+func writeThrough(body io.ReadCloser, p []byte) (int, error) {
+	if w, ok := body.(io.Writer); ok {
+		return w.Write(p)
+	}
+	return 0, errors.New("response body is not a connection")
+}
+
+// readWSMessages reads the text and binary messages of a server's frames,
+// one per line, until the connection closes or limit bytes were read
+func readWSMessages(r io.Reader, limit int) []byte {
+	br := bufio.NewReader(r)
+	var messages []byte
+	for len(messages) < limit {
+		var head [2]byte
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			break
+		}
+		opcode := head[0] & 0x0f
+		size := uint64(head[1] & 0x7f)
+		switch size {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(br, ext[:]); err != nil {
+				return messages
+			}
+			size = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(br, ext[:]); err != nil {
+				return messages
+			}
+			size = binary.BigEndian.Uint64(ext[:])
+		}
+		// servers don't mask their frames, but skip a mask if one does
+		if head[1]&0x80 != 0 {
+			if _, err := br.Discard(4); err != nil {
+				return messages
+			}
+		}
+		if size > uint64(limit-len(messages)) {
+			size = uint64(limit - len(messages))
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			return append(messages, payload...)
+		}
+		switch opcode {
+		case 0x0, 0x1, 0x2:
+			messages = append(messages, payload...)
+			if head[0]&0x80 != 0 {
+				messages = append(messages, '\n')
+			}
+		case 0x8:
+			return messages
+		}
+	}
+	return messages
+}
+
+// wsReflection returns the params of inj whose hash came back in the
+// handshake response's headers or the early messages, or the body of a
+// refused handshake, and where
+func wsReflection(inj injection, resp *http.Response, messages []byte) ([]string, []string) {
+	params := inj.reflectedIn(messages, &resp.Header)
+	headers := inj.reflectedHeaders(&resp.Header)
+	seen := make(map[string]bool)
+	var locations []string
+	for _, param := range params {
+		location := "message"
+		if resp.StatusCode != http.StatusSwitchingProtocols {
+			location = "body"
+		}
+		if name, ok := headers[param]; ok {
+			location = "header:" + name
+		}
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	return params, locations
+}
+
+// testWebSocket sends inj's hashes to link, in the handshake's query or as
+// messages, and when some come back, again with fresh ones to grade the
+// reflection
+func testWebSocket(p *prober, link, origin string, inj injection, messages bool) (params, locations []string, confidence string, ok bool) {
+	send := func(inj injection) (*http.Response, []byte, error) {
+		if messages {
+			return p.upgrade(link, origin, wsMessages(inj), wsEarlyWait)
+		}
+		return p.upgrade(wsProbeURL(link, inj), origin, nil, wsEarlyWait)
+	}
+	resp, received, err := send(inj)
+	if err != nil {
+		return nil, nil, "", false
+	}
+	params, locations = wsReflection(inj, resp, received)
+	if len(params) == 0 {
+		return nil, nil, "", false
+	}
+	fresh := injection{FormLocation: inj.FormLocation, Params: inj.Params, Hashes: make([]string, len(inj.Hashes))}
+	for i, name := range inj.Params {
+		if containsString(params, name) {
+			fresh.Hashes[i] = newCanary(name)
+		}
+	}
+	confidence = likely
+	if resp, received, err := send(fresh); err == nil {
+		if again, _ := wsReflection(fresh, resp, received); len(again) > 0 {
+			confidence = confirmed
+		}
+	}
+	return params, locations, confidence, true
+}
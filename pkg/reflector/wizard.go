@@ -0,0 +1,108 @@
+package reflector
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gocolly/colly/v2"
+)
+
+// the most steps of a multi-step form followed from the first one
+const maxWizardSteps = 8
+
+var (
+	// submit buttons that advance a multi-step form, and ones that go back
+	nextButtonRegex = regexp.MustCompile(`(?i)\b(next|continue|proceed|forward|weiter|suivant|siguiente|avanti)\b`)
+	backButtonRegex = regexp.MustCompile(`(?i)\b(back|previous|prev|cancel|zurück|retour|anterior)\b`)
+	// hidden fields multi-step forms keep their position in
+	stepFieldRegex = regexp.MustCompile(`(?i)(^|[_-])(step|stage|wizard)`)
+	// "Step 2 of 4", "step 2/4"
+	stepTextRegex = regexp.MustCompile(`(?i)\bstep\s*\d+\s*(of|/)\s*\d+`)
+)
+
+// selects the step indicators of common wizard and stepper components
+const stepIndicatorSelector = "[class*=wizard], [class*=stepper], [class*=step-indicator], [class*=progress-step], [id*=wizard], [id*=stepper]"
+
+// wizardSteps tracks the multi-step forms followed during a crawl
+type wizardSteps struct {
+	seen sync.Map
+}
+
+// isWizardStep reports whether a form is a step of a multi-step form: it
+// advances with a next/continue button, keeps its step in a hidden field,
+// or its page shows a step indicator
+func isWizardStep(e *colly.HTMLElement) bool {
+	wizard := false
+	e.DOM.Find(submitSelector).Each(func(_ int, button *goquery.Selection) {
+		wizard = wizard || nextButtonRegex.MatchString(buttonLabel(button))
+	})
+	e.DOM.Find("input[type=hidden]").Each(func(_ int, input *goquery.Selection) {
+		wizard = wizard || stepFieldRegex.MatchString(input.AttrOr("name", ""))
+	})
+	if wizard {
+		return true
+	}
+	page := e.DOM.Parents().Last()
+	return page.Find(stepIndicatorSelector).Length() > 0 || stepTextRegex.MatchString(page.Text())
+}
+
+// buttonLabel is everything a submit button can be recognised by
+func buttonLabel(button *goquery.Selection) string {
+	return strings.Join([]string{button.Text(), button.AttrOr("value", ""), button.AttrOr("name", ""), button.AttrOr("id", ""), button.AttrOr("class", "")}, " ")
+}
+
+// next returns the variants of a step reached at step that should be
+// submitted: not the form just submitted shown again, which means the step
+// didn't advance, not variants submitted by a back button, and each step only once
+func (w *wizardSteps) next(forms []Form, previous Form, step int) []Form {
+	if step > maxWizardSteps {
+		return nil
+	}
+	var next []Form
+	for _, f := range forms {
+		if formKey(f) == formKey(previous) || goesBack(f) {
+			continue
+		}
+		if _, seen := w.seen.LoadOrStore(formKey(f), true); seen {
+			continue
+		}
+		next = append(next, f)
+	}
+	return next
+}
+
+// goesBack reports whether a form variant is submitted by a back or cancel button
+func goesBack(f Form) bool {
+	for _, in := range f.Inputs {
+		if in.Type == "submit" && (backButtonRegex.MatchString(in.Name) || backButtonRegex.MatchString(in.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeStep returns which step of a multi-step form a probe submitted, 1 for a form found while crawling
+func probeStep(r *colly.Request) int {
+	if step, ok := r.Ctx.GetAny("step").(int); ok {
+		return step
+	}
+	return 1
+}
+
+// submitStep submits the next step of a multi-step form
+func submitStep(c *colly.Collector, f Form, inj injection, step int) {
+	ctx := probeContext(f, inj)
+	ctx.Put("step", step)
+	sendProbe(c, f, inj, ctx)
+}
+
+// stepField annotates reflections found on a later step of a multi-step form
+func stepField(r *colly.Request) string {
+	if step := probeStep(r); step > 1 {
+		return "step=" + strconv.Itoa(step)
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package schema
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MarshalProto encodes the result as the Result message of findings.proto
+func (r Result) MarshalProto() []byte {
+	var b []byte
+	if r.SchemaVersion != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.SchemaVersion))
+	}
+	b = appendString(b, 2, r.Source)
+	b = appendString(b, 3, r.URL)
+	b = appendString(b, 4, r.Text)
+	b = appendString(b, 5, r.Method)
+	for _, in := range r.Inputs {
+		var m []byte
+		m = appendString(m, 1, in.Type)
+		m = appendString(m, 2, in.Name)
+		m = appendString(m, 3, in.Value)
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	b = appendString(b, 7, r.Form)
+	for _, param := range r.Params {
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendString(b, param)
+	}
+	// sorted so the same result always encodes the same
+	var keys []string
+	for key := range r.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var m []byte
+		m = appendString(m, 1, key)
+		m = appendString(m, 2, r.Fields[key])
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, m)
+	}
+	return b
+}
+
+// appendString appends a string field, leaving it out when empty as proto3 does
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
@@ -0,0 +1,57 @@
+// Package schema defines the JSON objects go-reflect writes with -json, one
+// per line. Every object carries the schema_version it was written with.
+//
+// Within a version fields are only ever added. Renaming or removing a field,
+// or changing what a value means, bumps Version, so an integration can check
+// schema_version and refuse objects it doesn't understand instead of silently
+// reading empty fields.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Version is the schema version of the objects written by this build
+const Version = 1
+
+// Result is a discovered URL or a finding
+type Result struct {
+	SchemaVersion int `json:"schema_version"`
+	// href, script, form, robots, sitemap, route, alternate, feed, reflector,
+	// cross-page, stored, js-sink, mixed-content, cookie, csrf-candidate, cors,
+	// methods, clickjacking or hidden-param
+	Source string `json:"source"`
+	URL    string `json:"url,omitempty"`
+	// what was found, plain URLs have no text
+	Text string `json:"text,omitempty"`
+	// the form, for form results
+	Method string  `json:"method,omitempty"`
+	Inputs []Input `json:"inputs,omitempty"`
+	// the form or URL the hashes were injected into and the parameters that
+	// came back, for reflector results
+	Form   string   `json:"form,omitempty"`
+	Params []string `json:"params,omitempty"`
+	// key=value annotations, e.g. confidence, class, in, context and target tags.
+	// Annotations without a value map to ""
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// Input is a form field as it would be submitted
+type Input struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// JSON encodes the result on one line without escaping &, < and >, which are
+// common in URLs and have no reason to be escaped outside of HTML
+func (r Result) JSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(r); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultProfilesDir is where -profile-name looks unless -profiles-dir is given
+func defaultProfilesDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "profiles"
+	}
+	return filepath.Join(dir, "go-reflect", "profiles")
+}
+
+// loadProfile applies a saved profile, one flag per line as name=value,
+// e.g. "h=Cookie: session={{env:CLIENT_X_SESSION}}" or "crawl-rate=5".
+// Flags given on the command line or the environment win over the profile, repeatable flags
+// like redact may appear on several lines
+func loadProfile(dir, name string) error {
+	if dir == "" {
+		dir = defaultProfilesDir()
+	}
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	s := bufio.NewScanner(file)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		key := strings.TrimPrefix(strings.TrimSpace(parts[0]), "-")
+		value := "true"
+		if len(parts) == 2 {
+			value = strings.TrimSpace(parts[1])
+		}
+		if key == "profile-name" || key == "profiles-dir" {
+			return fmt.Errorf("%s:%d: profiles can't load other profiles", name, n)
+		}
+		if flag.Lookup(key) == nil {
+			return fmt.Errorf("%s:%d: unknown flag %q", name, n, key)
+		}
+		if set[key] {
+			continue
+		}
+		if err := flag.Set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", name, n, err)
+		}
+	}
+	return s.Err()
+}
+
+// envPrefix marks environment variables holding flag values
+const envPrefix = "REFLECTOR_"
+
+// envName returns the environment variable for a flag, e.g. REFLECTOR_CRAWL_RATE for -crawl-rate
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// loadEnv applies REFLECTOR_* environment variables to the flags not given on
+// the command line, so they rank below flags and above a profile. Repeatable
+// flags like redact take one value per line. Variables that match no flag,
+// e.g. from a newer version or set for something else, are noted on log and skipped
+func loadEnv(log io.Writer) error {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	known := make(map[string]*flag.Flag)
+	flag.VisitAll(func(f *flag.Flag) {
+		known[envName(f.Name)] = f
+	})
+
+	for _, env := range os.Environ() {
+		parts := strings.SplitN(env, "=", 2)
+		if !strings.HasPrefix(parts[0], envPrefix) {
+			continue
+		}
+		f, ok := known[parts[0]]
+		if !ok {
+			fmt.Fprintf(log, "Ignoring %s, it doesn't match any flag\n", parts[0])
+			continue
+		}
+		if set[f.Name] {
+			continue
+		}
+		values := []string{parts[1]}
+		if _, repeatable := f.Value.(*repeatedFlags); repeatable {
+			values = strings.Split(parts[1], "\n")
+		}
+		for _, value := range values {
+			if err := flag.Set(f.Name, value); err != nil {
+				return fmt.Errorf("%s: %w", parts[0], err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// publisher sends each finding to a message bus
+type publisher interface {
+	publish(data []byte) error
+	close() error
+}
+
+// newPublisher connects to nats://host:port/subject or kafka://host:port/topic,
+// or nats+tls:// and kafka+tls:// over TLS, verifying certificates unless insecure
+func newPublisher(dest string, insecure bool) (publisher, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.Trim(u.Path, "/")
+	if u.Host == "" || name == "" {
+		return nil, fmt.Errorf("publish destination must be scheme://host:port/name, got %q", dest)
+	}
+	var config *tls.Config
+	if strings.HasSuffix(u.Scheme, "+tls") {
+		config = &tls.Config{InsecureSkipVerify: insecure}
+	}
+	switch strings.TrimSuffix(u.Scheme, "+tls") {
+	case "nats":
+		return newNATSPublisher(u, name, config)
+	case "kafka":
+		return newKafkaPublisher(u, name, config)
+	}
+	return nil, fmt.Errorf("publish destination must be nats://, nats+tls://, kafka:// or kafka+tls://, got %q", dest)
+}
+
+// natsPublisher speaks the NATS client protocol, which is plain text
+type natsPublisher struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	subject string
+
+	mu   sync.Mutex
+	err  error
+	pong chan struct{}
+}
+
+// newNATSPublisher connects to the server u points to, upgrading the
+// connection to TLS after its INFO if config isn't nil
+func newNATSPublisher(u *url.URL, subject string, config *tls.Config) (*natsPublisher, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	// the server introduces itself first
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	info, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: no INFO from server", host)
+	}
+	conn.SetReadDeadline(time.Time{})
+	if config != nil {
+		config.ServerName = u.Hostname()
+		secure := tls.Client(conn, config)
+		secure.SetDeadline(time.Now().Add(10 * time.Second))
+		if err := secure.Handshake(); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("nats %s: %w", host, err)
+		}
+		secure.SetDeadline(time.Time{})
+		conn, r = secure, bufio.NewReader(secure)
+	}
+
+	options := map[string]interface{}{"verbose": false, "pedantic": false, "tls_required": config != nil, "name": "go-reflect", "lang": "go", "version": "1.0.0"}
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"], options["pass"] = u.User.Username(), password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	connect, _ := json.Marshal(options)
+	p := &natsPublisher{conn: conn, w: bufio.NewWriter(conn), subject: subject, pong: make(chan struct{}, 1)}
+	fmt.Fprintf(p.w, "CONNECT %s\r\nPING\r\n", connect)
+	if err := p.w.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	go p.read(r)
+	// the first PONG means the server accepted CONNECT
+	select {
+	case <-p.pong:
+	case <-time.After(10 * time.Second):
+		conn.Close()
+		return nil, fmt.Errorf("nats %s: no reply to CONNECT", host)
+	}
+	if err := p.failed(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// read answers the server's keepalives and remembers any error it sends
+func (p *natsPublisher) read(r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			p.fail(err)
+			// wake up anyone waiting on a PONG that won't come
+			select {
+			case p.pong <- struct{}{}:
+			default:
+			}
+			return
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PING":
+			p.mu.Lock()
+			p.w.WriteString("PONG\r\n")
+			p.w.Flush()
+			p.mu.Unlock()
+		case line == "PONG":
+			select {
+			case p.pong <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			p.fail(fmt.Errorf("nats: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR"))))
+		}
+	}
+}
+
+func (p *natsPublisher) fail(err error) {
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+}
+
+func (p *natsPublisher) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *natsPublisher) publish(data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	fmt.Fprintf(p.w, "PUB %s %d\r\n", p.subject, len(data))
+	p.w.Write(data)
+	p.w.WriteString("\r\n")
+	return p.w.Flush()
+}
+
+// close waits for the server to have processed everything published
+func (p *natsPublisher) close() error {
+	p.mu.Lock()
+	p.w.WriteString("PING\r\n")
+	err := p.w.Flush()
+	p.mu.Unlock()
+	if err == nil {
+		select {
+		case <-p.pong:
+		case <-time.After(10 * time.Second):
+			err = errors.New("nats: no reply to final PING")
+		}
+	}
+	if err == nil {
+		err = p.failed()
+	}
+	p.conn.Close()
+	return err
+}
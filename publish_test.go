@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// fakeNATS accepts one client, replies to its PINGs and sends back the
+// CONNECT options and every message it publishes once the client closes
+func fakeNATS(t *testing.T, l net.Listener, connected chan<- map[string]interface{}, published chan<- [][]byte) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576}\r\n")
+	r := bufio.NewReader(conn)
+	var messages [][]byte
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			published <- messages
+			return
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			t.Errorf("line %q isn't CRLF terminated", line)
+		}
+		line = strings.TrimSuffix(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "CONNECT "):
+			var options map[string]interface{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &options); err != nil {
+				t.Errorf("CONNECT %v", err)
+			}
+			connected <- options
+		case line == "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case strings.HasPrefix(line, "PUB "):
+			var subject string
+			var n int
+			if _, err := fmt.Sscanf(line, "PUB %s %d", &subject, &n); err != nil || subject != "findings" {
+				t.Errorf("bad PUB line %q", line)
+			}
+			payload := make([]byte, n+2)
+			if _, err := io.ReadFull(r, payload); err != nil || !bytes.HasSuffix(payload, []byte("\r\n")) {
+				t.Errorf("payload of %d bytes not followed by CRLF: %q", n, payload)
+			}
+			messages = append(messages, payload[:n])
+		default:
+			t.Errorf("unexpected line %q", line)
+		}
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	tests := []struct {
+		name     string
+		user     *url.Userinfo
+		messages [][]byte
+		options  map[string]interface{}
+	}{
+		{
+			name:     "one finding",
+			messages: [][]byte{[]byte(`{"source":"reflector","url":"https://example.com/?q=rflk8f2a9x0m3p_q"}`)},
+		},
+		{
+			name:     "payloads with CRLF and nothing",
+			messages: [][]byte{[]byte("PUB fake 3\r\nabc\r\n"), {}, []byte("PING\r\n")},
+		},
+		{
+			name:     "token",
+			user:     url.User("s3cret"),
+			messages: [][]byte{[]byte("{}")},
+			options:  map[string]interface{}{"auth_token": "s3cret"},
+		},
+		{
+			name:     "user and password",
+			user:     url.UserPassword("reflector", "s3cret"),
+			messages: [][]byte{[]byte("{}")},
+			options:  map[string]interface{}{"user": "reflector", "pass": "s3cret"},
+		},
+	}
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		connected := make(chan map[string]interface{}, 1)
+		published := make(chan [][]byte, 1)
+		go fakeNATS(t, l, connected, published)
+
+		p, err := newNATSPublisher(&url.URL{Scheme: "nats", Host: l.Addr().String(), User: test.user}, "findings", nil)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for _, message := range test.messages {
+			if err := p.publish(message); err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		}
+		if err := p.close(); err != nil {
+			t.Errorf("%s: close: %v", test.name, err)
+		}
+		options := <-connected
+		for name, value := range test.options {
+			if options[name] != value {
+				t.Errorf("%s: CONNECT %s is %v, want %v", test.name, name, options[name], value)
+			}
+		}
+		messages := <-published
+		if len(messages) != len(test.messages) {
+			t.Fatalf("%s: %d messages published, want %d", test.name, len(messages), len(test.messages))
+		}
+		for i := range messages {
+			if !bytes.Equal(messages[i], test.messages[i]) {
+				t.Errorf("%s: message %d is %q, want %q", test.name, i, messages[i], test.messages[i])
+			}
+		}
+		l.Close()
+	}
+}
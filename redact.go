@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+)
+
+const redacted = "[REDACTED]"
+
+var (
+	// secret headers on lines of their own, as in raw requests or -h values,
+	// the name is kept and the value redacted
+	secretHeaderRegex = regexp.MustCompile(`(?im)^(\s*(?:authorization|proxy-authorization|cookie|set-cookie|x-api-key|x-auth-token|x-csrf-token)\s*:[ \t]*)[^\r\n]+`)
+	// the same secrets and common credentials in URL query parameters, only
+	// the value up to the next parameter is redacted
+	secretParamRegex = regexp.MustCompile(`(?i)([?&;](?:authorization|cookie|x-api-key|x-auth-token|x-csrf-token|api[_-]?key|access[_-]token)=)[^&#\s"'<>]+`)
+	// bearer tokens and JWTs wherever they show up
+	defaultSecretRegexes = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[a-z0-9\-._~+/]+=*`),
+		regexp.MustCompile(`\beyJ[a-zA-Z0-9_-]{5,}\.eyJ[a-zA-Z0-9_-]{5,}\.[a-zA-Z0-9_-]*`),
+	}
+)
+
+// redactor scrubs secrets from anything the tool writes out
+type redactor struct {
+	secrets  []string
+	patterns []*regexp.Regexp
+}
+
+// repeatedFlags collects the values of a flag that may be repeated, like -redact
+type repeatedFlags []string
+
+func (s *repeatedFlags) String() string { return strings.Join(*s, ",") }
+
+func (s *repeatedFlags) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// newRedactor builds a redactor for the secret values in use this run,
+// the Authorization/Cookie style custom headers, identity cookies and
+// login passwords, plus any extra user supplied patterns
+func newRedactor(extra []string, headers map[string]string, cookies []string) (*redactor, error) {
+	r := &redactor{patterns: defaultSecretRegexes}
+	for _, pattern := range extra {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	for header, value := range headers {
+		if secretHeaderRegex.MatchString(header + ": x") {
+			r.addSecret(value)
+		}
+	}
+	for _, cookie := range cookies {
+		r.addSecret(cookie)
+	}
+	// longest first so a secret containing another is fully replaced
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+	return r, nil
+}
+
+// addSecret registers a value and, for cookie strings, each cookie value in it
+func (r *redactor) addSecret(value string) {
+	if len(value) < 4 {
+		return
+	}
+	r.secrets = append(r.secrets, value)
+	for _, cookie := range strings.Split(value, ";") {
+		if parts := strings.SplitN(strings.TrimSpace(cookie), "=", 2); len(parts) == 2 && len(parts[1]) >= 4 {
+			r.secrets = append(r.secrets, parts[1])
+		}
+	}
+}
+
+// redact returns s with every known secret and secret pattern replaced
+func (r *redactor) redact(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	s = secretHeaderRegex.ReplaceAllString(s, "${1}"+redacted)
+	s = secretParamRegex.ReplaceAllString(s, "${1}"+redacted)
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+// result redacts every string of a structured result
+func (r *redactor) result(res schema.Result) schema.Result {
+	if r == nil {
+		return res
+	}
+	res.URL, res.Text, res.Form = r.redact(res.URL), r.redact(res.Text), r.redact(res.Form)
+	inputs := make([]schema.Input, len(res.Inputs))
+	for i, in := range res.Inputs {
+		in.Value = r.redact(in.Value)
+		inputs[i] = in
+	}
+	res.Inputs = inputs
+	fields := make(map[string]string, len(res.Fields))
+	for key, value := range res.Fields {
+		fields[key] = r.redact(value)
+	}
+	res.Fields = fields
+	return res
+}
+
+// writer wraps w so everything written through it is redacted,
+// callers should write whole lines
+func (r *redactor) writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return redactingWriter{r: r, w: w}
+}
+
+type redactingWriter struct {
+	r *redactor
+	w io.Writer
+}
+
+func (rw redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(rw.w, rw.r.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+)
+
+// what each kind of finding is, for the rules of a SARIF log
+var sarifRules = map[string]struct {
+	description string
+	level       string
+	tags        []string
+}{
+	"reflector":      {"Input reflected in the response", "warning", []string{"security", "external/cwe/cwe-79"}},
+	"cross-page":     {"Input reflected on another page", "warning", []string{"security", "external/cwe/cwe-79"}},
+	"stored":         {"Input stored and shown later", "warning", []string{"security", "external/cwe/cwe-79"}},
+	"js-sink":        {"DOM XSS sink fed by a source", "note", []string{"security", "external/cwe/cwe-79"}},
+	"mixed-content":  {"HTTP resource on an HTTPS page", "note", []string{"security", "external/cwe/cwe-319"}},
+	"cookie":         {"Cookie without protective attributes", "note", []string{"security", "external/cwe/cwe-1004"}},
+	"csrf-candidate": {"Form without anti-CSRF protection", "note", []string{"security", "external/cwe/cwe-352"}},
+	"cors":           {"Permissive CORS policy", "warning", []string{"security", "external/cwe/cwe-942"}},
+	"methods":        {"Extra HTTP methods accepted", "note", []string{"security"}},
+	"clickjacking":   {"Page can be framed", "note", []string{"security", "external/cwe/cwe-1021"}},
+	"hidden-param":   {"Parameter not linked to anywhere", "note", []string{"security"}},
+}
+
+// levels of reflections by confidence, the others take their rule's
+var sarifConfidenceLevels = map[string]string{
+	"browser-verified": "error",
+	"confirmed":        "error",
+	"likely":           "warning",
+	"tentative":        "note",
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver struct {
+		Name           string      `json:"name"`
+		Version        string      `json:"version"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+type sarifRule struct {
+	ID                   string                 `json:"id"`
+	ShortDescription     sarifMessage           `json:"shortDescription"`
+	DefaultConfiguration map[string]string      `json:"defaultConfiguration"`
+	Properties           map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                 `json:"ruleId"`
+	RuleIndex           int                    `json:"ruleIndex"`
+	Level               string                 `json:"level"`
+	Message             sarifMessage           `json:"message"`
+	Locations           []sarifLocation        `json:"locations"`
+	PartialFingerprints map[string]string      `json:"partialFingerprints"`
+	WebRequest          *sarifWebRequest       `json:"webRequest,omitempty"`
+	Properties          map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+// sarifWebRequest is the request that reproduces a finding
+type sarifWebRequest struct {
+	Protocol   string            `json:"protocol"`
+	Version    string            `json:"version"`
+	Target     string            `json:"target"`
+	Method     string            `json:"method"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+	Body       *sarifMessage     `json:"body,omitempty"`
+}
+
+// writeSARIF saves findings as a SARIF 2.1.0 log with a rule per kind of
+// finding, for GitHub code scanning and vulnerability management tools
+func writeSARIF(path string, findings []schema.Result) error {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = "go-reflect"
+	run.Tool.Driver.Version = toolVersion()
+	run.Tool.Driver.InformationURI = "https://github.com/garlic0x1/go-reflect"
+	run.Tool.Driver.Rules = []sarifRule{}
+
+	rules := make(map[string]int)
+	for _, f := range findings {
+		rule, ok := sarifRules[f.Source]
+		if !ok {
+			continue
+		}
+		index, ok := rules[f.Source]
+		if !ok {
+			index = len(run.Tool.Driver.Rules)
+			rules[f.Source] = index
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{
+				ID:                   f.Source,
+				ShortDescription:     sarifMessage{rule.description},
+				DefaultConfiguration: map[string]string{"level": rule.level},
+				Properties:           map[string]interface{}{"tags": rule.tags},
+			})
+		}
+		level := rule.level
+		if confidence, ok := sarifConfidenceLevels[f.Fields["confidence"]]; ok {
+			level = confidence
+		}
+		sum := sha256.Sum256([]byte(findingKey(f)))
+		res := sarifResult{
+			RuleID:              f.Source,
+			RuleIndex:           index,
+			Level:               level,
+			Message:             sarifMessage{f.Text},
+			Locations:           make([]sarifLocation, 1),
+			PartialFingerprints: map[string]string{"findingKey/v1": hex.EncodeToString(sum[:])},
+			WebRequest:          reproduction(f),
+			Properties:          map[string]interface{}{},
+		}
+		if res.Message.Text == "" {
+			res.Message.Text = f.URL
+		}
+		res.Locations[0].PhysicalLocation.ArtifactLocation.URI = f.URL
+		if f.Form != "" {
+			res.Properties["form"] = f.Form
+		}
+		if len(f.Params) > 0 {
+			res.Properties["params"] = f.Params
+		}
+		if res.WebRequest != nil {
+			res.Properties["method"] = res.WebRequest.Method
+		}
+		if context := f.Fields["context"]; context != "" {
+			res.Properties["context"] = context
+		}
+		if len(f.Fields) > 0 {
+			res.Properties["fields"] = f.Fields
+		}
+		run.Results = append(run.Results, res)
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// reproduction returns the request that sent a reflection's canaries, from
+// its origin field, e.g. origin=POST:https://example.com/login, and a POST's
+// body as it was sent from its origin-body field, hidden inputs, anti-CSRF
+// tokens and filler values included. Nil for other findings
+func reproduction(f schema.Result) *sarifWebRequest {
+	origin := f.Fields["origin"]
+	i := strings.Index(origin, ":")
+	if i < 0 {
+		return nil
+	}
+	req := &sarifWebRequest{Protocol: "HTTP", Version: "1.1", Method: origin[:i], Target: origin[i+1:]}
+	if req.Method == "POST" {
+		if body := f.Fields["origin-body"]; body != "" {
+			req.Body = &sarifMessage{body}
+		}
+		return req
+	}
+	if u, err := url.Parse(req.Target); err == nil && len(u.Query()) > 0 {
+		req.Parameters = make(map[string]string)
+		for name, values := range u.Query() {
+			req.Parameters[name] = values[0]
+		}
+	}
+	return req
+}
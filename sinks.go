@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// hostFiles writes results to one file per host in a directory, e.g.
+// dir/www.example.com.txt, so a run over hundreds of domains stays browsable.
+// It is safe for concurrent use, each line goes out whole, and each file is
+// written under a temporary name, copied into place as each target of its
+// host finishes and renamed into place when closed, so a file that exists
+// is complete
+type hostFiles struct {
+	dir string
+	ext string
+	// key to encrypt each file with, nil to write plain text
+	key []byte
+
+	mu      sync.Mutex
+	files   map[string]*atomicFile
+	writers map[string]io.Writer
+}
+
+func newHostFiles(dir, ext string, key []byte) (*hostFiles, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &hostFiles{
+		dir:     dir,
+		ext:     ext,
+		key:     key,
+		files:   make(map[string]*atomicFile),
+		writers: make(map[string]io.Writer),
+	}, nil
+}
+
+// file names are made of the host and port, anything else is replaced
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// hostFileName is the name of the file of the host in link, without its
+// extension, _ for results without a URL
+func hostFileName(link string) string {
+	if u, err := url.Parse(link); err == nil && u.Host != "" {
+		return unsafeFileChars.ReplaceAllString(strings.ToLower(u.Host), "_")
+	}
+	return "_"
+}
+
+// write appends a line to the file of the host in link
+func (h *hostFiles) write(link, line string) error {
+	host := hostFileName(link)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	w, ok := h.writers[host]
+	if !ok {
+		f, err := createAtomic(filepath.Join(h.dir, host+h.ext))
+		if err != nil {
+			return err
+		}
+		h.files[host] = f
+		w = f
+		if h.key != nil {
+			if w, err = newSealWriter(f, h.key); err != nil {
+				return err
+			}
+		}
+		h.writers[host] = w
+	}
+	// one write per line, so a sealed record or a line is never split
+	_, err := io.WriteString(w, line+"\n")
+	return err
+}
+
+// flush writes what is buffered to the temporary files, so a run that dies
+// leaves its lines behind in them
+func (h *hostFiles) flush() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var first error
+	for _, f := range h.files {
+		if err := f.flush(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// finish copies the file of target's host into place, with every line
+// written to it so far. Lines written after go in the next copy
+func (h *hostFiles) finish(target string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, ok := h.files[hostFileName(target)]
+	if !ok {
+		return nil
+	}
+	return f.publish()
+}
+
+// close renames every file into place
+func (h *hostFiles) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var first error
+	for _, f := range h.files {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// atomicFile is an output file written to a temporary file next to it and
+// renamed into place when closed, so readers never see half of one and
+// a file from an earlier run is only replaced by a complete one
+type atomicFile struct {
+	path string
+	tmp  *os.File
+	buf  *bufio.Writer
+}
+
+func createAtomic(path string) (*atomicFile, error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{path: path, tmp: tmp, buf: bufio.NewWriter(tmp)}, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+func (f *atomicFile) flush() error {
+	return f.buf.Flush()
+}
+
+// publish puts a copy of what is written so far in place, the temporary
+// file stays open for more
+func (f *atomicFile) publish() error {
+	if err := f.buf.Flush(); err != nil {
+		return err
+	}
+	if _, err := f.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// the temporary file is only ever appended to
+	defer f.tmp.Seek(0, io.SeekEnd)
+	cp, err := ioutil.TempFile(filepath.Dir(f.path), "."+filepath.Base(f.path)+".")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(cp, f.tmp)
+	if err == nil {
+		err = cp.Sync()
+	}
+	if err == nil {
+		err = cp.Chmod(0o644)
+	}
+	if cerr := cp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(cp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(cp.Name())
+	}
+	return err
+}
+
+// Close syncs the temporary file and renames it into place, or removes it
+// if it couldn't be written
+func (f *atomicFile) Close() error {
+	err := f.buf.Flush()
+	if err == nil {
+		err = f.tmp.Sync()
+	}
+	if err == nil {
+		// temporary files are private, outputs are as os.Create makes them
+		err = f.tmp.Chmod(0o644)
+	}
+	if cerr := f.tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.tmp.Name())
+	}
+	return err
+}
+
+// abort removes the temporary file, whatever was in place stays
+func (f *atomicFile) abort() {
+	f.tmp.Close()
+	os.Remove(f.tmp.Name())
+}
+
+// sqliteSchema keeps URLs, forms and findings in their own tables, every
+// row tagged with the run it came from so one database can hold many runs
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS urls (
+	run TEXT NOT NULL,
+	host TEXT NOT NULL,
+	source TEXT NOT NULL,
+	url TEXT NOT NULL,
+	fields TEXT
+);
+CREATE TABLE IF NOT EXISTS forms (
+	run TEXT NOT NULL,
+	host TEXT NOT NULL,
+	url TEXT NOT NULL,
+	method TEXT,
+	inputs TEXT,
+	fields TEXT
+);
+CREATE TABLE IF NOT EXISTS findings (
+	run TEXT NOT NULL,
+	host TEXT NOT NULL,
+	source TEXT NOT NULL,
+	url TEXT,
+	text TEXT,
+	form TEXT,
+	params TEXT,
+	confidence TEXT,
+	fields TEXT
+);
+CREATE INDEX IF NOT EXISTS urls_host ON urls (host);
+CREATE INDEX IF NOT EXISTS forms_host ON forms (host);
+CREATE INDEX IF NOT EXISTS findings_host ON findings (host);
+`
+
+// sqliteSink stores results in an SQLite database
+type sqliteSink struct {
+	db  *sql.DB
+	run string
+}
+
+func newSQLiteSink(path string, start time.Time) (*sqliteSink, error) {
+	// WAL keeps a long run from syncing to disk on every row
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteSink{db: db, run: start.UTC().Format(time.RFC3339)}, nil
+}
+
+// add stores a result in the table for its kind, fields and lists as JSON
+func (s *sqliteSink) add(res schema.Result) error {
+	host := ""
+	if u, err := url.Parse(res.URL); err == nil {
+		host = u.Host
+	}
+	fields, err := jsonColumn(res.Fields)
+	if err != nil {
+		return err
+	}
+	switch res.Source {
+	case "href", "script", "link", "img", "srcset", "iframe", "meta-refresh", "object", "area", "style", "data-attr",
+		"websocket", "robots", "sitemap", "openapi", "route", "alternate", "feed":
+		_, err = s.db.Exec(`INSERT INTO urls (run, host, source, url, fields) VALUES (?, ?, ?, ?, ?)`,
+			s.run, host, res.Source, res.URL, fields)
+	case "form":
+		var inputs interface{}
+		if inputs, err = jsonColumn(res.Inputs); err == nil {
+			_, err = s.db.Exec(`INSERT INTO forms (run, host, url, method, inputs, fields) VALUES (?, ?, ?, ?, ?, ?)`,
+				s.run, host, res.URL, res.Method, inputs, fields)
+		}
+	default:
+		var params, confidence interface{}
+		if value, ok := res.Fields["confidence"]; ok {
+			confidence = value
+		}
+		if params, err = jsonColumn(res.Params); err == nil {
+			_, err = s.db.Exec(`INSERT INTO findings (run, host, source, url, text, form, params, confidence, fields) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				s.run, host, res.Source, res.URL, res.Text, res.Form, params, confidence, fields)
+		}
+	}
+	return err
+}
+
+// jsonColumn encodes v for a TEXT column, NULL when it is empty
+func jsonColumn(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (s *sqliteSink) close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/garlic0x1/go-reflect/pkg/reflector"
+	"github.com/garlic0x1/go-reflect/pkg/schema"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openStore opens the -store backend: memory, sqlite:path or bolt:path, a
+// memory store remembers up to keys seen keys. With a key, a database is
+// kept encrypted at rest
+func openStore(spec string, keys int, key []byte) (reflector.Store, error) {
+	kind, path := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, path = spec[:i], spec[i+1:]
+	}
+	switch kind {
+	case "memory":
+		return reflector.NewBoundedMemoryStore(keys), nil
+	case "sqlite":
+		if path == "" {
+			return nil, fmt.Errorf("%s needs a path, e.g. sqlite:reflector.db", kind)
+		}
+		return openSealedStore(path, key, func(path string) (reflector.Store, error) {
+			return newSQLiteStore(path)
+		})
+	case "bolt":
+		if path == "" {
+			return nil, fmt.Errorf("%s needs a path, e.g. bolt:reflector.bolt", kind)
+		}
+		return openSealedStore(path, key, func(path string) (reflector.Store, error) {
+			return newBoltStore(path)
+		})
+	}
+	return nil, fmt.Errorf("unknown store %q, expected memory, sqlite:path or bolt:path", kind)
+}
+
+// openSealedStore opens a database store with open, from a decrypted copy
+// of path with a key
+func openSealedStore(path string, key []byte, open func(path string) (reflector.Store, error)) (reflector.Store, error) {
+	if key == nil {
+		return open(path)
+	}
+	sealed, err := openSealedDatabase(path, key)
+	if err != nil {
+		return nil, err
+	}
+	store, err := open(sealed.tmp)
+	if err != nil {
+		os.RemoveAll(sealed.dir)
+		return nil, err
+	}
+	return &sealedStore{Store: store, sealed: sealed}, nil
+}
+
+// sealedStore is a database store sealed back into place when closed
+type sealedStore struct {
+	reflector.Store
+	sealed *sealedDatabase
+}
+
+func (s *sealedStore) Close() error {
+	if err := s.Store.Close(); err != nil {
+		os.RemoveAll(s.sealed.dir)
+		return err
+	}
+	return s.sealed.close()
+}
+
+const sqliteStoreSchema = `
+CREATE TABLE IF NOT EXISTS store_findings (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	finding TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS store_seen (
+	key TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS store_frontier (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	state BLOB NOT NULL
+);
+`
+
+// sqliteStore is a Store in an SQLite database, in tables of its own so
+// it can share a database with -sqlite
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func newSQLiteStore(path string) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite3", path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteStoreSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+func (s *sqliteStore) SaveFindings(findings []schema.Result) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, finding := range findings {
+		data, err := finding.JSON()
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO store_findings (finding) VALUES (?)`, string(data)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LoadFindings() ([]schema.Result, error) {
+	rows, err := s.db.Query(`SELECT finding FROM store_findings ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var findings []schema.Result
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var finding schema.Result
+		if err := json.Unmarshal([]byte(data), &finding); err != nil {
+			return nil, err
+		}
+		findings = append(findings, finding)
+	}
+	return findings, rows.Err()
+}
+
+func (s *sqliteStore) Seen(key string) (bool, error) {
+	res, err := s.db.Exec(`INSERT OR IGNORE INTO store_seen (key) VALUES (?)`, key)
+	if err != nil {
+		return false, err
+	}
+	added, err := res.RowsAffected()
+	return added == 0, err
+}
+
+func (s *sqliteStore) SaveFrontier(state []byte) error {
+	_, err := s.db.Exec(`INSERT OR REPLACE INTO store_frontier (id, state) VALUES (1, ?)`, state)
+	return err
+}
+
+func (s *sqliteStore) LoadFrontier() ([]byte, error) {
+	var state []byte
+	err := s.db.QueryRow(`SELECT state FROM store_frontier WHERE id = 1`).Scan(&state)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return state, err
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// buckets of a bolt store, findings are keyed by their sequence number
+var (
+	boltFindings = []byte("findings")
+	boltSeen     = []byte("seen")
+	boltFrontier = []byte("frontier")
+	// the one key in boltFrontier
+	boltState = []byte("state")
+)
+
+// boltStore is a Store in a bolt database file, which needs no cgo
+type boltStore struct {
+	db *bolt.DB
+}
+
+func newBoltStore(path string) (*boltStore, error) {
+	// another run holding the file fails fast instead of waiting forever
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltFindings, boltSeen, boltFrontier} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) SaveFindings(findings []schema.Result) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltFindings)
+		for _, finding := range findings {
+			data, err := finding.JSON()
+			if err != nil {
+				return err
+			}
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err := b.Put(key, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) LoadFindings() ([]schema.Result, error) {
+	var findings []schema.Result
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltFindings).ForEach(func(_, data []byte) error {
+			var finding schema.Result
+			if err := json.Unmarshal(data, &finding); err != nil {
+				return err
+			}
+			findings = append(findings, finding)
+			return nil
+		})
+	})
+	return findings, err
+}
+
+func (s *boltStore) Seen(key string) (bool, error) {
+	seen := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(boltSeen)
+		if b.Get([]byte(key)) != nil {
+			seen = true
+			return nil
+		}
+		return b.Put([]byte(key), []byte{})
+	})
+	return seen, err
+}
+
+func (s *boltStore) SaveFrontier(state []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltFrontier).Put(boltState, state)
+	})
+}
+
+func (s *boltStore) LoadFrontier() ([]byte, error) {
+	var state []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// bolt's slices are only valid inside the transaction
+		if data := tx.Bucket(boltFrontier).Get(boltState); data != nil {
+			state = append([]byte(nil), data...)
+		}
+		return nil
+	})
+	return state, err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// whether findingKey treats the http and https, www and apex aliases of an
+// endpoint as one, -no-alias-dedupe turns it off
+var mergeAliases = true
+
+// the scheme and www. prefix of URLs, which aliases of a host differ in
+var aliasPrefixRegex = regexp.MustCompile(`(?i)\bhttps?://(?:www\.)?`)
+
+// findingKey identifies a finding across runs: reflections by where they
+// were injected and the page they came back on, as their URLs carry the
+// run's own canaries, anything else by its URL and text
+func findingKey(f schema.Result) string {
+	key := strings.Join([]string{f.Source, f.URL, f.Text}, " ")
+	if f.Form != "" {
+		page := f.URL
+		if i := strings.IndexAny(page, "?#"); i >= 0 {
+			page = page[:i]
+		}
+		key = strings.Join([]string{f.Source, f.Form, strings.Join(f.Params, ","), page}, " ")
+	}
+	if mergeAliases {
+		key = aliasPrefixRegex.ReplaceAllString(key, "//")
+	}
+	return key
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// uploader puts run output into an S3 or GCS bucket, credentials come from
+// the environment the same way the vendors' own tools read them
+type uploader struct {
+	scheme string
+	bucket string
+	prefix string
+	client *http.Client
+
+	// S3
+	endpoint  string
+	region    string
+	keyID     string
+	secret    string
+	session   string
+	pathStyle bool
+	// GCS
+	token string
+}
+
+// newUploader parses an s3://bucket/prefix or gs://bucket/prefix destination.
+// S3 uses AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN and
+// AWS_REGION, plus AWS_ENDPOINT_URL for S3 compatible stores such as MinIO.
+// GCS uses an OAuth token from GOOGLE_OAUTH_ACCESS_TOKEN, e.g. from
+// gcloud auth print-access-token
+func newUploader(dest string) (*uploader, error) {
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	up := &uploader{
+		scheme: u.Scheme,
+		bucket: u.Host,
+		prefix: strings.Trim(u.Path, "/"),
+		client: &http.Client{Timeout: 5 * time.Minute},
+	}
+	if up.bucket == "" {
+		return nil, fmt.Errorf("no bucket in %q", dest)
+	}
+	switch u.Scheme {
+	case "s3":
+		up.keyID, up.secret = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		up.session = os.Getenv("AWS_SESSION_TOKEN")
+		if up.keyID == "" || up.secret == "" {
+			return nil, errors.New("s3 upload needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		up.region = os.Getenv("AWS_REGION")
+		if up.region == "" {
+			up.region = os.Getenv("AWS_DEFAULT_REGION")
+		}
+		if up.region == "" {
+			up.region = "us-east-1"
+		}
+		up.endpoint = strings.TrimRight(os.Getenv("AWS_ENDPOINT_URL"), "/")
+		// custom endpoints rarely have a wildcard DNS name per bucket
+		up.pathStyle = up.endpoint != ""
+		if up.endpoint == "" {
+			up.endpoint = "https://s3." + up.region + ".amazonaws.com"
+		}
+	case "gs":
+		up.token = os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+		if up.token == "" {
+			return nil, errors.New("gs upload needs an access token in GOOGLE_OAUTH_ACCESS_TOKEN")
+		}
+		up.endpoint = "https://storage.googleapis.com"
+		up.pathStyle = true
+	default:
+		return nil, fmt.Errorf("upload destination must be s3:// or gs://, got %q", dest)
+	}
+	return up, nil
+}
+
+// location returns the s3:// or gs:// URL an object name is uploaded to
+func (up *uploader) location(name string) string {
+	return up.scheme + "://" + up.bucket + "/" + up.key(name)
+}
+
+func (up *uploader) key(name string) string {
+	if up.prefix == "" {
+		return name
+	}
+	return up.prefix + "/" + name
+}
+
+// put uploads a file under the prefix as name
+func (up *uploader) put(name, path, contentType string) error {
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var target string
+	if up.pathStyle {
+		target = up.endpoint + "/" + uriEncode(up.bucket) + "/" + uriEncode(up.key(name))
+	} else {
+		endpoint, _ := url.Parse(up.endpoint)
+		target = endpoint.Scheme + "://" + up.bucket + "." + endpoint.Host + "/" + uriEncode(up.key(name))
+	}
+	req, err := http.NewRequest("PUT", target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if up.scheme == "s3" {
+		signV4(req, sha256Hex(body), up.region, up.keyID, up.secret, up.session, time.Now())
+	} else {
+		req.Header.Set("Authorization", "Bearer "+up.token)
+	}
+	resp, err := up.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("uploading %s: %s %s", up.location(name), resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// signV4 adds AWS Signature Version 4 headers for S3 to req
+func signV4(req *http.Request, payloadHash, region, keyID, secret, session string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if session != "" {
+		req.Header.Set("X-Amz-Security-Token", session)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonical))
+
+	key := hmacSHA256([]byte("AWS4"+secret), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", keyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// uriEncode percent-encodes everything but unreserved characters and '/', as S3 expects
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}